@@ -3,8 +3,8 @@ package cmd
 import (
 	"fmt"
 	"io/ioutil"
-	"os"
 	"path"
+	"path/filepath"
 	"strings"
 
 	"github.com/dbaumgarten/yodk/pkg/nolol"
@@ -13,20 +13,22 @@ import (
 	"github.com/spf13/cobra"
 )
 
+var writeSourceMap bool
+
 // compileCmd represents the compile command
 var compileCmd = &cobra.Command{
 	Use:   "compile [file]+",
 	Short: "Compile nolol programms to yolol",
 	Run: func(cmd *cobra.Command, args []string) {
-		for _, file := range args {
-			fmt.Println("Compiling file:", file)
-			compileFile(file)
-		}
+		runOrWatch("compile", args, compileFile)
 	},
 	Args: cobra.MinimumNArgs(1),
 }
 
-func compileFile(fpath string) {
+// compileFile compiles the given nolol-file and writes the result (and if requested the source-map)
+// Returns the files the compilation depends on (the input-file and all included files)
+func compileFile(fpath string) ([]string, error) {
+	fmt.Println("Compiling file:", fpath)
 	var outfile string
 	if outputFile != "" {
 		outfile = outputFile
@@ -37,29 +39,46 @@ func compileFile(fpath string) {
 	converter.SetDebug(debugLog)
 	converter.SetChipType(chipType)
 
-	converted, compileerr := converter.LoadFile(fpath).Convert()
+	done := converter.LoadFile(fpath).RunConversion()
+	deps := []string{fpath}
+	for _, included := range done.GetIncludedFiles() {
+		deps = append(deps, filepath.Join(filepath.Dir(fpath), filepath.FromSlash(included)))
+	}
+	converted, compileerr := done.Get()
 
 	// compilation failed completely. Fail now!
 	if converted == nil {
-		exitOnError(compileerr, "converting '"+fpath+"' to yolol")
+		return deps, failure(compileerr, "converting '"+fpath+"' to yolol")
 	}
 
 	gen := parser.Printer{}
 	generated, err := gen.Print(converted)
-	exitOnError(err, "generating code")
+	if err != nil {
+		return deps, failure(err, "generating code")
+	}
 	err = ioutil.WriteFile(outfile, []byte(generated), 0700)
-	exitOnError(err, "writing file")
+	if err != nil {
+		return deps, failure(err, "writing file")
+	}
 
-	if compileerr != nil {
-		fmt.Println("Compilation succeeded with errors. Please check the output:", compileerr)
-		os.Exit(1)
+	if writeSourceMap {
+		err = done.GetSourceMap().Save(outfile + ".map")
+		if err != nil {
+			return deps, failure(err, "writing source-map")
+		}
 	}
 
+	if compileerr != nil {
+		return deps, fmt.Errorf("Compilation succeeded with errors. Please check the output: %s", compileerr)
+	}
+	return deps, nil
 }
 
 func init() {
 	rootCmd.AddCommand(compileCmd)
 	compileCmd.Flags().StringVarP(&outputFile, "out", "o", "", "The output file")
 	compileCmd.Flags().BoolVarP(&debugLog, "debug", "d", false, "Print debug logs while parsing")
+	compileCmd.Flags().BoolVar(&writeSourceMap, "sourcemap", false, "Write a source-map (<output file>.map) that maps the generated yolol-code to the nolol-source")
 	compileCmd.Flags().StringVarP(&chipType, "chip", "c", "auto", "Chip-type to validate for. (auto|professional|advanced|basic)")
+	compileCmd.Flags().BoolVarP(&watch, "watch", "w", false, "Keep running and re-compile files when they (or the files they include) change")
 }
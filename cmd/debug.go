@@ -6,6 +6,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/dbaumgarten/yodk/pkg/debug"
 
@@ -30,6 +31,18 @@ var running bool
 
 var ignoreErrs bool
 
+// if true, run the scripts with ingame-timing
+var realtime bool
+
+// duration of a tick in realtime-mode
+var tickInterval time.Duration
+
+// speed-multiplier for realtime-mode
+var speed float64
+
+// number of executed lines per script that can be undone
+var historySize int
+
 // debugCmd represents the debug command
 var debugCmd = &cobra.Command{
 	Use:   "debug [script]+ / debug [testfile]",
@@ -78,20 +91,37 @@ func load(args []string) {
 	}
 	exitOnError(err, "starting debugger")
 	helper.IgnoreErrs = ignoreErrs
+	if realtime {
+		helper.Coordinator.SetTickInterval(tickInterval)
+		err = helper.Coordinator.SetSpeed(speed)
+		exitOnError(err, "starting debugger")
+	}
 
 	debugShell.Println("Loaded and paused programs. Enter 'c' to start execution.")
 }
 
 // prepares the given VM for use in the debugger
 func prepareVM(thisVM *vm.VM, inputFileName string) {
+	thisVM.SetHistorySize(historySize)
 	thisVM.SetBreakpointHandler(func(x *vm.VM) bool {
-		debugShell.Printf("--Hit Breakpoint at %s:%d--\n", inputFileName, x.CurrentSourceLine())
+		debugShell.Printf("--Hit Breakpoint at %s--\n", currentLocation(x, inputFileName))
+		return false
+	})
+	thisVM.SetLogpointHandler(func(x *vm.VM, bp vm.Breakpoint, message string) {
+		debugShell.Printf("--Log at %s:%d--: %s\n", inputFileName, bp.Line, message)
+	})
+	thisVM.SetWatchpointHandler(func(x *vm.VM, wp vm.Watchpoint, old *vm.Variable, new *vm.Variable) bool {
+		change := new.Repr()
+		if old != nil {
+			change = old.Repr() + " -> " + new.Repr()
+		}
+		debugShell.Printf("--Hit watchpoint on %s (%s) at %s: %s--\n", wp.Variable, wp.Type, currentLocation(x, inputFileName), change)
 		return false
 	})
 	thisVM.SetErrorHandler(func(x *vm.VM, err error) bool {
 		if !helper.IgnoreErrs {
-			debugShell.Printf("--A runtime error occured at %s:%d--\n", inputFileName, x.CurrentSourceLine())
-			debugShell.Println(err)
+			debugShell.Printf("--A runtime error occured at %s--\n", currentLocation(x, inputFileName))
+			debugShell.Println(helper.LocateError(helper.ScriptIndexByName(inputFileName), err))
 			debugShell.Println("--Execution paused--")
 			return false
 		}
@@ -101,14 +131,27 @@ func prepareVM(thisVM *vm.VM, inputFileName string) {
 		debugShell.Printf("--Program %s finished--\n", inputFileName)
 	})
 	thisVM.SetStepHandler(func(x *vm.VM) {
-		debugShell.Printf("--Step executed. VM paused at %s:%d--\n", inputFileName, x.CurrentSourceLine())
+		debugShell.Printf("--Step executed. VM paused at %s--\n", currentLocation(x, inputFileName))
 	})
 }
 
+// currentLocation returns the current location of the given vm in the form file:line
+// For nolol-scripts the location inside the nolol-source (including macro-insertions and includes) is returned
+func currentLocation(x *vm.VM, inputFileName string) string {
+	if origin, found := helper.CurrentOrigin(helper.ScriptIndexByName(inputFileName)); found {
+		return origin.String()
+	}
+	return fmt.Sprintf("%s:%d", inputFileName, x.CurrentSourceLine())
+}
+
 // initialize the shell
 func init() {
 	debugCmd.Flags().IntVarP(&caseNumber, "case", "c", 1, "Numer of the case to execute when debugging a test")
 	debugCmd.Flags().BoolVarP(&ignoreErrs, "ignore", "i", false, "If true, ignore runtime-errors when debugging scripts")
+	debugCmd.Flags().BoolVarP(&realtime, "realtime", "r", false, "If true, execute one line per script every tick (like ingame)")
+	debugCmd.Flags().DurationVar(&tickInterval, "tick", vm.DefaultTickInterval, "Duration of a tick in realtime-mode")
+	debugCmd.Flags().Float64Var(&speed, "speed", 1, "Speed-multiplier for realtime-mode")
+	debugCmd.Flags().IntVar(&historySize, "history", 1000, "Number of executed lines per script that can be undone using 'back' and 'reverse'")
 
 	rootCmd.AddCommand(debugCmd)
 
@@ -200,12 +243,54 @@ func init() {
 			helper.Vms[helper.CurrentScript].Step()
 		},
 	})
+	debugShell.AddCmd(&ishell.Cmd{
+		Name:    "back",
+		Aliases: []string{"sb"},
+		Help:    "go back to the previously executed line (undoes its changes)",
+		Func: func(c *ishell.Context) {
+			err := helper.Vms[helper.CurrentScript].StepBack()
+			if err != nil {
+				debugShell.Println(err)
+			}
+		},
+	})
+	debugShell.AddCmd(&ishell.Cmd{
+		Name:    "reverse",
+		Aliases: []string{"rc"},
+		Help:    "go back in time until a breakpoint is reached",
+		Func: func(c *ishell.Context) {
+			err := helper.Vms[helper.CurrentScript].ReverseContinue()
+			if err != nil {
+				debugShell.Println(err)
+			}
+		},
+	})
+	debugShell.AddCmd(&ishell.Cmd{
+		Name:    "jump",
+		Aliases: []string{"j"},
+		Help:    "continue the execution at the start of the given line (without executing the rest of the current line)",
+		Func: func(c *ishell.Context) {
+			if len(c.Args) != 1 {
+				debugShell.Println("You must enter a line number to jump to.")
+				return
+			}
+			line, err := strconv.Atoi(c.Args[0])
+			if err != nil {
+				debugShell.Println("Error parsing line-number: ", err)
+				return
+			}
+			err = helper.CurrentVM().SetNextLine(line)
+			if err != nil {
+				debugShell.Println(err)
+			}
+		},
+	})
 	debugShell.AddCmd(&ishell.Cmd{
 		Name:    "break",
 		Aliases: []string{"b"},
-		Help:    "add breakpoint at line",
+		Help:    "add breakpoint at line: break <line> [if <condition>] [hits <hit-condition>] [log <message (rest of the line)>]",
 		Func: func(c *ishell.Context) {
-			if len(c.Args) != 1 {
+			if len(c.Args) < 1 {
 				debugShell.Println("You must enter a line number for the breakpoint.")
 				return
 			}
@@ -215,14 +300,14 @@ func init() {
 				return
 			}
 
-			if validBps, exists := helper.ValidBreakpoints[helper.CurrentScript]; exists {
-				if _, isValid := validBps[line]; !isValid {
-					debugShell.Println("You can not set a breakpoint at this line")
-					return
-				}
+			options := parseBreakpointOptions(c.Args[1:])
+			bp, err := helper.NewBreakpoint(helper.CurrentScript, line, options["if"], options["hits"], options["log"])
+			if err != nil {
+				debugShell.Println(err)
+				return
 			}
 
-			helper.Vms[helper.CurrentScript].AddBreakpoint(line)
+			helper.Vms[helper.CurrentScript].SetBreakpoint(bp)
 			debugShell.Println("--Breakpoint added--")
 		},
 	})
@@ -244,6 +329,98 @@ func init() {
 			debugShell.Println("--Breakpoint removed--")
 		},
 	})
+	debugShell.AddCmd(&ishell.Cmd{
+		Name:    "watch",
+		Aliases: []string{"wa"},
+		Help:    "list watchpoints or add a watchpoint: watch <variable> [read|write|readWrite|change] [<operator> <value>]",
+		Func: func(c *ishell.Context) {
+			if len(c.Args) == 0 {
+				watchpoints := append(helper.CurrentVM().ListWatchpoints(), helper.Coordinator.ListWatchpoints()...)
+				if len(watchpoints) == 0 {
+					debugShell.Println("There are no watchpoints.")
+					return
+				}
+				for _, wp := range watchpoints {
+					debugShell.Println(wp.Variable, wp.Type, wp.Condition)
+				}
+				return
+			}
+			typ := vm.WatchWrite
+			if len(c.Args) > 1 {
+				typ = c.Args[1]
+			}
+			condition := ""
+			if len(c.Args) > 2 {
+				condition = strings.Join(c.Args[2:], " ")
+			}
+			wp, err := vm.NewWatchpoint(watchedVarname(c.Args[0]), typ, condition)
+			if err != nil {
+				debugShell.Println(err)
+				return
+			}
+			// watchpoints on global variables are added to the coordinator, so they trigger in every script
+			if wp.IsGlobal() {
+				err = helper.Coordinator.AddWatchpoint(wp)
+				if err != nil {
+					debugShell.Println(err)
+					return
+				}
+			} else {
+				helper.CurrentVM().AddWatchpoint(wp)
+			}
+			debugShell.Println("--Watchpoint added--")
+		},
+	})
+	debugShell.AddCmd(&ishell.Cmd{
+		Name:    "unwatch",
+		Aliases: []string{"uw"},
+		Help:    "delete all watchpoints for a variable",
+		Func: func(c *ishell.Context) {
+			if len(c.Args) != 1 {
+				debugShell.Println("You must enter a variable-name.")
+				return
+			}
+			varname := watchedVarname(c.Args[0])
+			if strings.HasPrefix(varname, ":") {
+				helper.Coordinator.RemoveWatchpoints(varname)
+			} else {
+				helper.CurrentVM().RemoveWatchpoints(varname)
+			}
+			debugShell.Println("--Watchpoints removed--")
+		},
+	})
+	debugShell.AddCmd(&ishell.Cmd{
+		Name: "speed",
+		Help: "show or set the speed of realtime-execution. 'speed <multiplier>' enables realtime-mode, 'speed off' disables it",
+		Func: func(c *ishell.Context) {
+			if len(c.Args) == 0 {
+				interval := helper.Coordinator.GetTickInterval()
+				if interval == 0 {
+					debugShell.Println("Realtime-mode is disabled")
+					return
+				}
+				debugShell.Printf("Realtime-mode with a tick-interval of %s and a speed of %gx\n", interval, helper.Coordinator.GetSpeed())
+				return
+			}
+			if c.Args[0] == "off" {
+				helper.Coordinator.SetTickInterval(0)
+				debugShell.Println("--Realtime-mode disabled--")
+				return
+			}
+			multiplier, err := strconv.ParseFloat(c.Args[0], 64)
+			if err != nil {
+				debugShell.Println("Error parsing speed-multiplier: ", err)
+				return
+			}
+			err = helper.Coordinator.SetSpeed(multiplier)
+			if err != nil {
+				debugShell.Println(err)
+				return
+			}
+			helper.Coordinator.SetTickInterval(tickInterval)
+			debugShell.Printf("--Realtime-mode enabled with a speed of %gx--\n", multiplier)
+		},
+	})
 	debugShell.AddCmd(&ishell.Cmd{
 		Name:    "vars",
 		Aliases: []string{"v"},
@@ -267,6 +444,37 @@ func init() {
 			}
 		},
 	})
+	debugShell.AddCmd(&ishell.Cmd{
+		Name:    "devices",
+		Aliases: []string{"dev"},
+		Help:    "print all simulated devices and their fields",
+		Func: func(c *ishell.Context) {
+			devices := helper.Coordinator.GetDevices()
+			if len(devices) == 0 {
+				debugShell.Println("There are no simulated devices.")
+				return
+			}
+			for _, device := range devices {
+				network := device.Network
+				if network == "" {
+					network = vm.DefaultNetwork
+				}
+				debugShell.Printf("--Device %s (network %s)--\n", device.Name, network)
+				fields := make([]string, 0, len(device.Fields))
+				for field := range device.Fields {
+					fields = append(fields, field)
+				}
+				sort.Strings(fields)
+				for _, field := range fields {
+					value, exists := helper.Coordinator.GetNetworkVariable(network, ":"+strings.TrimPrefix(field, ":"))
+					if !exists {
+						continue
+					}
+					debugShell.Println(field, value.Repr())
+				}
+			}
+		},
+	})
 	debugShell.AddCmd(&ishell.Cmd{
 		Name:    "set",
 		Aliases: []string{"w"},
@@ -283,6 +491,27 @@ func init() {
 			debugShell.Println("--Variable set--")
 		},
 	})
+	debugShell.AddCmd(&ishell.Cmd{
+		Name:    "eval",
+		Aliases: []string{"e"},
+		Help:    "evaluate a yolol-expression or execute yolol-statements in the context of the current script",
+		Func: func(c *ishell.Context) {
+			if len(c.Args) == 0 {
+				debugShell.Println("You must enter an expression or statements")
+				return
+			}
+			result, err := helper.Evaluate(helper.CurrentScript, strings.Join(c.Args, " "), true)
+			if err != nil {
+				debugShell.Println(err)
+				return
+			}
+			if result == nil {
+				debugShell.Println("--Executed--")
+				return
+			}
+			debugShell.Println(result.Repr())
+		},
+	})
 	debugShell.AddCmd(&ishell.Cmd{
 		Name:    "info",
 		Aliases: []string{"i"},
@@ -375,6 +604,41 @@ func sortVariables(vars map[string]vm.Variable) []namedVariable {
 	return sorted
 }
 
+// parses the optional arguments of the break-command
+// the arguments are split into the parts following the keywords 'if', 'hits' and 'log'
+// the log-message takes the rest of the line, so it can contain the keywords
+func parseBreakpointOptions(args []string) map[string]string {
+	options := make(map[string]string)
+	keyword := ""
+	for _, arg := range args {
+		switch arg {
+		case "if", "hits", "log":
+			if keyword != "log" {
+				keyword = arg
+				continue
+			}
+		}
+		if options[keyword] != "" {
+			options[keyword] += " "
+		}
+		options[keyword] += arg
+	}
+	return options
+}
+
+// returns the name of the variable to watch in the current script
+// local variables of nolol-scripts are renamed by the compiler
+func watchedVarname(name string) string {
+	if strings.HasPrefix(name, ":") {
+		return name
+	}
+	translated := helper.ReverseVarnameTranslation(helper.CurrentScript, name)
+	if translated == "" {
+		return name
+	}
+	return translated
+}
+
 func contains(arr []int, val int) bool {
 	for _, e := range arr {
 		if e == val {
@@ -20,28 +20,30 @@ var formatCmd = &cobra.Command{
 	Short: "Format yolol/nolol files",
 
 	Run: func(cmd *cobra.Command, args []string) {
-		for _, file := range args {
-			fmt.Println("Formatting file:", file)
-			format(file)
+		if formatMode != "readable" && formatMode != "compact" {
+			fmt.Println("Fomatting mode must be one of: readable|compact|spaceless")
+			os.Exit(1)
 		}
+		runOrWatch("format", args, format)
 	},
 }
 
-func format(filepath string) {
+// format formats the given file in place. Returns the files the result depends on
+func format(filepath string) ([]string, error) {
+	fmt.Println("Formatting file:", filepath)
+	deps := []string{filepath}
 
-	if formatMode != "readable" && formatMode != "compact" {
-		fmt.Println("Fomatting mode must be one of: readable|compact|spaceless")
-		os.Exit(1)
+	content, err := ioutil.ReadFile(filepath)
+	if err != nil {
+		return deps, failure(err, "Loading input file")
 	}
-
-	file := loadInputFile(filepath)
+	file := string(content)
 	generated := ""
-	var err error
 	if strings.HasSuffix(filepath, ".yolol") {
 		p := parser.NewParser()
 		parsed, errs := p.Parse(file)
 		if errs != nil {
-			exitOnError(errs, "parsing file")
+			return deps, failure(errs, "parsing file")
 		}
 		gen := parser.Printer{}
 		switch formatMode {
@@ -53,28 +55,41 @@ func format(filepath string) {
 			break
 		}
 		generated, err = gen.Print(parsed)
-		exitOnError(err, "generating code")
+		if err != nil {
+			return deps, failure(err, "generating code")
+		}
 		err = util.CheckForFormattingErrorYolol(parsed, generated)
-		exitOnError(err, "formatting code")
+		if err != nil {
+			return deps, failure(err, "formatting code")
+		}
 	} else if strings.HasSuffix(filepath, ".nolol") {
 		p := nolol.NewParser()
 		parsed, errs := p.Parse(file)
 		if errs != nil {
-			exitOnError(errs, "parsing file")
+			return deps, failure(errs, "parsing file")
 		}
 		printer := nolol.NewPrinter()
 		generated, err = printer.Print(parsed)
-		exitOnError(err, "generating code")
+		if err != nil {
+			return deps, failure(err, "generating code")
+		}
 		err = util.CheckForFormattingErrorNolol(parsed, generated)
-		exitOnError(err, "formatting code")
+		if err != nil {
+			return deps, failure(err, "formatting code")
+		}
 	} else {
-		exitOnError(fmt.Errorf("Unsupported file-type"), "opening file")
+		return deps, failure(fmt.Errorf("Unsupported file-type"), "opening file")
 	}
 
-	ioutil.WriteFile(filepath, []byte(generated), 0700)
+	// do not touch unchanged files. Otherwise --watch would see a change
+	if generated != file {
+		ioutil.WriteFile(filepath, []byte(generated), 0700)
+	}
+	return deps, nil
 }
 
 func init() {
 	rootCmd.AddCommand(formatCmd)
 	formatCmd.Flags().StringVarP(&formatMode, "mode", "m", "compact", "Formatting mode [readable,compact,spaceless]")
+	formatCmd.Flags().BoolVarP(&watch, "watch", "w", false, "Keep running and re-format files when they change")
 }
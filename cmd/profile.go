@@ -0,0 +1,179 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/dbaumgarten/yodk/pkg/coverage"
+	"github.com/dbaumgarten/yodk/pkg/testing"
+	"github.com/dbaumgarten/yodk/stdlib"
+	"github.com/spf13/cobra"
+)
+
+// file to write a lcov-report to
+var lcovFile string
+
+// file to write a html-report to
+var htmlFile string
+
+// number of lines to show in the profile
+var profileTop int
+
+// serializes the access to profiles, as cases may run concurrently
+var profileLock sync.Mutex
+
+// profileCmd represents the profile command
+var profileCmd = &cobra.Command{
+	Use:   "profile [testfile]+",
+	Short: "Show which lines are executed most often",
+	Long:  `Runs all cases of the given tests and shows which lines of the tested scripts have been executed most often`,
+	Run: func(cmd *cobra.Command, args []string) {
+		profile := coverage.NewProfile()
+		failed := false
+		for _, arg := range args {
+			fails := runTestFile(arg, profile).Fails()
+			if len(fails) > 0 {
+				failed = true
+				fmt.Println("There were errors when running the tests:")
+				for _, err := range fails {
+					fmt.Println(err)
+				}
+			}
+		}
+
+		fmt.Println("Most executed lines:")
+		for _, line := range profile.HotLines(profileTop) {
+			fmt.Printf("%8d  %s:%d  %s\n", line.Count, line.File, line.Line, sourceLine(line.File, line.Line))
+		}
+		profile.WriteSummary(os.Stdout)
+		writeProfileReports(profile)
+
+		if failed {
+			os.Exit(1)
+		}
+	},
+	Args: cobra.MinimumNArgs(1),
+}
+
+// runTestFile runs all cases of the given test-file and returns the results
+// If profile is not nil, the execution-counts of the scripts are added to it
+func runTestFile(testfile string, profile *coverage.Profile) testing.TestResult {
+	fmt.Println("Running file: " + testfile)
+	return runTest(loadTestFile(testfile), testfile, profile, nil, os.Stdout)
+}
+
+// loadTestFile loads and parses the given test-file. Exits if the file is invalid
+func loadTestFile(testfile string) testing.Test {
+	test, err := parseTestFile(testfile)
+	exitOnError(err, "loading test case")
+	return test
+}
+
+// parseTestFile loads and parses the given test-file and applies the overrides given via command-line
+func parseTestFile(testfile string) (testing.Test, error) {
+	file, err := ioutil.ReadFile(testfile)
+	if err != nil {
+		return testing.Test{}, err
+	}
+	absolutePath, _ := filepath.Abs(testfile)
+	test, err := testing.Parse(file, absolutePath)
+	if err != nil {
+		return test, err
+	}
+	test.UpdateSnapshots = updateSnapshots
+	if test.Fuzz != nil {
+		if fuzzSeed != 0 {
+			test.Fuzz.Seed = fuzzSeed
+		}
+		if fuzzRuns > 0 {
+			test.Fuzz.Runs = fuzzRuns
+		}
+	}
+	return test, nil
+}
+
+// runTest runs all cases of the given test, which has been loaded from testfile, and returns the results
+// The cases are run concurrently as allowed by limiter (nil = one after another). Progress is written to out
+// If profile is not nil, the execution-counts of the scripts are added to it
+func runTest(test testing.Test, testfile string, profile *coverage.Profile, limiter testing.Limiter, out io.Writer) testing.TestResult {
+	var finished func(*testing.CaseRunner)
+	if profile != nil {
+		finished = profileCollector(profile, filepath.Dir(testfile))
+	}
+	result := test.RunParallel(limiter, func(c testing.Case) {
+		fmt.Fprintln(out, "- Running case: "+c.Name)
+	}, finished)
+	if updateSnapshots {
+		fmt.Fprintln(out, "Updated snapshot: "+test.SnapshotFile())
+	}
+	// report the file as given by the user
+	result.File = testfile
+	return result
+}
+
+// profileCollector returns a function that adds the execution-counts of the VMs of a finished case-runner to profile
+// dir is the directory of the test-file. The scripts of the test are relative to this directory
+// The returned function can be used concurrently
+func profileCollector(profile *coverage.Profile, dir string) func(*testing.CaseRunner) {
+	return func(runner *testing.CaseRunner) {
+		profileLock.Lock()
+		defer profileLock.Unlock()
+		for i, v := range runner.VMs {
+			profile.AddVM(v, filepath.Join(dir, runner.Test.Scripts[i]), runner.SourceMaps[i])
+			// the vms of sequential tests are re-used. Make sure executions are only counted once
+			v.ResetExecutionCounts()
+		}
+	}
+}
+
+// writeProfileReports writes the lcov- and html-reports for the profile, if requested via flags
+func writeProfileReports(profile *coverage.Profile) {
+	if lcovFile != "" {
+		f, err := os.Create(lcovFile)
+		exitOnError(err, "creating lcov-file")
+		defer f.Close()
+		err = profile.WriteLCOV(f)
+		exitOnError(err, "writing lcov-file")
+	}
+	if htmlFile != "" {
+		f, err := os.Create(htmlFile)
+		exitOnError(err, "creating html-file")
+		defer f.Close()
+		err = profile.WriteHTML(f, readSourceFile)
+		exitOnError(err, "writing html-file")
+	}
+}
+
+// readSourceFile returns the content of the given source-file. Supports files from the nolol standard-library
+func readSourceFile(name string) (string, error) {
+	if stdlib.Is(name) {
+		return stdlib.Get(name)
+	}
+	content, err := ioutil.ReadFile(name)
+	return string(content), err
+}
+
+// sourceLine returns the given line of the given file (without surrounding whitespace) or an empty string
+func sourceLine(file string, line int) string {
+	content, err := readSourceFile(file)
+	if err != nil {
+		return ""
+	}
+	lines := strings.Split(content, "\n")
+	if line < 1 || line > len(lines) {
+		return ""
+	}
+	return strings.TrimSpace(lines[line-1])
+}
+
+func init() {
+	rootCmd.AddCommand(profileCmd)
+	profileCmd.Flags().IntVarP(&profileTop, "top", "n", 20, "Number of lines to show. 0 shows all executed lines")
+	profileCmd.Flags().StringVar(&lcovFile, "lcov", "", "Write the execution-counts in the lcov-format into the given file")
+	profileCmd.Flags().StringVar(&htmlFile, "html", "", "Write a html-page showing the execution-counts of every line into the given file")
+}
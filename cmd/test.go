@@ -1,29 +1,75 @@
 package cmd
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"os"
-	"path/filepath"
+	"strings"
 
+	"github.com/dbaumgarten/yodk/pkg/coverage"
 	"github.com/dbaumgarten/yodk/pkg/testing"
 	"github.com/spf13/cobra"
 )
 
+// if true, print a coverage-summary after running the tests
+var showCoverage bool
+
+// overrides the seed and number of runs for fuzzing (0 = use the values from the test-file)
+var fuzzSeed int64
+var fuzzRuns int
+
+// if true, record new snapshots instead of comparing against the existing ones
+var updateSnapshots bool
+
+// maximum number of cases to run concurrently
+var parallel int
+
+// reports to write, in the form format=path
+var reports []string
+
+// reportWriters maps the supported report-formats to the functions writing them
+var reportWriters = map[string]func(io.Writer, []testing.TestResult) error{
+	"junit": testing.WriteJUnitReport,
+	"json":  testing.WriteJSONReport,
+}
+
 // testCmd represents the format command
 var testCmd = &cobra.Command{
 	Use:   "test [testfile] [testfile] ...",
 	Short: "Run tests",
 
 	Run: func(cmd *cobra.Command, args []string) {
-		for _, arg := range args {
-			file := loadInputFile(arg)
-			absolutePath, _ := filepath.Abs(arg)
-			test, err := testing.Parse([]byte(file), absolutePath)
-			exitOnError(err, "loading test case")
-			fmt.Println("Running file: " + arg)
-			fails := test.Run(func(c testing.Case) {
-				fmt.Println("- Running case: " + c.Name)
-			})
+		if watch {
+			if showCoverage || lcovFile != "" || htmlFile != "" || len(reports) > 0 {
+				exitOnError(fmt.Errorf("--watch can not be combined with --coverage, --lcov, --html or --report"), "parsing flags")
+			}
+			runOrWatch("test", args, watchTestFile)
+			return
+		}
+		reportFiles := parseReportFlags()
+		results := make([]testing.TestResult, 0, len(args))
+		var profile *coverage.Profile
+		if showCoverage || lcovFile != "" || htmlFile != "" {
+			profile = coverage.NewProfile()
+		}
+		var runs []*testFileRun
+		if parallel > 1 {
+			runs = startTestFiles(args, profile, testing.NewLimiter(parallel))
+		}
+		failed := false
+		for i, arg := range args {
+			var result testing.TestResult
+			if runs != nil {
+				// print the results in the order of the arguments
+				<-runs[i].done
+				fmt.Print(runs[i].output.String())
+				result = runs[i].result
+			} else {
+				result = runTestFile(arg, profile)
+			}
+			results = append(results, result)
+			fails := result.Fails()
 			if len(fails) == 0 {
 				fmt.Println("Tests OK")
 			} else {
@@ -31,12 +77,111 @@ var testCmd = &cobra.Command{
 				for _, err := range fails {
 					fmt.Println(err)
 				}
-				os.Exit(1)
+				failed = true
 			}
 		}
+
+		// the reports and the coverage always contain the results of all files
+		writeReports(reportFiles, results)
+		if profile != nil {
+			fmt.Println("Coverage:")
+			profile.WriteSummary(os.Stdout)
+			writeProfileReports(profile)
+		}
+		if failed {
+			os.Exit(1)
+		}
 	},
 }
 
+// testFileRun is a test-file that is run in the background
+type testFileRun struct {
+	// the output produced while running the file
+	output bytes.Buffer
+	result testing.TestResult
+	// closed once the file has been run
+	done chan struct{}
+}
+
+// startTestFiles loads the given test-files and starts running them concurrently
+// The number of concurrently running cases (of all files) is limited by limiter
+func startTestFiles(files []string, profile *coverage.Profile, limiter testing.Limiter) []*testFileRun {
+	// load all files first, so invalid files are reported before any test runs
+	tests := make([]testing.Test, len(files))
+	for i, file := range files {
+		tests[i] = loadTestFile(file)
+	}
+	runs := make([]*testFileRun, len(files))
+	for i := range files {
+		run := &testFileRun{
+			done: make(chan struct{}),
+		}
+		runs[i] = run
+		go func(i int) {
+			defer close(run.done)
+			fmt.Fprintln(&run.output, "Running file: "+files[i])
+			run.result = runTest(tests[i], files[i], profile, limiter, &run.output)
+		}(i)
+	}
+	return runs
+}
+
+// watchTestFile runs the given test-file for --watch. Returns the files the test depends on
+func watchTestFile(testfile string) ([]string, error) {
+	fmt.Println("Running file: " + testfile)
+	test, err := parseTestFile(testfile)
+	if err != nil {
+		return nil, failure(err, "loading test case")
+	}
+	result := runTest(test, testfile, nil, testing.NewLimiter(parallel), os.Stdout)
+	fails := result.Fails()
+	if len(fails) > 0 {
+		messages := make([]string, len(fails))
+		for i, err := range fails {
+			messages[i] = err.Error()
+		}
+		return test.Dependencies(), fmt.Errorf("There were errors when running the tests:\n%s", strings.Join(messages, "\n"))
+	}
+	fmt.Println("Tests OK")
+	return test.Dependencies(), nil
+}
+
+// parseReportFlags parses the --report flags and returns a map from report-format to file-path
+func parseReportFlags() map[string]string {
+	reportFiles := make(map[string]string, len(reports))
+	for _, report := range reports {
+		parts := strings.SplitN(report, "=", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			exitOnError(fmt.Errorf("'%s' is not of the form format=path", report), "parsing --report")
+		}
+		if _, exists := reportWriters[parts[0]]; !exists {
+			exitOnError(fmt.Errorf("Unknown report-format '%s'. Supported formats are junit and json", parts[0]), "parsing --report")
+		}
+		reportFiles[parts[0]] = parts[1]
+	}
+	return reportFiles
+}
+
+// writeReports writes the results of the tests in the requested formats
+func writeReports(reportFiles map[string]string, results []testing.TestResult) {
+	for format, path := range reportFiles {
+		f, err := os.Create(path)
+		exitOnError(err, "creating report-file")
+		err = reportWriters[format](f, results)
+		f.Close()
+		exitOnError(err, "writing "+format+"-report")
+	}
+}
+
 func init() {
 	rootCmd.AddCommand(testCmd)
+	testCmd.Flags().BoolVar(&showCoverage, "coverage", false, "Print which percentage of the lines of the tested scripts has been executed")
+	testCmd.Flags().StringVar(&lcovFile, "lcov", "", "Write the coverage in the lcov-format into the given file. Implies --coverage")
+	testCmd.Flags().StringVar(&htmlFile, "html", "", "Write a html-page showing the coverage of every line into the given file. Implies --coverage")
+	testCmd.Flags().Int64Var(&fuzzSeed, "seed", 0, "Seed for the random inputs of fuzzing. Use the seed of a failed run to reproduce it")
+	testCmd.Flags().IntVarP(&parallel, "parallel", "p", 1, "Run up to this many cases (of non-sequential tests) and test-files concurrently")
+	testCmd.Flags().BoolVar(&updateSnapshots, "update-snapshots", false, "Record the values of all global variables after each case (and the compiled code, if enabled) into the snapshot-files of the tests")
+	testCmd.Flags().StringArrayVar(&reports, "report", []string{}, "Write a machine-readable report of the results. Format: junit=path or json=path. Can be given multiple times")
+	testCmd.Flags().BoolVarP(&watch, "watch", "w", false, "Keep running and re-run test-files when they (or the files they depend on) change")
+	testCmd.Flags().IntVar(&fuzzRuns, "fuzz-runs", 0, "Number of randomized cases to run when fuzzing. Overrides the value of the test-file")
 }
@@ -0,0 +1,322 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/abiosoft/ishell"
+	"github.com/dbaumgarten/yodk/pkg/debug"
+	"github.com/dbaumgarten/yodk/pkg/testing"
+	"github.com/dbaumgarten/yodk/pkg/trace"
+	"github.com/dbaumgarten/yodk/pkg/vm"
+	"github.com/spf13/cobra"
+)
+
+// maximum number of lines each script is run when recording scripts
+var traceLines int
+
+// the shell used to replay traces
+var replayShell *ishell.Shell
+
+// the replayer used by the replay-shell
+var replayer *trace.Replayer
+
+// the script that is currently selected in the replay-shell
+var replayScript int
+
+// traceCmd represents the trace command
+var traceCmd = &cobra.Command{
+	Use:   "trace",
+	Short: "Record and replay execution-traces",
+	Long:  `Record which lines are executed and how variables change during a run of scripts or a test-case and replay the recording`,
+}
+
+// traceRecordCmd represents the trace record command
+var traceRecordCmd = &cobra.Command{
+	Use:   "record [script]+ / record [testfile]",
+	Short: "Record an execution-trace",
+	Run: func(cmd *cobra.Command, args []string) {
+		var tr *trace.Trace
+		if strings.HasSuffix(args[0], ".yaml") {
+			if len(args) > 1 {
+				fmt.Println("Can only record one test at once")
+				os.Exit(1)
+			}
+			tr = recordTest(args[0])
+		} else {
+			tr = recordScripts(args)
+		}
+
+		outfile := outputFile
+		if outfile == "" {
+			outfile = strings.Replace(args[0], path.Ext(args[0]), ".trace", -1)
+		}
+		err := tr.Save(outfile)
+		exitOnError(err, "writing trace")
+		fmt.Printf("Recorded %d entries into %s\n", len(tr.Entries), outfile)
+	},
+	Args: cobra.MinimumNArgs(1),
+}
+
+// traceShowCmd represents the trace show command
+var traceShowCmd = &cobra.Command{
+	Use:   "show [tracefile]",
+	Short: "Print a recorded execution-trace",
+	Run: func(cmd *cobra.Command, args []string) {
+		tr, err := trace.Load(args[0])
+		exitOnError(err, "loading trace")
+		for i, entry := range tr.Entries {
+			fmt.Println(formatTraceEntry(tr, i))
+			for _, change := range entry.Changes {
+				fmt.Println("    " + formatVariableChange(change))
+			}
+		}
+	},
+	Args: cobra.ExactArgs(1),
+}
+
+// traceReplayCmd represents the trace replay command
+var traceReplayCmd = &cobra.Command{
+	Use:   "replay [tracefile]",
+	Short: "Interactively step through a recorded execution-trace",
+	Run: func(cmd *cobra.Command, args []string) {
+		tr, err := trace.Load(args[0])
+		exitOnError(err, "loading trace")
+		replayer = trace.NewReplayer(tr)
+		replayScript = 0
+		replayShell.Printf("Loaded trace with %d lines. Enter 's' to replay the next line.\n", replayer.Len())
+		replayShell.Run()
+	},
+	Args: cobra.ExactArgs(1),
+}
+
+// recordScripts runs the given scripts and records their execution
+func recordScripts(scripts []string) *trace.Trace {
+	h, err := debug.FromScripts("", scripts, func(yvm *vm.VM, filename string) {
+		yvm.SetMaxExecutedLines(traceLines)
+	})
+	exitOnError(err, "loading scripts")
+
+	recorder := trace.NewRecorder(h.ScriptNames)
+	recorder.AttachCoordinator(h.Coordinator)
+	for i, v := range h.Vms {
+		recorder.Attach(v, i)
+	}
+	h.Coordinator.Run()
+	h.Coordinator.WaitForTermination()
+	return recorder.Trace()
+}
+
+// recordTest runs the selected case of the given test and records the execution
+func recordTest(testfile string) *trace.Trace {
+	file := loadInputFile(testfile)
+	absolutePath, _ := filepath.Abs(testfile)
+	test, err := testing.Parse([]byte(file), absolutePath)
+	exitOnError(err, "loading test")
+
+	if caseNumber < 1 || caseNumber > len(test.Cases) {
+		fmt.Printf("The test-file does not contain a case number %d!\n", caseNumber)
+		os.Exit(1)
+	}
+
+	runner, err := test.GetRunner(caseNumber - 1)
+	exitOnError(err, "preparing test-case")
+
+	recorder := trace.NewRecorder(test.Scripts)
+	recorder.AttachCoordinator(runner.Coordinator)
+	for i, v := range runner.VMs {
+		recorder.Attach(v, i)
+	}
+
+	fails := runner.Run()
+	for _, fail := range fails {
+		fmt.Println(fail)
+	}
+	return recorder.Trace()
+}
+
+// formatTraceEntry returns a one-line description of the entry with the given index
+func formatTraceEntry(tr *trace.Trace, idx int) string {
+	entry := tr.Entries[idx]
+	if entry.VM == trace.External {
+		return fmt.Sprintf("#%d (devices, stubs and test-steps)", idx+1)
+	}
+	txt := fmt.Sprintf("#%d %s:%d", idx+1, tr.Scripts[entry.VM], entry.SourceLine)
+	if entry.SourceLine != entry.AstLine {
+		txt += fmt.Sprintf(" (yolol-line %d)", entry.AstLine)
+	}
+	if entry.Error != "" {
+		txt += " ERROR: " + entry.Error
+	}
+	return txt
+}
+
+// formatVariableChange returns a human-readable description of the change
+func formatVariableChange(change trace.VariableChange) string {
+	name := change.Name
+	if change.Network != "" && change.Network != vm.DefaultNetwork {
+		name += " (" + change.Network + ")"
+	}
+	if !change.Existed {
+		return fmt.Sprintf("%s: (unset) -> %s", name, change.New)
+	}
+	return fmt.Sprintf("%s: %s -> %s", name, change.Old, change.New)
+}
+
+// prints the entry that has been replayed last
+func printReplayPosition() {
+	if replayer.Current() == nil {
+		replayShell.Println("--At start of trace--")
+		return
+	}
+	replayShell.Println(formatTraceEntry(replayer.Trace(), replayer.Position()-1))
+	for _, change := range replayer.Current().Changes {
+		replayShell.Println("    " + formatVariableChange(change))
+	}
+}
+
+// returns the index of the script given as argument, or the current script if no argument is given
+func replayScriptFromArgs(args []string) (int, bool) {
+	if len(args) == 0 {
+		return replayScript, true
+	}
+	for i, name := range replayer.Trace().Scripts {
+		if name == args[0] {
+			return i, true
+		}
+	}
+	replayShell.Printf("--Unknown script %s--\n", args[0])
+	return 0, false
+}
+
+func init() {
+	traceRecordCmd.Flags().StringVarP(&outputFile, "out", "o", "", "The output file. Defaults to the name of the first input-file with the extension .trace")
+	traceRecordCmd.Flags().IntVarP(&caseNumber, "case", "c", 1, "Numer of the case to execute when recording a test")
+	traceRecordCmd.Flags().IntVarP(&traceLines, "lines", "l", 1000, "Maximum number of lines to execute per script when recording scripts")
+
+	traceCmd.AddCommand(traceRecordCmd)
+	traceCmd.AddCommand(traceShowCmd)
+	traceCmd.AddCommand(traceReplayCmd)
+	rootCmd.AddCommand(traceCmd)
+
+	replayShell = ishell.New()
+
+	replayShell.AddCmd(&ishell.Cmd{
+		Name:    "scripts",
+		Aliases: []string{"ll"},
+		Help:    "list recorded scripts",
+		Func: func(c *ishell.Context) {
+			for i, file := range replayer.Trace().Scripts {
+				line := "  "
+				if i == replayScript {
+					line = "> "
+				}
+				replayShell.Println(line + file)
+			}
+		},
+	})
+	replayShell.AddCmd(&ishell.Cmd{
+		Name:    "choose",
+		Aliases: []string{"cd"},
+		Help:    "change currently viewed script",
+		Func: func(c *ishell.Context) {
+			if len(c.Args) != 1 {
+				replayShell.Println("You must enter a script name (run scripts to list them).")
+				return
+			}
+			if idx, found := replayScriptFromArgs(c.Args); found {
+				replayScript = idx
+				replayShell.Printf("--Changed to %s--\n", c.Args[0])
+			}
+		},
+	})
+	replayShell.AddCmd(&ishell.Cmd{
+		Name:    "step",
+		Aliases: []string{"s"},
+		Help:    "replay the next recorded line (of any script)",
+		Func: func(c *ishell.Context) {
+			if !replayer.Step() {
+				replayShell.Println("--Reached end of trace--")
+				return
+			}
+			printReplayPosition()
+		},
+	})
+	replayShell.AddCmd(&ishell.Cmd{
+		Name:    "next",
+		Aliases: []string{"n"},
+		Help:    "replay until the next line of the current (or given) script",
+		Func: func(c *ishell.Context) {
+			idx, found := replayScriptFromArgs(c.Args)
+			if !found {
+				return
+			}
+			if !replayer.StepVM(idx) {
+				replayShell.Println("--Reached end of trace--")
+				return
+			}
+			printReplayPosition()
+		},
+	})
+	replayShell.AddCmd(&ishell.Cmd{
+		Name:    "back",
+		Aliases: []string{"b"},
+		Help:    "undo the last replayed line",
+		Func: func(c *ishell.Context) {
+			if !replayer.StepBack() {
+				replayShell.Println("--Reached start of trace--")
+				return
+			}
+			printReplayPosition()
+		},
+	})
+	replayShell.AddCmd(&ishell.Cmd{
+		Name:    "jump",
+		Aliases: []string{"j"},
+		Help:    "jump to the given position (line-number of the trace)",
+		Func: func(c *ishell.Context) {
+			if len(c.Args) != 1 {
+				replayShell.Println("You must enter a position to jump to.")
+				return
+			}
+			pos, err := strconv.Atoi(c.Args[0])
+			if err != nil {
+				replayShell.Println("Error parsing position: ", err)
+				return
+			}
+			replayer.Seek(pos)
+			printReplayPosition()
+		},
+	})
+	replayShell.AddCmd(&ishell.Cmd{
+		Name:    "vars",
+		Aliases: []string{"v"},
+		Help:    "print variables of the current script at the current position",
+		Func: func(c *ishell.Context) {
+			vars := replayer.GetVariables(replayScript)
+			names := make([]string, 0, len(vars))
+			for name := range vars {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				value := vars[name]
+				replayShell.Printf("%s: %s\n", name, value.Repr())
+			}
+		},
+	})
+	replayShell.AddCmd(&ishell.Cmd{
+		Name:    "info",
+		Aliases: []string{"i"},
+		Help:    "show the current position in the trace",
+		Func: func(c *ishell.Context) {
+			replayShell.Printf("Position %d of %d\n", replayer.Position(), replayer.Len())
+			printReplayPosition()
+		},
+	})
+}
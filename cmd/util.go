@@ -20,3 +20,12 @@ func loadInputFile(file string) string {
 	exitOnError(err, "Loading input file")
 	return string(f)
 }
+
+// failure returns an error describing that the given operation failed. The message is formatted like by exitOnError
+// Returns nil if err is nil
+func failure(err error, operation string) error {
+	if err == nil {
+		return nil
+	}
+	return fmt.Errorf("Error when %s:\n\n%s", operation, err.Error())
+}
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"fmt"
+	"io/ioutil"
 
 	"github.com/dbaumgarten/yodk/pkg/parser"
 	"github.com/dbaumgarten/yodk/pkg/validators"
@@ -17,30 +18,48 @@ var verifyCmd = &cobra.Command{
 	Short: "Check if a yolol programm is valid",
 	Long:  `Tries to parse a yolol file`,
 	Run: func(cmd *cobra.Command, args []string) {
-		for _, filepath := range args {
-			p := parser.NewParser()
-			p.SetDebugLog(debugLog)
-			file := loadInputFile(filepath)
-			parsed, errs := p.Parse(file)
-			exitOnError(errs, "parsing file '"+filepath+"'")
+		runOrWatch("verify", args, verifyFile)
+	},
+	Args: cobra.MinimumNArgs(1),
+}
 
-			err := validators.ValidateCodeLength(file)
-			exitOnError(err, "validating code")
+// verifyFile checks if the given yolol-file is valid. Returns the files the result depends on
+func verifyFile(filepath string) ([]string, error) {
+	deps := []string{filepath}
+	content, err := ioutil.ReadFile(filepath)
+	if err != nil {
+		return deps, failure(err, "Loading input file")
+	}
+	file := string(content)
+	p := parser.NewParser()
+	p.SetDebugLog(debugLog)
+	parsed, errs := p.Parse(file)
+	if errs != nil {
+		return deps, failure(errs, "parsing file '"+filepath+"'")
+	}
 
-			chip, err := validators.AutoChooseChipType(chipType, filepath)
-			exitOnError(err, "determining chip-type")
+	err = validators.ValidateCodeLength(file)
+	if err != nil {
+		return deps, failure(err, "validating code")
+	}
 
-			err = validators.ValidateAvailableOperations(parsed, chip)
-			exitOnError(err, "validating code")
+	chip, err := validators.AutoChooseChipType(chipType, filepath)
+	if err != nil {
+		return deps, failure(err, "determining chip-type")
+	}
 
-			fmt.Println(filepath, "is valid")
-		}
-	},
-	Args: cobra.MinimumNArgs(1),
+	err = validators.ValidateAvailableOperations(parsed, chip)
+	if err != nil {
+		return deps, failure(err, "validating code")
+	}
+
+	fmt.Println(filepath, "is valid")
+	return deps, nil
 }
 
 func init() {
 	rootCmd.AddCommand(verifyCmd)
 	verifyCmd.Flags().BoolVarP(&debugLog, "debug", "d", false, "Print debug logs while parsing")
 	verifyCmd.Flags().StringVarP(&chipType, "chip", "c", "auto", "Chip-type to validate for. (auto|professional|advanced|basic)")
+	verifyCmd.Flags().BoolVarP(&watch, "watch", "w", false, "Keep running and re-verify files when they change")
 }
@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// if true, keep watching the input-files and re-run the command when they change
+var watch bool
+
+// watchInterval is the interval in which the watched files are checked for changes
+const watchInterval = 500 * time.Millisecond
+
+// processFunc processes a single input of a command.
+// It returns the files the result depends on and an error if the processing failed
+type processFunc func(input string) ([]string, error)
+
+// runOrWatch calls process for every input. Without --watch, the program exits on the first error.
+// With --watch, it keeps running and re-runs process for every input whose dependencies have changed.
+// command is the name of the command and is used in the status-lines that are printed in watch-mode.
+func runOrWatch(command string, inputs []string, process processFunc) {
+	if !watch {
+		for _, input := range inputs {
+			_, err := process(input)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		}
+		return
+	}
+
+	deps := make([]map[string]time.Time, len(inputs))
+	for i, input := range inputs {
+		deps[i] = runWatched(command, input, process, nil)
+	}
+	fmt.Println("Watching for changes. Press Ctrl+C to stop.")
+	for {
+		time.Sleep(watchInterval)
+		for i, input := range inputs {
+			if changed(deps[i]) {
+				deps[i] = runWatched(command, input, process, deps[i])
+			}
+		}
+	}
+}
+
+// runWatched processes input and prints a status-line
+// Returns the modification-times of the files the input depends on.
+// If processing failed, the previous dependencies are still watched, as the new ones might be incomplete
+func runWatched(command string, input string, process processFunc, previous map[string]time.Time) map[string]time.Time {
+	start := time.Now()
+	files, err := process(input)
+	status := "OK"
+	if err != nil {
+		fmt.Println(err)
+		status = "FAILED"
+	}
+	fmt.Printf("[%s] %s %s: %s (%v)\n", start.Format("15:04:05"), command, input, status, time.Since(start).Round(time.Millisecond))
+
+	deps := map[string]time.Time{
+		input: modTime(input),
+	}
+	for _, file := range files {
+		deps[file] = modTime(file)
+	}
+	if err != nil {
+		for file := range previous {
+			deps[file] = modTime(file)
+		}
+	}
+	return deps
+}
+
+// changed returns true if any of the given files has been modified (or deleted/created) since the given times
+func changed(deps map[string]time.Time) bool {
+	for file, known := range deps {
+		if !modTime(file).Equal(known) {
+			return true
+		}
+	}
+	return false
+}
+
+// modTime returns the modification-time of the given file. Returns the zero time if the file does not exist
+func modTime(file string) time.Time {
+	info, err := os.Stat(file)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
@@ -38,7 +38,7 @@ func runTestfiles(path string, t *testing.T) {
 			if err != nil {
 				t.Fatal(err)
 			}
-			fails := test.Run(nil)
+			fails := test.Run(nil).Fails()
 			if len(fails) != 0 {
 				for _, fail := range fails {
 					t.Log(fail)
@@ -0,0 +1,217 @@
+package coverage
+
+import (
+	"path/filepath"
+	"sort"
+
+	"github.com/dbaumgarten/yodk/pkg/nolol"
+	"github.com/dbaumgarten/yodk/pkg/parser/ast"
+	"github.com/dbaumgarten/yodk/pkg/vm"
+	"github.com/dbaumgarten/yodk/stdlib"
+)
+
+// Profile contains the aggregated execution-counts for the lines of one or more source-files
+type Profile struct {
+	// The profiles of the individual files, indexed by file-name
+	Files map[string]*FileProfile
+}
+
+// FileProfile contains the execution-counts for the lines of a single source-file
+type FileProfile struct {
+	// The name of the file
+	Name string
+	// The number of executions for every executable line of the file (also for lines that have never been executed)
+	Lines map[int]int
+}
+
+// Line is the execution-count of a single line of a file
+type Line struct {
+	File  string
+	Line  int
+	Count int
+}
+
+// NewProfile returns a new, empty profile
+func NewProfile() *Profile {
+	return &Profile{
+		Files: make(map[string]*FileProfile),
+	}
+}
+
+// AddVM adds the execution-counts of the given vm to the profile.
+// file is the name of the script the vm is running. sm is the source-map of the program, if the script is a nolol-script.
+// The execution-counts of the vm are not modified. To prevent counting executions twice, use vm.ResetExecutionCounts()
+func (p *Profile) AddVM(v *vm.VM, file string, sm *nolol.SourceMap) {
+	p.Add(v.GetProgram(), v.GetStatementCounts(), file, sm)
+}
+
+// Add adds the execution-counts for the statements of the given program to the profile.
+// file is the name of the file that contains the program. For nolol-scripts, sm must be the source-map of the program.
+// The counts are then attributed to the lines of the nolol-files (including included files) instead of the yolol-lines.
+func (p *Profile) Add(prog *ast.Program, counts map[ast.Statement]int, file string, sm *nolol.SourceMap) {
+	// a line of a file is executed as often as its most executed statement.
+	// The same line may appear on multiple yolol-lines (e.g. when a macro is inserted multiple times). These are summed up
+	type lineKey struct {
+		astLine int
+		file    string
+		line    int
+	}
+	lines := make(map[lineKey]int)
+
+	// statements inside ifs are statements too. Visit them recursively
+	var addStatements func(astLine int, stmts []ast.Statement)
+	addStatements = func(astLine int, stmts []ast.Statement) {
+		for _, stmt := range stmts {
+			if ifstmt, isIf := stmt.(*ast.IfStatement); isIf {
+				addStatements(astLine, ifstmt.IfBlock)
+				addStatements(astLine, ifstmt.ElseBlock)
+			}
+			if stmt.Start() == ast.UnknownPosition {
+				continue
+			}
+			stmtFile, found := p.fileOfStatement(astLine, stmt, file, sm)
+			if !found {
+				continue
+			}
+			key := lineKey{
+				astLine: astLine,
+				file:    stmtFile,
+				line:    stmt.Start().Line,
+			}
+			if count, exists := lines[key]; !exists || counts[stmt] > count {
+				lines[key] = counts[stmt]
+			}
+		}
+	}
+
+	for i, line := range prog.Lines {
+		addStatements(i+1, line.Statements)
+	}
+
+	for key, count := range lines {
+		fp, exists := p.Files[key.file]
+		if !exists {
+			fp = &FileProfile{
+				Name:  key.file,
+				Lines: make(map[int]int),
+			}
+			p.Files[key.file] = fp
+		}
+		fp.Lines[key.line] += count
+	}
+}
+
+// fileOfStatement returns the name of the file, the given statement originates from
+func (p *Profile) fileOfStatement(astLine int, stmt ast.Statement, file string, sm *nolol.SourceMap) (string, bool) {
+	if sm == nil {
+		return file, stmt.Start().File == ""
+	}
+	mapping, found := sm.Find(astLine, stmt.Start())
+	if !found {
+		return "", false
+	}
+	// the files in the source-map are relative to the compiled file
+	if stdlib.Is(mapping.File) {
+		return mapping.File, true
+	}
+	return filepath.Join(filepath.Dir(file), mapping.File), true
+}
+
+// Merge adds the counts of the other profile to this profile
+func (p *Profile) Merge(other *Profile) {
+	for name, ofp := range other.Files {
+		fp, exists := p.Files[name]
+		if !exists {
+			fp = &FileProfile{
+				Name:  name,
+				Lines: make(map[int]int),
+			}
+			p.Files[name] = fp
+		}
+		for line, count := range ofp.Lines {
+			fp.Lines[line] += count
+		}
+	}
+}
+
+// SortedFiles returns the profiles of all files, sorted by file-name
+func (p *Profile) SortedFiles() []*FileProfile {
+	files := make([]*FileProfile, 0, len(p.Files))
+	for _, fp := range p.Files {
+		files = append(files, fp)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Name < files[j].Name
+	})
+	return files
+}
+
+// HotLines returns the n most executed lines of all files. If n <= 0, all executed lines are returned
+func (p *Profile) HotLines(n int) []Line {
+	lines := make([]Line, 0)
+	for _, fp := range p.Files {
+		for line, count := range fp.Lines {
+			if count > 0 {
+				lines = append(lines, Line{
+					File:  fp.Name,
+					Line:  line,
+					Count: count,
+				})
+			}
+		}
+	}
+	sort.Slice(lines, func(i, j int) bool {
+		if lines[i].Count != lines[j].Count {
+			return lines[i].Count > lines[j].Count
+		}
+		if lines[i].File != lines[j].File {
+			return lines[i].File < lines[j].File
+		}
+		return lines[i].Line < lines[j].Line
+	})
+	if n > 0 && len(lines) > n {
+		lines = lines[:n]
+	}
+	return lines
+}
+
+// Coverage returns the number of executed lines and the total number of executable lines
+func (p *Profile) Coverage() (int, int) {
+	covered := 0
+	total := 0
+	for _, fp := range p.Files {
+		c, t := fp.Coverage()
+		covered += c
+		total += t
+	}
+	return covered, total
+}
+
+// Coverage returns the number of executed lines and the total number of executable lines of the file
+func (f *FileProfile) Coverage() (int, int) {
+	covered := 0
+	for _, count := range f.Lines {
+		if count > 0 {
+			covered++
+		}
+	}
+	return covered, len(f.Lines)
+}
+
+// SortedLines returns the numbers of all executable lines of the file in ascending order
+func (f *FileProfile) SortedLines() []int {
+	lines := make([]int, 0, len(f.Lines))
+	for line := range f.Lines {
+		lines = append(lines, line)
+	}
+	sort.Ints(lines)
+	return lines
+}
+
+// percentage returns covered/total in percent. If total is 0, 100% is returned
+func percentage(covered int, total int) float64 {
+	if total == 0 {
+		return 100
+	}
+	return float64(covered) / float64(total) * 100
+}
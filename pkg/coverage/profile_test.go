@@ -0,0 +1,60 @@
+package coverage_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/dbaumgarten/yodk/pkg/coverage"
+	"github.com/dbaumgarten/yodk/pkg/vm"
+)
+
+func TestProfile(t *testing.T) {
+	prog := "a=0\na++ if a<3 then goto 2 end\nif a>10 then b=1 end\n\n:done=1"
+	v, _ := vm.CreateFromSource(prog)
+	v.SetMaxExecutedLines(6)
+	v.Resume()
+	v.WaitForTermination()
+
+	profile := coverage.NewProfile()
+	profile.AddVM(v, "test.yolol", nil)
+	profile.AddVM(v, "test.yolol", nil)
+
+	fp := profile.Files["test.yolol"]
+	if fp == nil {
+		t.Fatal("The file is missing in the profile")
+	}
+	expected := map[int]int{
+		1: 2,
+		2: 6,
+		3: 2,
+		5: 2,
+	}
+	if len(fp.Lines) != len(expected) {
+		t.Fatalf("Wrong executable lines: %v", fp.Lines)
+	}
+	for line, count := range expected {
+		if fp.Lines[line] != count {
+			t.Fatalf("Line %d should have been executed %d times, but got %d", line, count, fp.Lines[line])
+		}
+	}
+
+	hot := profile.HotLines(1)
+	if len(hot) != 1 || hot[0].Line != 2 {
+		t.Fatalf("Wrong hottest line: %v", hot)
+	}
+
+	lcov := &bytes.Buffer{}
+	profile.WriteLCOV(lcov)
+	if !strings.Contains(lcov.String(), "SF:test.yolol\nDA:1,2\nDA:2,6\n") || !strings.Contains(lcov.String(), "LH:4\nLF:4\n") {
+		t.Fatalf("Wrong lcov-output: %s", lcov.String())
+	}
+
+	v.ResetExecutionCounts()
+	profile = coverage.NewProfile()
+	profile.AddVM(v, "test.yolol", nil)
+	covered, total := profile.Coverage()
+	if covered != 0 || total != 4 {
+		t.Fatalf("Wrong coverage after reset: %d/%d", covered, total)
+	}
+}
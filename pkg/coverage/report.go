@@ -0,0 +1,137 @@
+package coverage
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+)
+
+// SourceFunc returns the content of the source-file with the given name
+type SourceFunc func(name string) (string, error)
+
+// WriteSummary writes a human-readable summary of the coverage of every file to w
+func (p *Profile) WriteSummary(w io.Writer) error {
+	for _, fp := range p.SortedFiles() {
+		covered, total := fp.Coverage()
+		_, err := fmt.Fprintf(w, "%s: %s\n", fp.Name, formatCoverage(covered, total))
+		if err != nil {
+			return err
+		}
+	}
+	covered, total := p.Coverage()
+	_, err := fmt.Fprintf(w, "Total: %s\n", formatCoverage(covered, total))
+	return err
+}
+
+// WriteLCOV writes the profile in the LCOV tracefile-format to w
+// This format is understood by most coverage-tools (genhtml, coverage-gutters etc.)
+func (p *Profile) WriteLCOV(w io.Writer) error {
+	for _, fp := range p.SortedFiles() {
+		lines := []string{
+			"TN:",
+			"SF:" + fp.Name,
+		}
+		for _, line := range fp.SortedLines() {
+			lines = append(lines, fmt.Sprintf("DA:%d,%d", line, fp.Lines[line]))
+		}
+		covered, total := fp.Coverage()
+		lines = append(lines, fmt.Sprintf("LH:%d", covered), fmt.Sprintf("LF:%d", total), "end_of_record")
+		_, err := io.WriteString(w, strings.Join(lines, "\n")+"\n")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// htmlLine is a single line of a file in the html-report
+type htmlLine struct {
+	Number int
+	Code   string
+	// empty for lines that contain no executable code
+	Count string
+	// css-class of the line
+	Class string
+}
+
+// htmlFile is a single file in the html-report
+type htmlFile struct {
+	Name     string
+	Coverage string
+	Lines    []htmlLine
+}
+
+var htmlTemplate = template.Must(template.New("coverage").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Coverage report</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; font-family: monospace; }
+td { padding: 0 8px; white-space: pre; }
+td.number, td.count { text-align: right; color: #666; }
+tr.covered { background-color: #d4f7d4; }
+tr.uncovered { background-color: #f7d4d4; }
+</style>
+</head>
+<body>
+<h1>Coverage report</h1>
+<p>Total: {{.Coverage}}</p>
+<ul>
+{{range $i, $f := .Files}}<li><a href="#file{{$i}}">{{$f.Name}}</a>: {{$f.Coverage}}</li>
+{{end}}</ul>
+{{range $i, $f := .Files}}<h2 id="file{{$i}}">{{$f.Name}}</h2>
+<p>{{$f.Coverage}}</p>
+<table>
+{{range $f.Lines}}<tr class="{{.Class}}"><td class="number">{{.Number}}</td><td class="count">{{.Count}}</td><td>{{.Code}}</td></tr>
+{{end}}</table>
+{{end}}</body>
+</html>
+`))
+
+// WriteHTML writes a html-page to w, that shows the source-code of all files annotated with the execution-counts
+// source is used to retrieve the content of the files
+func (p *Profile) WriteHTML(w io.Writer, source SourceFunc) error {
+	files := make([]htmlFile, 0, len(p.Files))
+	for _, fp := range p.SortedFiles() {
+		content, err := source(fp.Name)
+		if err != nil {
+			return err
+		}
+		covered, total := fp.Coverage()
+		file := htmlFile{
+			Name:     fp.Name,
+			Coverage: formatCoverage(covered, total),
+		}
+		for i, code := range strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n") {
+			line := htmlLine{
+				Number: i + 1,
+				Code:   code,
+			}
+			if count, executable := fp.Lines[i+1]; executable {
+				line.Count = fmt.Sprintf("%dx", count)
+				line.Class = "uncovered"
+				if count > 0 {
+					line.Class = "covered"
+				}
+			}
+			file.Lines = append(file.Lines, line)
+		}
+		files = append(files, file)
+	}
+	covered, total := p.Coverage()
+	return htmlTemplate.Execute(w, struct {
+		Coverage string
+		Files    []htmlFile
+	}{
+		Coverage: formatCoverage(covered, total),
+		Files:    files,
+	})
+}
+
+// formatCoverage returns a human-readable representation of the coverage
+func formatCoverage(covered int, total int) string {
+	return fmt.Sprintf("%d of %d lines executed (%.1f%%)", covered, total, percentage(covered, total))
+}
@@ -1,6 +1,7 @@
 package debug
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
@@ -9,6 +10,7 @@ import (
 	"regexp"
 	"runtime"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -16,9 +18,14 @@ import (
 	"github.com/google/go-dap"
 )
 
+// the variables-reference for the global variables of a script is globalVarsReference + the frame-id of the script
+// this way the globals are shown as seen by the script (the script may be connected to different networks)
 var globalVarsReference = 10000
 var convertedCodeOffset = 10000
 
+// number of executed lines per script that can be undone using reverse-debugging
+var historySize = 1000
+
 // YODKHandler implements the handler-functions for a debug-session
 type YODKHandler struct {
 	session         *Session
@@ -36,14 +43,14 @@ func (h *YODKHandler) OnInitializeRequest(arguments *dap.InitializeRequestArgume
 	response := &dap.Capabilities{
 		SupportsConfigurationDoneRequest:   true,
 		SupportsFunctionBreakpoints:        false,
-		SupportsConditionalBreakpoints:     false,
-		SupportsHitConditionalBreakpoints:  false,
-		SupportsEvaluateForHovers:          false,
+		SupportsConditionalBreakpoints:     true,
+		SupportsHitConditionalBreakpoints:  true,
+		SupportsEvaluateForHovers:          true,
 		ExceptionBreakpointFilters:         []dap.ExceptionBreakpointsFilter{},
-		SupportsStepBack:                   false,
+		SupportsStepBack:                   true,
 		SupportsSetVariable:                true,
-		SupportsRestartFrame:               false,
-		SupportsGotoTargetsRequest:         false,
+		SupportsRestartFrame:               true,
+		SupportsGotoTargetsRequest:         true,
 		SupportsStepInTargetsRequest:       false,
 		SupportsCompletionsRequest:         false,
 		CompletionTriggerCharacters:        []string{},
@@ -57,11 +64,11 @@ func (h *YODKHandler) OnInitializeRequest(arguments *dap.InitializeRequestArgume
 		SupportTerminateDebuggee:           true,
 		SupportsDelayedStackTraceLoading:   false,
 		SupportsLoadedSourcesRequest:       true,
-		SupportsLogPoints:                  false,
+		SupportsLogPoints:                  true,
 		SupportsTerminateThreadsRequest:    false,
 		SupportsSetExpression:              false,
 		SupportsTerminateRequest:           true,
-		SupportsDataBreakpoints:            false,
+		SupportsDataBreakpoints:            true,
 		SupportsReadMemoryRequest:          false,
 		SupportsDisassembleRequest:         false,
 		SupportsCancelRequest:              false,
@@ -115,12 +122,31 @@ func (h *YODKHandler) helperFromArguments(arguments map[string]interface{}) (*He
 			}
 		}
 
+		var networks map[string][]string
+		if networksfield, exists := arguments["networks"]; exists {
+			err := convertArgument(networksfield, &networks)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid value for 'networks': %s", err.Error())
+			}
+		}
+		var relays []vm.Relay
+		if relaysfield, exists := arguments["relays"]; exists {
+			err := convertArgument(relaysfield, &relays)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid value for 'relays': %s", err.Error())
+			}
+		}
+		err := helper.ConfigureNetworks(networks, relays)
+		if err != nil {
+			return nil, err
+		}
+
 		if errsfield, exists := arguments["ignoreErrs"]; exists {
 			if ignoreErrs, is := errsfield.(bool); is {
 				helper.IgnoreErrs = ignoreErrs
 			}
 		}
-		return helper, nil
+		return helper, configureClock(helper, arguments)
 
 	} else if testfield, exists := arguments["test"]; exists {
 		tcase := 1
@@ -133,12 +159,45 @@ func (h *YODKHandler) helperFromArguments(arguments map[string]interface{}) (*He
 			}
 		}
 		if test, is := testfield.(string); is {
-			return FromTest(ws, test, tcase, h.configureVM)
+			helper, err := FromTest(ws, test, tcase, h.configureVM)
+			if err != nil {
+				return nil, err
+			}
+			return helper, configureClock(helper, arguments)
 		}
 	}
 	return nil, errors.New("Debug-config must contain 'scripts' or 'test' field")
 }
 
+// configureClock enables the realtime-mode of the coordinator, if requested by the launch-arguments
+func configureClock(helper *Helper, arguments map[string]interface{}) error {
+	if realtimefield, exists := arguments["realtime"]; !exists || realtimefield != true {
+		return nil
+	}
+	interval := vm.DefaultTickInterval
+	if intervalfield, exists := arguments["tickInterval"]; exists {
+		if ms, is := intervalfield.(float64); is {
+			interval = time.Duration(ms * float64(time.Millisecond))
+		}
+	}
+	helper.Coordinator.SetTickInterval(interval)
+	if speedfield, exists := arguments["speed"]; exists {
+		if speed, is := speedfield.(float64); is {
+			return helper.Coordinator.SetSpeed(speed)
+		}
+	}
+	return nil
+}
+
+// convertArgument converts a (json-decoded) launch-argument to the type of target
+func convertArgument(argument interface{}, target interface{}) error {
+	encoded, err := json.Marshal(argument)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(encoded, target)
+}
+
 func resolveGlobs(workdir string, filenames []string) ([]string, error) {
 	resolved := make([]string, 0, len(filenames)*2)
 	for _, pattern := range filenames {
@@ -160,6 +219,7 @@ func resolveGlobs(workdir string, filenames []string) ([]string, error) {
 }
 
 func (h *YODKHandler) configureVM(yvm *vm.VM, filename string) {
+	yvm.SetHistorySize(historySize)
 	yvm.SetBreakpointHandler(func(x *vm.VM) bool {
 		h.session.SendEvent(&dap.StoppedEvent{
 			Body: dap.StoppedEventBody{
@@ -170,6 +230,38 @@ func (h *YODKHandler) configureVM(yvm *vm.VM, filename string) {
 		})
 		return false
 	})
+	yvm.SetLogpointHandler(func(x *vm.VM, bp vm.Breakpoint, message string) {
+		h.session.SendEvent(&dap.OutputEvent{
+			Body: dap.OutputEventBody{
+				Category: "console",
+				Output:   message + "\n",
+				Source: dap.Source{
+					Path: JoinPath(h.helper.Worspace, filename),
+				},
+				Line: bp.Line,
+			},
+		})
+	})
+	yvm.SetWatchpointHandler(func(x *vm.VM, wp vm.Watchpoint, old *vm.Variable, new *vm.Variable) bool {
+		vmidx := h.helper.ScriptIndexByName(filename)
+		name := wp.Variable
+		if !wp.IsGlobal() && h.helper.VariableTranslations[vmidx] != nil {
+			name = h.helper.VariableTranslations[vmidx][name]
+		}
+		text := fmt.Sprintf("%s = %s", name, new.Repr())
+		if old != nil {
+			text = fmt.Sprintf("%s: %s -> %s", name, old.Repr(), new.Repr())
+		}
+		h.session.SendEvent(&dap.StoppedEvent{
+			Body: dap.StoppedEventBody{
+				Reason:      "data breakpoint",
+				Description: "Data breakpoint on " + name + " triggered",
+				ThreadId:    vmidx + 1,
+				Text:        text,
+			},
+		})
+		return false
+	})
 	yvm.SetErrorHandler(func(x *vm.VM, err error) bool {
 		if !h.helper.IgnoreErrs {
 			h.session.SendEvent(&dap.StoppedEvent{
@@ -177,7 +269,7 @@ func (h *YODKHandler) configureVM(yvm *vm.VM, filename string) {
 					Reason:      "exception",
 					Description: "A runtim-error occured",
 					ThreadId:    h.helper.ScriptIndexByName(filename) + 1,
-					Text:        err.Error(),
+					Text:        h.helper.LocateError(h.helper.ScriptIndexByName(filename), err).Error(),
 				},
 			})
 			return false
@@ -289,31 +381,38 @@ func (h *YODKHandler) OnSetBreakpointsRequest(arguments *dap.SetBreakpointsArgum
 	}
 	vm := h.helper.Vms[idx]
 
+	// older clients only send the lines of the breakpoints
+	breakpoints := arguments.Breakpoints
+	if breakpoints == nil {
+		breakpoints = make([]dap.SourceBreakpoint, len(arguments.Lines))
+		for i, line := range arguments.Lines {
+			breakpoints[i].Line = line
+		}
+	}
+
 	resp := &dap.SetBreakpointsResponseBody{
-		Breakpoints: make([]dap.Breakpoint, len(arguments.Lines)),
+		Breakpoints: make([]dap.Breakpoint, len(breakpoints)),
 	}
 
 	for _, bp := range vm.ListBreakpoints() {
 		vm.RemoveBreakpoint(bp)
 	}
 
-	for i, bp := range arguments.Lines {
-		// if there is a table of valid breakpoints, use it to verify the breakpoint
-		if h.helper.ValidBreakpoints[idx] != nil {
-			if _, isValid := h.helper.ValidBreakpoints[idx][bp]; !isValid {
-				i--
-				continue
-			}
-		}
-		vm.AddBreakpoint(bp)
+	for i, sbp := range breakpoints {
 		resp.Breakpoints[i] = dap.Breakpoint{
-			Line:     bp,
-			Verified: true,
+			Line: sbp.Line,
 			Source: dap.Source{
 				Name: arguments.Source.Name,
 				Path: arguments.Source.Path,
 			},
 		}
+		bp, err := h.helper.NewBreakpoint(idx, sbp.Line, sbp.Condition, sbp.HitCondition, sbp.LogMessage)
+		if err != nil {
+			resp.Breakpoints[i].Message = err.Error()
+			continue
+		}
+		vm.SetBreakpoint(bp)
+		resp.Breakpoints[i].Verified = true
 	}
 
 	return resp, nil
@@ -381,22 +480,39 @@ func (h *YODKHandler) OnStepOutRequest(arguments *dap.StepOutArguments) error {
 
 // OnStepBackRequest implements the Handler interface
 func (h *YODKHandler) OnStepBackRequest(arguments *dap.StepBackArguments) error {
-	return ErrNotImplemented
+	if h.accessingFinishedVM(arguments.ThreadId) {
+		return nil
+	}
+	// the vm.StepHandler will send the event
+	return h.helper.Vms[arguments.ThreadId-1].StepBack()
 }
 
 // OnReverseContinueRequest implements the Handler interface
 func (h *YODKHandler) OnReverseContinueRequest(arguments *dap.ReverseContinueArguments) error {
-	return ErrNotImplemented
+	if h.accessingFinishedVM(arguments.ThreadId) {
+		return nil
+	}
+	// the vm.StepHandler will send the event
+	return h.helper.Vms[arguments.ThreadId-1].ReverseContinue()
 }
 
 // OnRestartFrameRequest implements the Handler interface
 func (h *YODKHandler) OnRestartFrameRequest(arguments *dap.RestartFrameArguments) error {
-	return ErrNotImplemented
+	// the frame-id is identical to the thread-id
+	if h.accessingFinishedVM(arguments.FrameId) {
+		return nil
+	}
+	// the vm.StepHandler will send the event
+	return h.helper.Vms[arguments.FrameId-1].RestartLine()
 }
 
 // OnGotoRequest implements the Handler interface
+// The id of a goto-target is the source-line of the target
 func (h *YODKHandler) OnGotoRequest(arguments *dap.GotoArguments) error {
-	return ErrNotImplemented
+	if h.accessingFinishedVM(arguments.ThreadId) {
+		return nil
+	}
+	return h.helper.Vms[arguments.ThreadId-1].SetNextLine(arguments.TargetId)
 }
 
 // OnPauseRequest implements the Handler interface
@@ -414,19 +530,52 @@ func (h *YODKHandler) OnPauseRequest(arguments *dap.PauseArguments) error {
 
 // OnStackTraceRequest implements the Handler interface
 func (h *YODKHandler) OnStackTraceRequest(arguments *dap.StackTraceArguments) (*dap.StackTraceResponseBody, error) {
-	resp := &dap.StackTraceResponseBody{
-		StackFrames: []dap.StackFrame{
-			{
+	vmidx := arguments.ThreadId - 1
+	scriptPath := JoinPath(h.helper.Worspace, h.helper.ScriptNames[vmidx])
+	frames := []dap.StackFrame{
+		{
+			Id:     arguments.ThreadId,
+			Name:   h.helper.ScriptNames[vmidx],
+			Line:   h.helper.Vms[vmidx].CurrentSourceLine(),
+			Column: 0,
+			Source: dap.Source{
+				Path: scriptPath,
+			},
+		},
+	}
+
+	// for nolol-code show the actual location of the statement and the macro-insertions leading to it
+	// every inserted macro is shown like a called function
+	if origin, found := h.helper.CurrentOrigin(vmidx); found {
+		sourcePath := func(file string) string {
+			return filepath.Join(filepath.Dir(scriptPath), file)
+		}
+		frameName := func(macroLevel int) string {
+			if macroLevel < len(origin.Macros) {
+				return "macro " + origin.Macros[macroLevel].Macro
+			}
+			return h.helper.ScriptNames[vmidx]
+		}
+		frames[0].Name = frameName(0)
+		frames[0].Line = origin.Line
+		frames[0].Column = origin.Column
+		frames[0].Source.Path = sourcePath(origin.File)
+		for i, macro := range origin.Macros {
+			frames = append(frames, dap.StackFrame{
 				Id:     arguments.ThreadId,
-				Name:   h.helper.ScriptNames[arguments.ThreadId-1],
-				Line:   h.helper.Vms[arguments.ThreadId-1].CurrentSourceLine(),
-				Column: 0,
+				Name:   frameName(i + 1),
+				Line:   macro.Line,
+				Column: macro.Column,
 				Source: dap.Source{
-					Path: JoinPath(h.helper.Worspace, h.helper.ScriptNames[arguments.ThreadId-1]),
+					Path: sourcePath(macro.File),
 				},
-			},
-		},
-		TotalFrames: 1,
+			})
+		}
+	}
+
+	resp := &dap.StackTraceResponseBody{
+		StackFrames: frames,
+		TotalFrames: len(frames),
 	}
 	return resp, nil
 }
@@ -443,7 +592,7 @@ func (h *YODKHandler) OnScopesRequest(arguments *dap.ScopesArguments) (*dap.Scop
 			{
 				Name:               "Global variables",
 				PresentationHint:   "globals",
-				VariablesReference: globalVarsReference,
+				VariablesReference: globalVarsReference + arguments.FrameId,
 			},
 		},
 	}, nil
@@ -455,9 +604,10 @@ func (h *YODKHandler) OnVariablesRequest(arguments *dap.VariablesArguments) (*da
 	var definedVars []string
 
 	// find the variables to list
-	if arguments.VariablesReference == globalVarsReference {
+	isGlobal := arguments.VariablesReference > globalVarsReference
+	if isGlobal {
 		definedVars = h.helper.GlobalVars
-		vars = h.helper.Coordinator.GetVariables()
+		vars = h.helper.Vms[arguments.VariablesReference-globalVarsReference-1].GetVariables()
 	} else {
 		definedVars = h.helper.LocalVars[arguments.VariablesReference-1]
 		vars = h.helper.Vms[arguments.VariablesReference-1].GetVariables()
@@ -476,7 +626,7 @@ func (h *YODKHandler) OnVariablesRequest(arguments *dap.VariablesArguments) (*da
 		}
 
 		// if there are translations for local variables available, use them to retrieve the original var name
-		if arguments.VariablesReference != globalVarsReference && h.helper.VariableTranslations[arguments.VariablesReference-1] != nil {
+		if !isGlobal && h.helper.VariableTranslations[arguments.VariablesReference-1] != nil {
 			outvar.Name = h.helper.VariableTranslations[arguments.VariablesReference-1][outvar.Name]
 		}
 
@@ -508,8 +658,8 @@ func sortVariableList(vars []dap.Variable) {
 func (h *YODKHandler) OnSetVariableRequest(arguments *dap.SetVariableArguments) (*dap.SetVariableResponseBody, error) {
 	name := arguments.Name
 	value := vm.VariableFromString(arguments.Value)
-	if arguments.VariablesReference == globalVarsReference {
-		h.helper.Coordinator.SetVariable(name, value)
+	if arguments.VariablesReference > globalVarsReference {
+		h.helper.Vms[arguments.VariablesReference-globalVarsReference-1].SetVariable(name, value)
 	} else {
 		// the variable has been renamed by the compiler (and has been un-renamed in the debug view).
 		// re-rename it when setting
@@ -570,7 +720,28 @@ func (h *YODKHandler) OnTerminateThreadsRequest(arguments *dap.TerminateThreadsA
 
 // OnEvaluateRequest implements the Handler interface
 func (h *YODKHandler) OnEvaluateRequest(arguments *dap.EvaluateArguments) (*dap.EvaluateResponseBody, error) {
-	return nil, ErrNotImplemented
+	// the id of a frame is the id of its thread
+	vmidx := arguments.FrameId - 1
+	if vmidx < 0 || vmidx >= len(h.helper.Vms) {
+		return nil, errors.New("Expressions can only be evaluated in the context of a script")
+	}
+	// statements (like assignments) are only executed when entered into the debug-console
+	result, err := h.helper.Evaluate(vmidx, arguments.Expression, arguments.Context == "repl")
+	if err != nil {
+		return nil, err
+	}
+	resp := &dap.EvaluateResponseBody{}
+	if result == nil {
+		return resp, nil
+	}
+	if result.IsNumber() {
+		resp.Type = "number"
+		resp.Result = result.Itoa()
+	} else {
+		resp.Type = "string"
+		resp.Result = result.Repr()
+	}
+	return resp, nil
 }
 
 // OnStepInTargetsRequest implements the Handler interface
@@ -580,7 +751,21 @@ func (h *YODKHandler) OnStepInTargetsRequest(arguments *dap.StepInTargetsArgumen
 
 // OnGotoTargetsRequest implements the Handler interface
 func (h *YODKHandler) OnGotoTargetsRequest(arguments *dap.GotoTargetsArguments) (*dap.GotoTargetsResponseBody, error) {
-	return nil, ErrNotImplemented
+	idx := h.helper.ScriptIndexByPath(arguments.Source.Path)
+	if idx == -1 {
+		return nil, errors.New("Source not found")
+	}
+	resp := &dap.GotoTargetsResponseBody{
+		Targets: []dap.GotoTarget{},
+	}
+	if isIn(arguments.Line, h.helper.Vms[idx].ListJumpTargets()) {
+		resp.Targets = append(resp.Targets, dap.GotoTarget{
+			Id:    arguments.Line,
+			Label: fmt.Sprintf("Line %d", arguments.Line),
+			Line:  arguments.Line,
+		})
+	}
+	return resp, nil
 }
 
 // OnCompletionsRequest implements the Handler interface
@@ -616,13 +801,82 @@ func (h *YODKHandler) OnLoadedSourcesRequest(arguments *dap.LoadedSourcesArgumen
 }
 
 // OnDataBreakpointInfoRequest implements the Handler interface
+// The data-id of a global variable is the name of the variable (starting with ':').
+// The data-id of a local variable is <index of vm>:<name>
 func (h *YODKHandler) OnDataBreakpointInfoRequest(arguments *dap.DataBreakpointInfoArguments) (*dap.DataBreakpointInfoResponseBody, error) {
-	return nil, ErrNotImplemented
+	name := strings.ToLower(arguments.Name)
+	resp := &dap.DataBreakpointInfoResponseBody{
+		Description: arguments.Name,
+		AccessTypes: []dap.DataBreakpointAccessType{vm.WatchRead, vm.WatchWrite, vm.WatchReadWrite},
+		CanPersist:  true,
+	}
+	if arguments.VariablesReference > globalVarsReference {
+		resp.DataId = name
+		return resp, nil
+	}
+	vmidx := arguments.VariablesReference - 1
+	if vmidx < 0 || vmidx >= len(h.helper.Vms) {
+		resp.DataId = nil
+		resp.Description = "Data breakpoints can only be set on variables"
+		return resp, nil
+	}
+	// watchpoints work on the compiled name of the variable
+	if h.helper.VariableTranslations[vmidx] != nil {
+		name = h.helper.ReverseVarnameTranslation(vmidx, arguments.Name)
+	}
+	resp.DataId = fmt.Sprintf("%d:%s", vmidx, name)
+	return resp, nil
 }
 
 // OnSetDataBreakpointsRequest implements the Handler interface
 func (h *YODKHandler) OnSetDataBreakpointsRequest(arguments *dap.SetDataBreakpointsArguments) (*dap.SetDataBreakpointsResponseBody, error) {
-	return nil, ErrNotImplemented
+	h.helper.Coordinator.ClearWatchpoints()
+	for _, v := range h.helper.Vms {
+		v.ClearWatchpoints()
+	}
+
+	resp := &dap.SetDataBreakpointsResponseBody{
+		Breakpoints: make([]dap.Breakpoint, len(arguments.Breakpoints)),
+	}
+	for i, bp := range arguments.Breakpoints {
+		err := h.addDataBreakpoint(bp)
+		resp.Breakpoints[i].Verified = err == nil
+		if err != nil {
+			resp.Breakpoints[i].Message = err.Error()
+		}
+	}
+	return resp, nil
+}
+
+// addDataBreakpoint adds a watchpoint for the given data-breakpoint to the vm or coordinator the data-id refers to
+func (h *YODKHandler) addDataBreakpoint(bp dap.DataBreakpoint) error {
+	typ := string(bp.AccessType)
+	if typ == "" {
+		typ = vm.WatchWrite
+	}
+
+	if strings.HasPrefix(bp.DataId, ":") {
+		wp, err := vm.NewWatchpoint(bp.DataId, typ, bp.Condition)
+		if err != nil {
+			return err
+		}
+		return h.helper.Coordinator.AddWatchpoint(wp)
+	}
+
+	parts := strings.SplitN(bp.DataId, ":", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("Invalid data-id: %s", bp.DataId)
+	}
+	vmidx, err := strconv.Atoi(parts[0])
+	if err != nil || vmidx < 0 || vmidx >= len(h.helper.Vms) {
+		return fmt.Errorf("Invalid data-id: %s", bp.DataId)
+	}
+	wp, err := vm.NewWatchpoint(parts[1], typ, bp.Condition)
+	if err != nil {
+		return err
+	}
+	h.helper.Vms[vmidx].AddWatchpoint(wp)
+	return nil
 }
 
 // OnReadMemoryRequest implements the Handler interface
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/dbaumgarten/yodk/pkg/nolol"
@@ -29,6 +30,9 @@ type Helper struct {
 	// list of variable translations for the VMs
 	// used to undo variable shortening performed by nolol using compilation
 	VariableTranslations []map[string]string
+	// list of source-maps for the VMs. Used to find the location of the running code inside the nolol-source
+	// nil for VMs that are running yolol-code
+	SourceMaps []*nolol.SourceMap
 	// number of the case in the given test to execute
 	CaseNumber int
 	// a folder all script paths are relative to
@@ -90,6 +94,95 @@ func (h Helper) ReverseVarnameTranslation(vmidx int, search string) string {
 	return ""
 }
 
+// NewBreakpoint creates a breakpoint for the script with the given index and checks if the line is a valid breakpoint-location.
+// The variables in the condition and the log-message refer to the variables of the source-code of the script
+func (h Helper) NewBreakpoint(vmidx int, line int, condition string, hitCondition string, logMessage string) (vm.Breakpoint, error) {
+	if validBps, exists := h.ValidBreakpoints[vmidx]; exists {
+		if _, isValid := validBps[line]; !isValid {
+			return vm.Breakpoint{}, fmt.Errorf("You can not set a breakpoint at this line")
+		}
+	}
+	bp, err := vm.NewBreakpoint(line, condition, hitCondition, logMessage)
+	if err != nil {
+		return bp, err
+	}
+	if h.VariableTranslations[vmidx] != nil {
+		bp.TranslateVariables(func(name string) string {
+			return h.translateVarname(vmidx, name)
+		})
+	}
+	return bp, nil
+}
+
+// Evaluate evaluates the given yolol-expression in the context of the script with the given index and returns the result.
+// If allowStatements is true, code that is not an expression is executed as yolol-statements (and nil is returned).
+// The variables in the code refer to the variables of the source-code of the script
+func (h Helper) Evaluate(vmidx int, code string, allowStatements bool) (*vm.Variable, error) {
+	expr, err := parser.NewParser().ParseExpressionString(code)
+	if err == nil {
+		h.translateVariables(vmidx, expr)
+		return h.Vms[vmidx].Evaluate(expr)
+	}
+	if !allowStatements {
+		return nil, err
+	}
+
+	prog, err := parser.NewParser().Parse(code)
+	if err != nil {
+		return nil, err
+	}
+	h.translateVariables(vmidx, prog)
+	for _, line := range prog.Lines {
+		err = h.Vms[vmidx].Execute(line.Statements)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+// translateVariables replaces the source-names of all variables in the given node by their compiled names
+func (h Helper) translateVariables(vmidx int, node ast.Node) {
+	if h.VariableTranslations[vmidx] == nil {
+		return
+	}
+	node.Accept(ast.VisitorFunc(func(node ast.Node, visitType int) error {
+		switch n := node.(type) {
+		case *ast.Dereference:
+			n.Variable = h.translateVarname(vmidx, n.Variable)
+		case *ast.Assignment:
+			n.Variable = h.translateVarname(vmidx, n.Variable)
+		}
+		return nil
+	}))
+}
+
+// translateVarname returns the compiled name of the given variable. Variables without translation keep their name
+func (h Helper) translateVarname(vmidx int, name string) string {
+	if translated := h.ReverseVarnameTranslation(vmidx, name); translated != "" {
+		return translated
+	}
+	return name
+}
+
+// CurrentOrigin returns the location of the current statement of the given vm inside the nolol-source
+// Returns false if the vm is not running nolol-code or the location is unknown
+func (h Helper) CurrentOrigin(vmidx int) (nolol.SourceMapping, bool) {
+	if vmidx < 0 || vmidx >= len(h.SourceMaps) || h.SourceMaps[vmidx] == nil {
+		return nolol.SourceMapping{}, false
+	}
+	v := h.Vms[vmidx]
+	return h.SourceMaps[vmidx].Find(v.CurrentAstLine(), v.CurrentStatementPosition())
+}
+
+// LocateError replaces the position of a runtime-error of the given vm with the location inside the nolol-source
+func (h Helper) LocateError(vmidx int, err error) error {
+	if vmidx < 0 || vmidx >= len(h.SourceMaps) {
+		return err
+	}
+	return testing.LocateError(h.SourceMaps[vmidx], h.Vms[vmidx].LastAstLine(), err)
+}
+
 // CurrentVM returns the currently selected VM (only used in cli-debugger)
 func (h Helper) CurrentVM() *vm.VM {
 	return h.Vms[h.CurrentScript]
@@ -105,6 +198,7 @@ func FromScripts(workspace string, scripts []string, prepareVM VMPrepareFunc) (*
 		ScriptNames:          scripts,
 		Scripts:              make([]string, len(scripts)),
 		VariableTranslations: make([]map[string]string, len(scripts)),
+		SourceMaps:           make([]*nolol.SourceMap, len(scripts)),
 		Vms:                  make([]*vm.VM, len(scripts)),
 		CurrentScript:        0,
 		Coordinator:          vm.NewCoordinator(),
@@ -139,6 +233,7 @@ func FromScripts(workspace string, scripts []string, prepareVM VMPrepareFunc) (*
 			}
 			h.ValidBreakpoints[i] = findValidBreakpoints(yololcode)
 			h.VariableTranslations[i] = converter.GetVariableTranslations()
+			h.SourceMaps[i] = converter.GetSourceMap()
 			pri := parser.Printer{
 				Mode: parser.PrintermodeReadable,
 			}
@@ -159,6 +254,39 @@ func FromScripts(workspace string, scripts []string, prepareVM VMPrepareFunc) (*
 	return h, nil
 }
 
+// ConfigureNetworks connects the scripts to the given networks and adds the given relays to the coordinator
+// networks maps network-names to the names of the scripts connected to the network.
+// A script that is listed in multiple networks is connected to them in alphabetical order of the networks (like in tests).
+// Scripts that are not listed in any network stay connected to the default network
+func (h *Helper) ConfigureNetworks(networks map[string][]string, relays []vm.Relay) error {
+	networkNames := make([]string, 0, len(networks))
+	for network := range networks {
+		networkNames = append(networkNames, network)
+	}
+	// sort, to make the order of networks deterministic
+	sort.Strings(networkNames)
+	scriptNetworks := make(map[int][]string)
+	for _, network := range networkNames {
+		for _, script := range networks[network] {
+			idx := h.ScriptIndexByName(script)
+			if idx < 0 {
+				return fmt.Errorf("Network '%s' contains the script '%s', which is not being debugged", network, script)
+			}
+			scriptNetworks[idx] = append(scriptNetworks[idx], network)
+		}
+	}
+	for idx, nets := range scriptNetworks {
+		h.Vms[idx].SetNetworks(nets...)
+	}
+	for _, relay := range relays {
+		err := h.Coordinator.AddRelay(relay)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // FromTest creates a Helper from the given test-file
 func FromTest(workspace string, testfile string, casenr int, prepareVM VMPrepareFunc) (*Helper, error) {
 	testfile = JoinPath(workspace, testfile)
@@ -208,6 +336,7 @@ func FromTest(workspace string, testfile string, casenr int, prepareVM VMPrepare
 	h.Vms = runner.VMs
 	h.Coordinator = runner.Coordinator
 	h.VariableTranslations = runner.VarTranslations
+	h.SourceMaps = runner.SourceMaps
 
 	for i, iv := range h.Vms {
 		prepareVM(iv, h.ScriptNames[i])
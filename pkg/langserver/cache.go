@@ -6,6 +6,7 @@ import (
 
 	"github.com/dbaumgarten/yodk/pkg/lsp"
 	"github.com/dbaumgarten/yodk/pkg/nolol"
+	"github.com/dbaumgarten/yodk/pkg/nolol/nast"
 )
 
 var NotFoundError = fmt.Errorf("File not found in cache")
@@ -20,6 +21,10 @@ type Cache struct {
 type DiagnosticResults struct {
 	Variables      []string
 	AnalysisReport *nolol.AnalysisReport
+	// the nolol-program with all includes resolved
+	Program *nast.Program
+	// maps the names of included files (as used in the positions of Program) to the file-names relative to the including file
+	Includes map[string]string
 }
 
 func NewCache() *Cache {
@@ -0,0 +1,431 @@
+package langserver
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dbaumgarten/yodk/pkg/jsonrpc2"
+	"github.com/dbaumgarten/yodk/pkg/lsp"
+	"github.com/dbaumgarten/yodk/pkg/nolol"
+	"github.com/dbaumgarten/yodk/pkg/nolol/nast"
+	"github.com/dbaumgarten/yodk/pkg/optimizers"
+	"github.com/dbaumgarten/yodk/pkg/parser"
+	"github.com/dbaumgarten/yodk/pkg/parser/ast"
+	"github.com/dbaumgarten/yodk/stdlib"
+)
+
+// compileCommand is the command that compiles a nolol-document (given as uri) to a yolol-file next to it
+const compileCommand = "compileNolol"
+
+const (
+	// sourceOptimize is the kind of the code-action that optimizes a yolol-file
+	sourceOptimize lsp.CodeActionKind = lsp.Source + ".optimize"
+	// sourceCompile is the kind of the code-action that compiles a nolol-file
+	sourceCompile lsp.CodeActionKind = lsp.Source + ".compile"
+)
+
+var unavailableOperatorRegex = regexp.MustCompile(`^Operator '(.+)' is not available on \w+-chips$`)
+var unknownMacroRegex = regexp.MustCompile(`^Unknown function or macro: (\w+)\(`)
+var chipSpecificRegex = regexp.MustCompile(`_(basic|advanced|professional)$`)
+
+// lineTooLongMessage is the message of the diagnostic the length-checker reports for a too long line
+const lineTooLongMessage = "The line has more than 70 characters"
+
+// stdlibReplacements maps the operators that are not available on all chip-types to the equivalent macros of the standard-library
+var stdlibReplacements = map[string]string{
+	"%":   "math_mod",
+	"%=":  "math_mod",
+	"abs": "math_abs",
+}
+
+// stdlibMathInclude is the include that provides the macros of stdlibReplacements
+const stdlibMathInclude = "std/math"
+
+// GetCodeActions returns the quick-fixes for the given diagnostics and the source-actions for the given document
+func (s *LangServer) GetCodeActions(params *lsp.CodeActionParams) ([]lsp.CodeAction, error) {
+	uri := params.TextDocument.URI
+	text, err := s.cache.Get(uri)
+	if err != nil {
+		return nil, err
+	}
+	isNolol := strings.HasSuffix(string(uri), ".nolol")
+	isYolol := strings.HasSuffix(string(uri), ".yolol")
+
+	actions := make([]lsp.CodeAction, 0)
+	addAction := func(title string, kind lsp.CodeActionKind, diag *lsp.Diagnostic, edits []lsp.TextEdit) {
+		if len(edits) == 0 || !isKindRequested(params.Context.Only, kind) {
+			return
+		}
+		action := lsp.CodeAction{
+			Title: title,
+			Kind:  kind,
+			Edit: &lsp.WorkspaceEdit{
+				Changes: map[lsp.DocumentURI][]lsp.TextEdit{
+					uri: edits,
+				},
+			},
+		}
+		if diag != nil {
+			action.Diagnostics = []lsp.Diagnostic{*diag}
+		}
+		actions = append(actions, action)
+	}
+
+	for i := range params.Context.Diagnostics {
+		diag := &params.Context.Diagnostics[i]
+		if isNolol {
+			if match := unavailableOperatorRegex.FindStringSubmatch(diag.Message); match != nil {
+				if replacement, exists := stdlibReplacements[match[1]]; exists {
+					title := "Replace '" + match[1] + "' with " + replacement + " from " + stdlibMathInclude
+					addAction(title, lsp.QuickFix, diag, replaceOperator(text, diag.Range.Start, match[1], replacement))
+				}
+			} else if match := unknownMacroRegex.FindStringSubmatch(diag.Message); match != nil {
+				if include := findStdlibMacro(match[1]); include != "" {
+					title := "Add include \"" + include + "\""
+					addAction(title, lsp.QuickFix, diag, addInclude(text, include))
+				}
+			}
+		} else if isYolol && diag.Message == lineTooLongMessage {
+			addAction("Split the line", lsp.QuickFix, diag, splitLine(text, int(diag.Range.Start.Line)))
+		}
+	}
+
+	if isYolol {
+		addAction("Optimize this file", sourceOptimize, nil, optimizeYolol(text))
+	} else if isNolol && isKindRequested(params.Context.Only, sourceCompile) {
+		actions = append(actions, lsp.CodeAction{
+			Title: "Compile this NOLOL file",
+			Kind:  sourceCompile,
+			Command: &lsp.Command{
+				Title:     "Compile this NOLOL file",
+				Command:   compileCommand,
+				Arguments: []interface{}{string(uri)},
+			},
+		})
+	}
+
+	return actions, nil
+}
+
+// isKindRequested returns true if actions of the given kind have been requested by the client
+// An empty list of requested kinds means that all kinds are requested
+func isKindRequested(only []lsp.CodeActionKind, kind lsp.CodeActionKind) bool {
+	if len(only) == 0 {
+		return true
+	}
+	for _, requested := range only {
+		if kind == requested || strings.HasPrefix(string(kind), string(requested)+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// replaceOperator returns the edits that replace the usage of op at the given position by a call of the given macro
+// If necessary, an include for the standard-library is added
+func replaceOperator(text string, pos lsp.Position, op string, macro string) []lsp.TextEdit {
+	prog, err := nolol.NewParser().Parse(text)
+	if err != nil {
+		return nil
+	}
+
+	var found ast.Node
+	prog.Accept(ast.VisitorFunc(func(node ast.Node, visitType int) error {
+		start := node.Start()
+		if found != nil || visitType == ast.PostVisit || start.Line-1 != int(pos.Line) || start.Coloumn-1 != int(pos.Character) {
+			return nil
+		}
+		switch n := node.(type) {
+		case *ast.BinaryOperation:
+			if n.Operator == op {
+				found = n
+			}
+		case *ast.UnaryOperation:
+			if n.Operator == op {
+				found = n
+			}
+		case *ast.Assignment:
+			if n.Operator == op {
+				found = n
+			}
+		case *nast.FuncCall:
+			if strings.EqualFold(n.Function, op) && len(n.Arguments) == 1 {
+				found = n
+			}
+		}
+		return nil
+	}))
+	if found == nil {
+		return nil
+	}
+
+	printer := nolol.NewPrinter()
+	printExpr := func(node ast.Node) string {
+		printed, err := printer.Print(node)
+		if err != nil {
+			return ""
+		}
+		return strings.TrimSpace(printed)
+	}
+
+	var replacement string
+	switch n := found.(type) {
+	case *ast.BinaryOperation:
+		replacement = macro + "(" + printExpr(n.Exp1) + ", " + printExpr(n.Exp2) + ")"
+	case *ast.UnaryOperation:
+		replacement = macro + "(" + printExpr(n.Exp) + ")"
+	case *ast.Assignment:
+		replacement = n.Variable + " = " + macro + "(" + n.Variable + ", " + printExpr(n.Value) + ")"
+	case *nast.FuncCall:
+		replacement = macro + "(" + printExpr(n.Arguments[0]) + ")"
+	}
+
+	lines := strings.Split(text, "\n")
+	start := found.Start()
+	end := found.End()
+	if start.Line-1 >= len(lines) || end.Line != start.Line {
+		return nil
+	}
+	startColoumn, endColoumn := bracketRange(lines[start.Line-1], start.Coloumn-1, end.Coloumn-1)
+
+	edits := []lsp.TextEdit{
+		{
+			Range: lsp.Range{
+				Start: lsp.Position{Line: float64(start.Line - 1), Character: float64(startColoumn)},
+				End:   lsp.Position{Line: float64(start.Line - 1), Character: float64(endColoumn)},
+			},
+			NewText: replacement,
+		},
+	}
+	return append(edits, addInclude(text, stdlibMathInclude)...)
+}
+
+// bracketRange extends the range from start to end (inside line), so that it contains all the brackets belonging to it.
+// This is necessary, as the positions of the ast do not include all brackets of an expression
+func bracketRange(line string, start int, end int) (int, int) {
+	if end > len(line) {
+		end = len(line)
+	}
+	depth := 0
+	unopened := 0
+	inString := false
+	for i := start; i < end; i++ {
+		switch line[i] {
+		case '"':
+			inString = !inString
+		case '(':
+			if !inString {
+				depth++
+			}
+		case ')':
+			if !inString {
+				depth--
+				if depth < -unopened {
+					unopened = -depth
+				}
+			}
+		}
+	}
+
+	// move start before the brackets that are closed inside the range
+	for i := start - 1; i >= 0 && unopened > 0; i-- {
+		if line[i] == '(' {
+			unopened--
+			start = i
+		}
+	}
+
+	// move end behind the brackets that are opened inside the range
+	depth = 0
+	inString = false
+	for i := start; i < len(line); i++ {
+		if i >= end && depth <= 0 {
+			return start, i
+		}
+		switch line[i] {
+		case '"':
+			inString = !inString
+		case '(':
+			if !inString {
+				depth++
+			}
+		case ')':
+			if !inString {
+				depth--
+			}
+		}
+	}
+	return start, len(line)
+}
+
+// findStdlibMacro returns the include that provides the macro with the given name. Returns "" if there is no such macro
+func findStdlibMacro(name string) string {
+	files := stdlib.AssetNames()
+	sort.Strings(files)
+	for _, file := range files {
+		content, err := stdlib.Get(stdlib.Prefix + file)
+		if err != nil {
+			continue
+		}
+		prog, err := nolol.NewParser().Parse(content)
+		if err != nil {
+			continue
+		}
+		for _, element := range prog.Elements {
+			if macro, is := element.(*nast.MacroDefinition); is && strings.EqualFold(macro.Name, name) {
+				// chip-specific files are included using their common name
+				return stdlib.Prefix + chipSpecificRegex.ReplaceAllString(strings.TrimSuffix(file, ".nolol"), "")
+			}
+		}
+	}
+	return ""
+}
+
+// addInclude returns the edit that adds the given include after the existing includes of the program.
+// Returns no edits if the file is already included
+func addInclude(text string, include string) []lsp.TextEdit {
+	prog, err := nolol.NewParser().Parse(text)
+	if err != nil {
+		return nil
+	}
+	line := 0
+	for _, element := range prog.Elements {
+		if directive, is := element.(*nast.IncludeDirective); is {
+			if strings.HasPrefix(directive.File, include) {
+				return nil
+			}
+			line = directive.Start().Line
+		}
+	}
+	return []lsp.TextEdit{
+		{
+			Range: lsp.Range{
+				Start: lsp.Position{Line: float64(line)},
+				End:   lsp.Position{Line: float64(line)},
+			},
+			NewText: "include \"" + include + "\"\n",
+		},
+	}
+}
+
+// splitLine returns the edits that split the given (zero-based) line of a yolol-program into two lines.
+// All gotos to the following lines are adjusted. Returns nil if the line can not be split.
+func splitLine(text string, lineIdx int) []lsp.TextEdit {
+	// a trailing newline does not start another line
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	if len(lines) >= 20 {
+		return nil
+	}
+	prog, err := parser.NewParser().Parse(text)
+	if err != nil || lineIdx >= len(prog.Lines) || len(prog.Lines[lineIdx].Statements) < 2 {
+		return nil
+	}
+
+	// find the last statement that can start the new line, so that the remaining line is short enough
+	line := lines[lineIdx]
+	statements := prog.Lines[lineIdx].Statements
+	split := -1
+	for i := len(statements) - 1; i > 0; i-- {
+		start := statements[i].Start().Coloumn - 1
+		if start < len(line) && len(strings.TrimSpace(line[:start])) <= 70 {
+			split = start
+			break
+		}
+	}
+	if split < 0 {
+		return nil
+	}
+
+	edits := []lsp.TextEdit{
+		{
+			Range: lsp.Range{
+				Start: lsp.Position{Line: float64(lineIdx), Character: float64(len(strings.TrimRight(line[:split], " \t")))},
+				End:   lsp.Position{Line: float64(lineIdx), Character: float64(split)},
+			},
+			NewText: "\n",
+		},
+	}
+
+	adjustable := true
+	prog.Accept(ast.VisitorFunc(func(node ast.Node, visitType int) error {
+		gotostmt, is := node.(*ast.GoToStatement)
+		if !is || visitType != ast.PreVisit {
+			return nil
+		}
+		target, isConstant := gotostmt.Line.(*ast.NumberConstant)
+		if !isConstant {
+			adjustable = false
+			return nil
+		}
+		targetLine, err := strconv.Atoi(target.Value)
+		if err != nil {
+			adjustable = false
+			return nil
+		}
+		if targetLine > lineIdx+1 {
+			edits = append(edits, lsp.TextEdit{
+				Range: lsp.Range{
+					Start: lsp.Position{Line: float64(target.Start().Line - 1), Character: float64(target.Start().Coloumn - 1)},
+					End:   lsp.Position{Line: float64(target.End().Line - 1), Character: float64(target.End().Coloumn - 1)},
+				},
+				NewText: strconv.Itoa(targetLine + 1),
+			})
+		}
+		return nil
+	}))
+	// computed gotos can not be adjusted. Splitting the line would break them
+	if !adjustable {
+		return nil
+	}
+	return edits
+}
+
+// optimizeYolol returns the edits that replace the given yolol-code by its optimized version
+func optimizeYolol(text string) []lsp.TextEdit {
+	prog, err := parser.NewParser().Parse(text)
+	if err != nil {
+		return nil
+	}
+	err = optimizers.NewCompoundOptimizer().Optimize(prog)
+	if err != nil {
+		return nil
+	}
+	printer := parser.Printer{}
+	optimized, err := printer.Print(prog)
+	if err != nil || optimized == text {
+		return nil
+	}
+	return ComputeTextEdits(text, optimized)
+}
+
+// CompileDocument compiles the given nolol-document and writes the result to a yolol-file next to it
+func (s *LangServer) CompileDocument(ctx context.Context, uri lsp.DocumentURI) error {
+	converter := nolol.NewConverter()
+	converter.SetChipType(s.settings.Yolol.ChipType)
+	converted, err := converter.LoadFileEx(string(uri), newfs(s, uri)).Convert()
+	if err != nil {
+		return jsonrpc2.NewErrorf(jsonrpc2.CodeInvalidParams, "Error when compiling: %s", strings.TrimSpace(err.Error()))
+	}
+
+	printer := parser.Printer{}
+	generated, err := printer.Print(converted)
+	if err != nil {
+		return err
+	}
+
+	outfile := strings.TrimSuffix(getFilePath(uri), ".nolol") + ".yolol"
+	err = ioutil.WriteFile(outfile, []byte(generated), 0644)
+	if err != nil {
+		return err
+	}
+
+	return s.client.ShowMessage(ctx, &lsp.ShowMessageParams{
+		Type:    lsp.Info,
+		Message: "Compiled " + filepath.Base(getFilePath(uri)) + " to " + filepath.Base(outfile),
+	})
+}
@@ -0,0 +1,194 @@
+package langserver
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/dbaumgarten/yodk/pkg/lsp"
+)
+
+// applyEdits applies the given (non-overlapping) edits to text
+func applyEdits(text string, edits []lsp.TextEdit) string {
+	lines := strings.Split(text, "\n")
+	offset := func(pos lsp.Position) int {
+		o := 0
+		for i := 0; i < int(pos.Line) && i < len(lines); i++ {
+			o += len(lines[i]) + 1
+		}
+		return o + int(pos.Character)
+	}
+	sorted := make([]lsp.TextEdit, len(edits))
+	copy(sorted, edits)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return offset(sorted[i].Range.Start) > offset(sorted[j].Range.Start)
+	})
+	for _, edit := range sorted {
+		text = text[:offset(edit.Range.Start)] + edit.NewText + text[offset(edit.Range.End):]
+	}
+	return text
+}
+
+func TestReplaceOperator(t *testing.T) {
+	cases := []struct {
+		name     string
+		text     string
+		line     int
+		char     int
+		op       string
+		macro    string
+		expected string
+	}{
+		{"binary", "a = b % c\n", 0, 4, "%", "math_mod",
+			"include \"std/math\"\na = math_mod(b, c)\n"},
+		{"brackets", "x = (a+b)%c\n", 0, 5, "%", "math_mod",
+			"include \"std/math\"\nx = math_mod(a+b, c)\n"},
+		{"assignment", "a %= 2\n", 0, 0, "%=", "math_mod",
+			"include \"std/math\"\na = math_mod(a, 2)\n"},
+		{"function", "x = abs(y) + 1\n", 0, 4, "abs", "math_abs",
+			"include \"std/math\"\nx = math_abs(y) + 1\n"},
+		{"existing-include", "include \"std/math\"\na = b % c\n", 1, 4, "%", "math_mod",
+			"include \"std/math\"\na = math_mod(b, c)\n"},
+		{"after-includes", "include \"std/logic\"\na = b % c\n", 1, 4, "%", "math_mod",
+			"include \"std/logic\"\ninclude \"std/math\"\na = math_mod(b, c)\n"},
+		{"wrong-position", "a = b % c\n", 0, 0, "%", "math_mod", ""},
+		{"wrong-operator", "a = b + c\n", 0, 4, "%", "math_mod", ""},
+		{"parser-error", "a = b %\n", 0, 4, "%", "math_mod", ""},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			edits := replaceOperator(c.text, lsp.Position{Line: float64(c.line), Character: float64(c.char)}, c.op, c.macro)
+			if c.expected == "" {
+				if edits != nil {
+					t.Fatalf("Expected no edits, but got %v", edits)
+				}
+				return
+			}
+			if result := applyEdits(c.text, edits); result != c.expected {
+				t.Fatalf("Expected:\n%s\nGot:\n%s", c.expected, result)
+			}
+		})
+	}
+}
+
+func TestBracketRange(t *testing.T) {
+	cases := []struct {
+		line          string
+		start         int
+		end           int
+		expectedStart int
+		expectedEnd   int
+	}{
+		{"x = a % b", 4, 9, 4, 9},
+		{"x = (a+b)%c", 5, 11, 4, 11},
+		{"x = a%(b+c)", 4, 9, 4, 11},
+		{"x = ((a))%c + 1", 6, 11, 4, 11},
+		{"x = a%\"(\" + 1", 4, 9, 4, 9},
+	}
+	for _, c := range cases {
+		start, end := bracketRange(c.line, c.start, c.end)
+		if start != c.expectedStart || end != c.expectedEnd {
+			t.Errorf("%s: expected range %d-%d, but got %d-%d", c.line, c.expectedStart, c.expectedEnd, start, end)
+		}
+	}
+}
+
+func TestAddInclude(t *testing.T) {
+	cases := []struct {
+		name     string
+		text     string
+		expected string
+	}{
+		{"no-includes", "a = 1\n", "include \"std/math\"\na = 1\n"},
+		{"after-includes", "include \"std/logic\"\ninclude \"lib\"\na = 1\n", "include \"std/logic\"\ninclude \"lib\"\ninclude \"std/math\"\na = 1\n"},
+		{"already-included", "include \"std/math\"\na = 1\n", ""},
+		{"chip-specific", "include \"std/math_basic\"\na = 1\n", ""},
+		{"parser-error", "a = \n", ""},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			edits := addInclude(c.text, "std/math")
+			if c.expected == "" {
+				if edits != nil {
+					t.Fatalf("Expected no edits, but got %v", edits)
+				}
+				return
+			}
+			if result := applyEdits(c.text, edits); result != c.expected {
+				t.Fatalf("Expected:\n%s\nGot:\n%s", c.expected, result)
+			}
+		})
+	}
+}
+
+func TestSplitLine(t *testing.T) {
+	long := "a = 1111111111 b = 2222222222 c = 3333333333 d = 4444444444 e = 5555555555 f = 6"
+
+	cases := []struct {
+		name     string
+		text     string
+		line     int
+		expected string
+	}{
+		{"simple", "a = 1 b = 2\n", 0, "a = 1\nb = 2\n"},
+		{"gotos", "a = 1 b = 2\ngoto 1\ngoto 2\ngoto 3\n", 0, "a = 1\nb = 2\ngoto 1\ngoto 3\ngoto 4\n"},
+		{"goto-in-split-line", "x = 1\na = 1 goto 2\n", 1, "x = 1\na = 1\ngoto 2\n"},
+		{"long-line", long + "\n", 0, "a = 1111111111 b = 2222222222 c = 3333333333 d = 4444444444\ne = 5555555555 f = 6\n"},
+		{"single-statement", "a = 1\nb = 2\n", 0, ""},
+		{"computed-goto", "a = 1 b = 2\ngoto a\n", 0, ""},
+		{"19-lines", strings.Repeat("a = 1 b = 2\n", 19), 0, "a = 1\nb = 2\n" + strings.Repeat("a = 1 b = 2\n", 18)},
+		{"too-many-lines", strings.Repeat("a = 1 b = 2\n", 20), 0, ""},
+		{"invalid-line", "a = 1 b = 2\n", 5, ""},
+		{"parser-error", "a = 1 b = \n", 0, ""},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			edits := splitLine(c.text, c.line)
+			if c.expected == "" {
+				if edits != nil {
+					t.Fatalf("Expected no edits, but got %v", edits)
+				}
+				return
+			}
+			if result := applyEdits(c.text, edits); result != c.expected {
+				t.Fatalf("Expected:\n%s\nGot:\n%s", c.expected, result)
+			}
+		})
+	}
+}
+
+func TestFindStdlibMacro(t *testing.T) {
+	cases := map[string]string{
+		"math_mod":   "std/math",
+		"logic_wait": "std/logic",
+		"MATH_ABS":   "std/math",
+		"unknown":    "",
+	}
+	for name, expected := range cases {
+		if include := findStdlibMacro(name); include != expected {
+			t.Errorf("%s: expected '%s', but got '%s'", name, expected, include)
+		}
+	}
+}
+
+func TestIsKindRequested(t *testing.T) {
+	cases := []struct {
+		only     []lsp.CodeActionKind
+		kind     lsp.CodeActionKind
+		expected bool
+	}{
+		{nil, lsp.QuickFix, true},
+		{[]lsp.CodeActionKind{lsp.QuickFix}, lsp.QuickFix, true},
+		{[]lsp.CodeActionKind{lsp.Source}, sourceOptimize, true},
+		{[]lsp.CodeActionKind{lsp.Source}, lsp.QuickFix, false},
+		{[]lsp.CodeActionKind{sourceCompile}, sourceOptimize, false},
+	}
+	for _, c := range cases {
+		if requested := isKindRequested(c.only, c.kind); requested != c.expected {
+			t.Errorf("%v / %s: expected %t, but got %t", c.only, c.kind, c.expected, requested)
+		}
+	}
+}
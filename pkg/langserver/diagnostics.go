@@ -176,6 +176,8 @@ func (s *LangServer) Diagnose(ctx context.Context, uri lsp.DocumentURI) {
 
 			if parserError == nil {
 				intermediate := included.GetIntermediateProgram()
+				diagRes.Program = nast.CopyAst(intermediate).(*nast.Program)
+				diagRes.Includes = included.GetIncludes()
 				// Analyze() will mutate the ast, so we create a copy of it
 				analyse := nast.CopyAst(intermediate).(*nast.Program)
 				analysis, err := nolol.Analyse(analyse)
@@ -0,0 +1,305 @@
+package langserver
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dbaumgarten/yodk/pkg/lsp"
+	"github.com/dbaumgarten/yodk/pkg/nolol"
+	"github.com/dbaumgarten/yodk/pkg/nolol/nast"
+	"github.com/dbaumgarten/yodk/pkg/optimizers"
+	"github.com/dbaumgarten/yodk/pkg/parser/ast"
+	"github.com/dbaumgarten/yodk/pkg/validators"
+)
+
+// maxDefinitionExpansions limits how deep definitions are expanded. Prevents endless loops for recursive definitions
+const maxDefinitionExpansions = 20
+
+// builtinDoc documents a keyword, operator or function
+type builtinDoc struct {
+	Signature   string
+	Description string
+	// if true, the builtin does only exist in nolol
+	NololOnly bool
+}
+
+// builtinDocs contains the documentation for the yolol- and nolol-builtins, indexed by the token that represents them
+var builtinDocs = map[string]builtinDoc{
+	"if":       {Signature: "if X then ... else ... end", Description: "Executes the then-block if X is true (not 0), otherwise the else-block"},
+	"then":     {Signature: "if X then ... end", Description: "Starts the block that is executed if the condition of the if is true"},
+	"else":     {Signature: "if X then ... else ... end", Description: "Starts the block that is executed if the condition of the if is false"},
+	"end":      {Signature: "end", Description: "Ends the current block"},
+	"goto":     {Signature: "goto X", Description: "Continues the execution at the given line"},
+	"and":      {Signature: "X and Y", Description: "Returns true if X and Y are true"},
+	"or":       {Signature: "X or Y", Description: "Returns true if X or Y are true"},
+	"not":      {Signature: "not X", Description: "Returns 1 if X is 0, otherwise it returns 0"},
+	"abs":      {Signature: "abs X", Description: "Returns the absolute value of X"},
+	"sqrt":     {Signature: "sqrt X", Description: "Returns the square-root of X"},
+	"sin":      {Signature: "sin X", Description: "Returns the sine (degree) of X"},
+	"cos":      {Signature: "cos X", Description: "Returns the cosine (degree) of X"},
+	"tan":      {Signature: "tan X", Description: "Returns the tangent (degree) of X"},
+	"asin":     {Signature: "asin X", Description: "Returns the inverse sine (degree) of X"},
+	"acos":     {Signature: "acos X", Description: "Returns the inverse cosine (degree) of X"},
+	"atan":     {Signature: "atan X", Description: "Returns the inverse tangent (degree) of X"},
+	"+":        {Signature: "X + Y", Description: "Adds two numbers or concatenates two strings"},
+	"-":        {Signature: "X - Y", Description: "Subtracts two numbers or removes the last occurence of Y from the string X"},
+	"*":        {Signature: "X * Y", Description: "Multiplies two numbers"},
+	"/":        {Signature: "X / Y", Description: "Divides X by Y"},
+	"%":        {Signature: "X % Y", Description: "Returns the remainder of the division of X by Y"},
+	"^":        {Signature: "X ^ Y", Description: "Returns X to the power of Y"},
+	"!":        {Signature: "X!", Description: "Returns the factorial of X"},
+	"++":       {Signature: "X++ / ++X", Description: "Increments X by one. For strings, appends a space"},
+	"--":       {Signature: "X-- / --X", Description: "Decrements X by one. For strings, removes the last character"},
+	"==":       {Signature: "X == Y", Description: "Returns 1 if X is equal to Y, otherwise 0"},
+	"!=":       {Signature: "X != Y", Description: "Returns 1 if X is not equal to Y, otherwise 0"},
+	">":        {Signature: "X > Y", Description: "Returns 1 if X is greater than Y, otherwise 0"},
+	"<":        {Signature: "X < Y", Description: "Returns 1 if X is less than Y, otherwise 0"},
+	">=":       {Signature: "X >= Y", Description: "Returns 1 if X is greater than or equal to Y, otherwise 0"},
+	"<=":       {Signature: "X <= Y", Description: "Returns 1 if X is less than or equal to Y, otherwise 0"},
+	"=":        {Signature: "X = Y", Description: "Assigns the value of Y to the variable X"},
+	"+=":       {Signature: "X += Y", Description: "Shorthand for X = X + Y"},
+	"-=":       {Signature: "X -= Y", Description: "Shorthand for X = X - Y"},
+	"*=":       {Signature: "X *= Y", Description: "Shorthand for X = X * Y"},
+	"/=":       {Signature: "X /= Y", Description: "Shorthand for X = X / Y"},
+	"%=":       {Signature: "X %= Y", Description: "Shorthand for X = X % Y"},
+	"^=":       {Signature: "X ^= Y", Description: "Shorthand for X = X ^ Y"},
+	"while":    {Signature: "while X do ... end", Description: "Executes the block as long as X is true", NololOnly: true},
+	"do":       {Signature: "while X do ... end", Description: "Starts the block of a while-loop", NololOnly: true},
+	"break":    {Signature: "break", Description: "Leaves the current loop", NololOnly: true},
+	"continue": {Signature: "continue", Description: "Continues with the next iteration of the current loop", NololOnly: true},
+	"define":   {Signature: "define NAME = VALUE", Description: "Defines a compile-time constant. All mentionings of NAME are replaced by VALUE", NololOnly: true},
+	"include":  {Signature: "include \"FILE\"", Description: "Inserts the contents of the given nolol-file. The .nolol-suffix is optional", NololOnly: true},
+	"macro":    {Signature: "macro NAME(ARGS)<EXTERNALS> TYPE ... end", Description: "Defines a macro. Macros are inserted wherever they are used. TYPE is one of block, line or expr", NololOnly: true},
+	"block":    {Signature: "macro NAME() block", Description: "The macro contains multiple lines and can only be used as a statement on its own line", NololOnly: true},
+	"line":     {Signature: "macro NAME() line", Description: "The macro contains a single line of statements", NololOnly: true},
+	"expr":     {Signature: "macro NAME() expr", Description: "The macro contains a single expression and can be used as a value", NololOnly: true},
+	"time":     {Signature: "time()", Description: "Returns the number of lines executed by the script so far", NololOnly: true},
+	";":        {Signature: "X; Y", Description: "Statements separated by ; are always placed on the same yolol-line", NololOnly: true},
+	"$":        {Signature: "$ X $", Description: "Prevents merging the line with the previous (leading $) or following (trailing $) lines", NololOnly: true},
+}
+
+// GetHover returns the hover-information for the token at the given position
+func (s *LangServer) GetHover(params *lsp.TextDocumentPositionParams) (*lsp.Hover, error) {
+	uri := params.TextDocument.URI
+	isNolol := strings.HasSuffix(string(uri), ".nolol")
+	if !isNolol && !strings.HasSuffix(string(uri), ".yolol") {
+		return nil, nil
+	}
+	text, err := s.cache.Get(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	token, tokenRange := tokenAt(text, params.Position, isNolol)
+	if token == nil {
+		return nil, nil
+	}
+
+	content := ""
+	if isNolol && token.Type == ast.TypeID {
+		diags, err := s.cache.GetDiagnostics(uri)
+		if err == nil && diags.AnalysisReport != nil {
+			content = nololHover(diags.AnalysisReport, token.Value)
+		}
+	}
+	if content == "" && (token.Type == ast.TypeKeyword || token.Type == ast.TypeSymbol || token.Type == ast.TypeID) {
+		chipType, _ := validators.AutoChooseChipType(s.settings.Yolol.ChipType, string(uri))
+		content = builtinHover(strings.ToLower(token.Value), isNolol, chipType)
+	}
+	if content == "" {
+		return nil, nil
+	}
+
+	return &lsp.Hover{
+		Contents: lsp.MarkupContent{
+			Kind:  lsp.Markdown,
+			Value: strings.TrimSpace(content),
+		},
+		Range: tokenRange,
+	}, nil
+}
+
+// tokenAt returns the token at the given position in text and the range the token covers
+// Returns nil if there is no token (or only whitespace) at the position
+func tokenAt(text string, pos lsp.Position, isNolol bool) (*ast.Token, lsp.Range) {
+	var tokenizer *ast.Tokenizer
+	if isNolol {
+		tokenizer = nast.NewNololTokenizer()
+	} else {
+		tokenizer = ast.NewTokenizer()
+	}
+	tokenizer.Load(text)
+
+	// lsp-positions are zero-based, token-positions start at 1
+	line := int(pos.Line) + 1
+	coloumn := int(pos.Character) + 1
+	for {
+		token := tokenizer.Next()
+		if token.Type == ast.TypeEOF || token.Position.Line > line {
+			return nil, lsp.Range{}
+		}
+		end := tokenizer.Checkpoint()
+		if token.Position.Line == line && token.Position.Coloumn <= coloumn && (end.Line > line || end.Column > coloumn) {
+			if token.Type == ast.TypeWhitespace || token.Type == ast.TypeNewline || token.Type == ast.TypeComment {
+				return nil, lsp.Range{}
+			}
+			return token, lsp.Range{
+				Start: lsp.Position{
+					Line:      float64(token.Position.Line - 1),
+					Character: float64(token.Position.Coloumn - 1),
+				},
+				End: lsp.Position{
+					Line:      float64(token.Position.Line - 1),
+					Character: float64(end.Column - 1),
+				},
+			}
+		}
+	}
+}
+
+// builtinHover returns the hover-text for a keyword, operator or builtin function
+func builtinHover(name string, isNolol bool, chipType string) string {
+	doc, exists := builtinDocs[name]
+	if !exists || (doc.NololOnly && !isNolol) {
+		return ""
+	}
+	signature := doc.Signature
+	if isNolol {
+		if _, isFunction := nololFunctions[name]; isFunction {
+			signature = name + "(X)"
+		}
+	}
+	content := codeBlock(signature) + doc.Description
+
+	available := validators.AvailableChipTypes(name)
+	if len(available) < len(validators.ChipTypes) {
+		content += "\n\nAvailable on: " + strings.Join(available, ", ")
+		if !contains(available, chipType) {
+			content += fmt.Sprintf("  \n**Not available on %s-chips**", chipType)
+		}
+	}
+	return content
+}
+
+// nololFunctions are the yolol-operators that are called like functions in nolol
+var nololFunctions = map[string]bool{
+	"abs":  true,
+	"sqrt": true,
+	"sin":  true,
+	"cos":  true,
+	"tan":  true,
+	"asin": true,
+	"acos": true,
+	"atan": true,
+}
+
+// nololHover returns the hover-text for a macro or definition with the given name
+// The analysis also contains the macros and definitions of all included files
+func nololHover(analysis *nolol.AnalysisReport, name string) string {
+	if macro := findMacro(analysis, name); macro != nil {
+		return codeBlock(macroSignature(macro)) + symbolDetails(analysis, macro.Name, macro.Position)
+	}
+
+	if definition := findDefinition(analysis, name); definition != nil {
+		printer := nolol.NewPrinter()
+		value, err := printer.Print(definition.Value)
+		if err != nil {
+			return ""
+		}
+		content := codeBlock("define " + definition.Name + " = " + strings.TrimSpace(value))
+
+		expanded := expandDefinitions(analysis, nast.CopyAst(definition.Value).(ast.Expression), 0)
+		expanded = optimizers.NewStaticExpressionOptimizer().OptimizeExpression(expanded)
+		expandedValue, err := printer.Print(expanded)
+		if err == nil && strings.TrimSpace(expandedValue) != strings.TrimSpace(value) {
+			content += "Value: `" + strings.TrimSpace(expandedValue) + "`\n\n"
+		}
+		return content + symbolDetails(analysis, definition.Name, definition.Position)
+	}
+	return ""
+}
+
+// macroSignature returns the head of the given macro-definition (like: macro name(args)<externals> type)
+func macroSignature(macro *nast.MacroDefinition) string {
+	signature := "macro " + macro.Name + "(" + strings.Join(macro.Arguments, ", ") + ")"
+	if len(macro.Externals) > 0 {
+		signature += "<" + strings.Join(macro.Externals, ", ") + ">"
+	}
+	return signature + " " + macro.Type
+}
+
+// symbolDetails returns the docstring of a macro or definition and the file it has been defined in
+func symbolDetails(analysis *nolol.AnalysisReport, name string, pos ast.Position) string {
+	details := ""
+	if doc, exists := analysis.Docstrings[name]; exists {
+		details += doc
+	}
+	if pos.File != "" {
+		if details != "" {
+			details += "\n"
+		}
+		details += "*Defined in " + pos.File + "*"
+	}
+	return details
+}
+
+// expandDefinitions replaces all mentionings of definitions in exp by the (expanded) values of the definitions
+func expandDefinitions(analysis *nolol.AnalysisReport, exp ast.Expression, depth int) ast.Expression {
+	if depth > maxDefinitionExpansions {
+		return exp
+	}
+	f := func(node ast.Node, visitType int) error {
+		if deref, is := node.(*ast.Dereference); is && deref.Operator == "" {
+			if definition := findDefinition(analysis, deref.Variable); definition != nil {
+				value := nast.CopyAst(definition.Value).(ast.Expression)
+				return ast.NewNodeReplacementSkip(expandDefinitions(analysis, value, depth+1))
+			}
+		}
+		return nil
+	}
+	expanded, err := ast.MustExpression(ast.AcceptChild(ast.VisitorFunc(f), exp))
+	if err != nil {
+		return exp
+	}
+	return expanded
+}
+
+// findMacro returns the macro with the given name. Like nolol itself, the search is case-insensitive
+func findMacro(analysis *nolol.AnalysisReport, name string) *nast.MacroDefinition {
+	if macro, exists := analysis.Macros[name]; exists {
+		return macro
+	}
+	for macroName, macro := range analysis.Macros {
+		if strings.EqualFold(macroName, name) {
+			return macro
+		}
+	}
+	return nil
+}
+
+// findDefinition returns the definition with the given name. Like nolol itself, the search is case-insensitive
+func findDefinition(analysis *nolol.AnalysisReport, name string) *nast.Definition {
+	if definition, exists := analysis.Definitions[name]; exists {
+		return definition
+	}
+	for definitionName, definition := range analysis.Definitions {
+		if strings.EqualFold(definitionName, name) {
+			return definition
+		}
+	}
+	return nil
+}
+
+// codeBlock formats code as markdown-code-block
+func codeBlock(code string) string {
+	return "```\n" + code + "\n```\n"
+}
+
+func contains(list []string, element string) bool {
+	for _, el := range list {
+		if el == element {
+			return true
+		}
+	}
+	return false
+}
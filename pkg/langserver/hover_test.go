@@ -0,0 +1,51 @@
+package langserver
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGetHover(t *testing.T) {
+	s, dir, cleanup := newTestServer(t)
+	defer cleanup()
+
+	cases := []struct {
+		name string
+		file string
+		line int
+		char int
+		// a part of the expected hover-text. Empty if no hover is expected
+		expected string
+	}{
+		{"definition", "main.nolol", 1, 12, "define limit = 5"},
+		{"definition-origin", "main.nolol", 1, 12, "Defined in lib/util"},
+		{"macro", "main.nolol", 2, 1, "macro inc(x) line"},
+		{"stdlib-macro", "main.nolol", 4, 2, "macro logic_wait("},
+		{"keyword", "main.nolol", 3, 17, "goto"},
+		{"yolol-global", "chip.yolol", 0, 0, ""},
+		{"local", "main.nolol", 5, 0, ""},
+		{"whitespace", "main.nolol", 1, 6, ""},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			params := testPosition(dir, c.file, c.line, c.char)
+			hover, err := s.GetHover(&params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.expected == "" {
+				if hover != nil {
+					t.Fatalf("Expected no hover, but got %v", hover.Contents.Value)
+				}
+				return
+			}
+			if hover == nil {
+				t.Fatalf("Expected hover containing '%s', but got none", c.expected)
+			}
+			if !strings.Contains(hover.Contents.Value, c.expected) {
+				t.Fatalf("Expected hover containing '%s', but got '%s'", c.expected, hover.Contents.Value)
+			}
+		})
+	}
+}
@@ -0,0 +1,441 @@
+package langserver
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/dbaumgarten/yodk/pkg/lsp"
+	"github.com/dbaumgarten/yodk/pkg/nolol"
+	"github.com/dbaumgarten/yodk/pkg/nolol/nast"
+	"github.com/dbaumgarten/yodk/pkg/parser/ast"
+	"github.com/dbaumgarten/yodk/pkg/validators"
+	"github.com/dbaumgarten/yodk/stdlib"
+)
+
+// includeRegex matches lines containing an include-directive
+var includeRegex = regexp.MustCompile(`^\s*include\s+"([^"]+)"`)
+
+// GetDefinition returns the location of the declaration of the macro, definition or label at the given position.
+// If the position is inside an include-directive, the location of the included file is returned
+func (s *LangServer) GetDefinition(params *lsp.TextDocumentPositionParams) ([]lsp.Location, error) {
+	uri := params.TextDocument.URI
+	if !strings.HasSuffix(string(uri), ".nolol") {
+		return nil, nil
+	}
+	text, err := s.cache.Get(uri)
+	if err != nil {
+		return nil, err
+	}
+	diags, err := s.cache.GetDiagnostics(uri)
+	if err != nil || diags.AnalysisReport == nil {
+		return nil, nil
+	}
+
+	lines := strings.Split(text, "\n")
+	if int(params.Position.Line) < len(lines) {
+		if match := includeRegex.FindStringSubmatch(lines[int(params.Position.Line)]); match != nil {
+			path, err := s.sourcePath(uri, diags, includedFile(diags, match[1]))
+			if err != nil {
+				return nil, nil
+			}
+			target, err := s.getURI(path)
+			if err != nil {
+				return nil, err
+			}
+			return []lsp.Location{{URI: target}}, nil
+		}
+	}
+
+	token, _ := tokenAt(text, params.Position, true)
+	if token == nil || token.Type != ast.TypeID {
+		return nil, nil
+	}
+	declaration, found, err := s.findDeclaration(uri, diags, token.Value)
+	if err != nil || !found {
+		return nil, err
+	}
+	return []lsp.Location{declaration}, nil
+}
+
+// references contains all mentionings of an identifier
+type references struct {
+	name string
+	// the ranges of the mentionings, indexed by the paths of the files
+	files map[string][]lsp.Range
+	// the location of the declaration of the identifier. nil for variables
+	declaration *lsp.Location
+}
+
+// GetReferences returns all mentionings of the variable, macro, definition or label at the given position.
+// Global variables are searched in all scripts of the workspace. Macros, definitions and labels are searched in the file
+// declaring them and all files including that file.
+func (s *LangServer) GetReferences(params *lsp.ReferenceParams) ([]lsp.Location, error) {
+	refs, err := s.findReferences(params.TextDocument.URI, params.Position)
+	if err != nil || refs == nil {
+		return nil, err
+	}
+
+	paths := make([]string, 0, len(refs.files))
+	for path := range refs.files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	locations := make([]lsp.Location, 0)
+	for _, path := range paths {
+		uri, err := s.getURI(path)
+		if err != nil {
+			continue
+		}
+		for _, r := range refs.files[path] {
+			location := lsp.Location{
+				URI:   uri,
+				Range: r,
+			}
+			if !params.Context.IncludeDeclaration && refs.declaration != nil && *refs.declaration == location {
+				continue
+			}
+			locations = append(locations, location)
+		}
+	}
+	return locations, nil
+}
+
+// findReferences finds all mentionings of the identifier at the given position. Returns nil if there is no identifier at the position
+func (s *LangServer) findReferences(uri lsp.DocumentURI, position lsp.Position) (*references, error) {
+	isNolol := strings.HasSuffix(string(uri), ".nolol")
+	if !isNolol && !strings.HasSuffix(string(uri), ".yolol") {
+		return nil, nil
+	}
+	text, err := s.cache.Get(uri)
+	if err != nil {
+		return nil, err
+	}
+	token, _ := tokenAt(text, position, isNolol)
+	if token == nil || token.Type != ast.TypeID {
+		return nil, nil
+	}
+	refs := &references{
+		name:  token.Value,
+		files: make(map[string][]lsp.Range),
+	}
+	current := getFilePath(uri)
+
+	var files []string
+	if strings.HasPrefix(refs.name, ":") {
+		files = append(s.workspace.Files(), current)
+	} else if !isNolol || isMacroLocalAt(text, refs.name, int(position.Line)+1) {
+		// local variables of yolol-scripts and macros are only visible in their script or macro
+		files = []string{current}
+	} else {
+		diags, err := s.cache.GetDiagnostics(uri)
+		if err != nil || diags.AnalysisReport == nil {
+			files = []string{current}
+		} else {
+			files = s.relatedFiles(uri, diags, refs.name)
+			location, found, err := s.findDeclaration(uri, diags, refs.name)
+			if err == nil && found {
+				refs.declaration = &location
+			}
+		}
+	}
+
+	for _, file := range uniqueFiles(files) {
+		content, err := s.readFile(file)
+		if err != nil {
+			continue
+		}
+		fileIsNolol := strings.HasSuffix(file, ".nolol")
+		ranges := findIdentifier(content, fileIsNolol, refs.name)
+		if fileIsNolol && !strings.HasPrefix(refs.name, ":") {
+			// local variables of macros are not the same as the variables outside of the macro
+			var cursorLine = -1
+			if file == current {
+				cursorLine = int(position.Line) + 1
+			}
+			ranges = filterMacroScopes(content, refs.name, ranges, cursorLine)
+		}
+		if len(ranges) > 0 {
+			refs.files[file] = ranges
+		}
+	}
+	return refs, nil
+}
+
+// findDeclaration returns the location of the name of the macro, definition or label with the given name
+// The name is searched in the program of the given document, including all included files
+func (s *LangServer) findDeclaration(uri lsp.DocumentURI, diags *DiagnosticResults, name string) (lsp.Location, bool, error) {
+	pos := declarationOf(diags, name)
+	if pos == nil {
+		return lsp.Location{}, false, nil
+	}
+
+	path, err := s.sourcePath(uri, diags, pos.File)
+	if err != nil {
+		return lsp.Location{}, false, err
+	}
+	location := lsp.Location{
+		Range: lsp.Range{
+			Start: lsp.Position{Line: float64(pos.Line - 1), Character: float64(pos.Coloumn - 1)},
+			End:   lsp.Position{Line: float64(pos.Line - 1), Character: float64(pos.Coloumn - 1)},
+		},
+	}
+	location.URI, err = s.getURI(path)
+	if err != nil {
+		return lsp.Location{}, false, err
+	}
+
+	// point to the name itself, not to the start of the declaration
+	content, err := s.readFile(path)
+	if err == nil {
+		for _, r := range findIdentifier(content, true, name) {
+			if int(r.Start.Line) == pos.Line-1 && r.Start.Character >= float64(pos.Coloumn-1) {
+				location.Range = r
+				break
+			}
+		}
+	}
+	return location, true, nil
+}
+
+// declarationOf returns the position of the declaration of the macro, definition or label with the given name
+// Returns nil if there is no such declaration
+func declarationOf(diags *DiagnosticResults, name string) *ast.Position {
+	if macro := findMacro(diags.AnalysisReport, name); macro != nil {
+		return &macro.Position
+	}
+	if definition := findDefinition(diags.AnalysisReport, name); definition != nil {
+		return &definition.Position
+	}
+	if label := findLabel(diags.Program, name); label != nil {
+		return &label.Position
+	}
+	return nil
+}
+
+// findLabel returns the line with the given label
+func findLabel(prog *nast.Program, name string) *nast.StatementLine {
+	if prog == nil {
+		return nil
+	}
+	var found *nast.StatementLine
+	f := func(node ast.Node, visitType int) error {
+		if line, is := node.(*nast.StatementLine); is && found == nil && line.Label != "" && strings.EqualFold(line.Label, name) {
+			found = line
+		}
+		return nil
+	}
+	prog.Accept(ast.VisitorFunc(f))
+	return found
+}
+
+// sourcePath returns the path of the file, whose nodes have the given file in their positions.
+// "" is the document itself. Files of the standard-library are returned by their name (like std/logic.nolol)
+func (s *LangServer) sourcePath(uri lsp.DocumentURI, diags *DiagnosticResults, file string) (string, error) {
+	if file == "" {
+		return getFilePath(uri), nil
+	}
+	filename, exists := diags.Includes[file]
+	if !exists {
+		return "", fmt.Errorf("Unknown included file: %s", file)
+	}
+	if stdlib.Is(filename) {
+		return filename, nil
+	}
+	return filepath.Join(filepath.Dir(getFilePath(uri)), filepath.FromSlash(filename)), nil
+}
+
+// includedFile returns the name of the file (as used in the positions of the nodes) that has been included by an include-directive
+// of the document. Like the converter does, chip-specific versions of the file are also considered. Returns include if nothing matches
+func includedFile(diags *DiagnosticResults, include string) string {
+	candidates := []string{include}
+	if !strings.HasSuffix(include, ".nolol") {
+		candidates = []string{include + ".nolol"}
+		for _, chipType := range []string{validators.ChipTypeProfessional, validators.ChipTypeAdvanced, validators.ChipTypeBasic} {
+			candidates = append(candidates, include+"_"+chipType+".nolol")
+		}
+	}
+	for _, candidate := range candidates {
+		if _, exists := diags.Includes[candidate]; exists {
+			return candidate
+		}
+	}
+	return include
+}
+
+// relatedFiles returns the files in which the given name refers to the same thing as in the given document.
+// These are the file declaring the name and all files of the workspace that (directly or indirectly) include it.
+// If the name is not declared (a variable), the files included by the document are related as well, as variables are not scoped.
+func (s *LangServer) relatedFiles(uri lsp.DocumentURI, diags *DiagnosticResults, name string) []string {
+	current := getFilePath(uri)
+	declaringFile := current
+	files := []string{current}
+
+	if pos := declarationOf(diags, name); pos != nil {
+		if path, err := s.sourcePath(uri, diags, pos.File); err == nil {
+			declaringFile = path
+			files = append(files, path)
+		}
+	} else {
+		for included := range diags.Includes {
+			if path, err := s.sourcePath(uri, diags, included); err == nil {
+				files = append(files, path)
+			}
+		}
+	}
+
+	for _, file := range s.workspace.Files() {
+		if !strings.HasSuffix(file, ".nolol") || file == current || file == declaringFile {
+			continue
+		}
+		for _, included := range s.includedFiles(file) {
+			if included == declaringFile {
+				files = append(files, file)
+				break
+			}
+		}
+	}
+	return files
+}
+
+// includedFiles returns the paths of all files that are (directly or indirectly) included by the given nolol-file
+// Files of the standard-library are returned by their name (like std/logic.nolol)
+func (s *LangServer) includedFiles(file string) []string {
+	converter := nolol.NewConverter()
+	converter.SetChipType(s.settings.Yolol.ChipType)
+	includes := converter.LoadFileEx(file, workspaceFileSystem{ls: s, dir: filepath.Dir(file)}).ProcessIncludes().GetIncludes()
+	files := make([]string, 0, len(includes))
+	for _, filename := range includes {
+		if stdlib.Is(filename) {
+			files = append(files, filename)
+		} else {
+			files = append(files, filepath.Join(filepath.Dir(file), filepath.FromSlash(filename)))
+		}
+	}
+	return files
+}
+
+// workspaceFileSystem is a nolol.FileSystem that reads files using LangServer.readFile. This way unsaved changes are taken into account
+// Relative names are relative to dir
+type workspaceFileSystem struct {
+	ls  *LangServer
+	dir string
+}
+
+func (f workspaceFileSystem) Get(name string) (string, error) {
+	if filepath.IsAbs(name) {
+		return f.ls.readFile(name)
+	}
+	return f.ls.readFile(filepath.Join(f.dir, filepath.FromSlash(name)))
+}
+
+// findIdentifier returns the ranges of all identifiers with the given name in text. Like yolol itself, the search is case-insensitive
+func findIdentifier(text string, isNolol bool, name string) []lsp.Range {
+	var tokenizer *ast.Tokenizer
+	if isNolol {
+		tokenizer = nast.NewNololTokenizer()
+	} else {
+		tokenizer = ast.NewTokenizer()
+	}
+	tokenizer.Load(text)
+	ranges := make([]lsp.Range, 0)
+	for {
+		token := tokenizer.Next()
+		if token.Type == ast.TypeEOF {
+			return ranges
+		}
+		if token.Type == ast.TypeID && strings.EqualFold(token.Value, name) {
+			ranges = append(ranges, lsp.Range{
+				Start: lsp.Position{Line: float64(token.Position.Line - 1), Character: float64(token.Position.Coloumn - 1)},
+				End:   lsp.Position{Line: float64(token.Position.Line - 1), Character: float64(token.Position.Coloumn - 1 + len(token.Value))},
+			})
+		}
+	}
+}
+
+// filterMacroScopes removes the ranges that refer to local variables or arguments of macros.
+// If cursorLine is inside a macro, for which the name is local, only the ranges inside this macro are returned instead
+func filterMacroScopes(text string, name string, ranges []lsp.Range, cursorLine int) []lsp.Range {
+	prog, err := nolol.NewParser().Parse(text)
+	if err != nil {
+		return ranges
+	}
+	scopes := make([][2]int, 0)
+	for _, element := range prog.Elements {
+		macro, is := element.(*nast.MacroDefinition)
+		if !is || !isMacroLocal(macro, name) {
+			continue
+		}
+		scope := [2]int{macro.Start().Line, macro.End().Line}
+		if cursorLine >= scope[0] && cursorLine <= scope[1] {
+			scopes = [][2]int{scope}
+			break
+		}
+		scopes = append(scopes, scope)
+	}
+
+	inside := len(scopes) == 1 && cursorLine >= scopes[0][0] && cursorLine <= scopes[0][1]
+	filtered := make([]lsp.Range, 0, len(ranges))
+	for _, r := range ranges {
+		line := int(r.Start.Line) + 1
+		inScope := false
+		for _, scope := range scopes {
+			if line >= scope[0] && line <= scope[1] {
+				inScope = true
+			}
+		}
+		if inScope == inside {
+			filtered = append(filtered, r)
+		}
+	}
+	return filtered
+}
+
+// isMacroLocalAt returns true if the given line of the nolol-code is inside a macro, for which name is a local variable or argument
+func isMacroLocalAt(text string, name string, line int) bool {
+	prog, err := nolol.NewParser().Parse(text)
+	if err != nil {
+		return false
+	}
+	for _, element := range prog.Elements {
+		if macro, is := element.(*nast.MacroDefinition); is && line >= macro.Start().Line && line <= macro.End().Line {
+			return isMacroLocal(macro, name)
+		}
+	}
+	return false
+}
+
+// isMacroLocal returns true if the given name is an argument or a local variable of the macro
+func isMacroLocal(macro *nast.MacroDefinition, name string) bool {
+	if strings.HasPrefix(name, ":") {
+		return false
+	}
+	for _, external := range macro.Externals {
+		if strings.EqualFold(external, name) {
+			return false
+		}
+	}
+	for _, local := range (nolol.AnalysisReport{}).GetMacroLocalVars(macro) {
+		if strings.EqualFold(local, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// uniqueFiles returns the sorted list of files without duplicates
+func uniqueFiles(files []string) []string {
+	seen := make(map[string]bool, len(files))
+	unique := make([]string, 0, len(files))
+	for _, file := range files {
+		if !seen[file] {
+			seen[file] = true
+			unique = append(unique, file)
+		}
+	}
+	sort.Strings(unique)
+	return unique
+}
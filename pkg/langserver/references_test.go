@@ -0,0 +1,141 @@
+package langserver
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dbaumgarten/yodk/pkg/lsp"
+)
+
+func TestGetDefinition(t *testing.T) {
+	s, dir, cleanup := newTestServer(t)
+	defer cleanup()
+
+	cases := []struct {
+		name string
+		file string
+		line int
+		char int
+		// the file (suffix of the uri) containing the definition. Empty if no definition is expected
+		target     string
+		targetLine int
+	}{
+		{"definition", "main.nolol", 1, 12, "lib/util.nolol", 1},
+		{"macro", "main.nolol", 2, 1, "lib/util.nolol", 2},
+		{"label", "main.nolol", 3, 23, "main.nolol", 1},
+		{"include", "main.nolol", 0, 3, "lib/util.nolol", 0},
+		{"stdlib-macro", "main.nolol", 4, 2, "std/logic.nolol", 0},
+		{"variable", "main.nolol", 5, 0, "", 0},
+		{"global", "main.nolol", 1, 8, "", 0},
+		{"yolol", "chip.yolol", 0, 1, "", 0},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			params := testPosition(dir, c.file, c.line, c.char)
+			locations, err := s.GetDefinition(&params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.target == "" {
+				if len(locations) != 0 {
+					t.Fatalf("Expected no definition, but got %v", locations)
+				}
+				return
+			}
+			if len(locations) != 1 {
+				t.Fatalf("Expected one definition, but got %v", locations)
+			}
+			if !strings.HasSuffix(string(locations[0].URI), c.target) {
+				t.Fatalf("Expected definition in %s, but got %s", c.target, locations[0].URI)
+			}
+			if c.target == "std/logic.nolol" {
+				return
+			}
+			if int(locations[0].Range.Start.Line) != c.targetLine {
+				t.Fatalf("Expected definition in line %d, but got %d", c.targetLine, int(locations[0].Range.Start.Line))
+			}
+		})
+	}
+}
+
+func TestGetReferences(t *testing.T) {
+	s, dir, cleanup := newTestServer(t)
+	defer cleanup()
+
+	cases := []struct {
+		name               string
+		file               string
+		line               int
+		char               int
+		includeDeclaration bool
+		// the expected number of references per file
+		expected map[string]int
+	}{
+		{"definition", "main.nolol", 1, 12, true, map[string]int{
+			"lib/util.nolol": 1,
+			"main.nolol":     1,
+			"other.nolol":    1,
+		}},
+		{"definition-without-declaration", "other.nolol", 1, 6, false, map[string]int{
+			"main.nolol":  1,
+			"other.nolol": 1,
+		}},
+		{"global", "main.nolol", 2, 5, true, map[string]int{
+			"main.nolol": 4,
+			"chip.yolol": 2,
+		}},
+		{"global-from-yolol", "chip.yolol", 0, 6, true, map[string]int{
+			"main.nolol": 4,
+			"chip.yolol": 2,
+		}},
+		{"label", "main.nolol", 1, 2, true, map[string]int{
+			"main.nolol": 2,
+		}},
+		{"local", "main.nolol", 5, 0, true, map[string]int{
+			"main.nolol": 1,
+		}},
+		{"macro-argument", "lib/util.nolol", 3, 1, true, map[string]int{
+			"lib/util.nolol": 2,
+		}},
+		{"macro", "lib/util.nolol", 2, 7, true, map[string]int{
+			"lib/util.nolol": 1,
+			"main.nolol":     1,
+		}},
+		{"yolol-local", "chip.yolol", 0, 12, true, map[string]int{
+			"chip.yolol": 1,
+		}},
+		{"nothing", "main.nolol", 1, 10, true, map[string]int{}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			params := lsp.ReferenceParams{
+				TextDocumentPositionParams: testPosition(dir, c.file, c.line, c.char),
+				Context: lsp.ReferenceContext{
+					IncludeDeclaration: c.includeDeclaration,
+				},
+			}
+			locations, err := s.GetReferences(&params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			found := make(map[string]int)
+			for _, location := range locations {
+				for name := range testFiles {
+					if location.URI == testURI(dir, name) {
+						found[name]++
+					}
+				}
+			}
+			if len(found) != len(c.expected) {
+				t.Fatalf("Expected references %v, but got %v", c.expected, found)
+			}
+			for name, count := range c.expected {
+				if found[name] != count {
+					t.Fatalf("Expected references %v, but got %v", c.expected, found)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package langserver
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/dbaumgarten/yodk/pkg/jsonrpc2"
+	"github.com/dbaumgarten/yodk/pkg/lsp"
+	"github.com/dbaumgarten/yodk/pkg/nolol/nast"
+	"github.com/dbaumgarten/yodk/pkg/parser/ast"
+	"github.com/dbaumgarten/yodk/stdlib"
+)
+
+// GetRenameEdits returns the edits that rename the variable, macro, definition or label at the given position.
+// All mentionings found by GetReferences are renamed. The rename is rejected if the new name is invalid or already in use
+func (s *LangServer) GetRenameEdits(params *lsp.RenameParams) (*lsp.WorkspaceEdit, error) {
+	uri := params.TextDocument.URI
+	refs, err := s.findReferences(uri, params.Position)
+	if err != nil {
+		return nil, err
+	}
+	if refs == nil {
+		return nil, jsonrpc2.NewErrorf(jsonrpc2.CodeInvalidParams, "There is nothing that can be renamed at this position")
+	}
+	newName := params.NewName
+
+	if strings.HasPrefix(refs.name, ":") && !strings.HasPrefix(newName, ":") {
+		return nil, jsonrpc2.NewErrorf(jsonrpc2.CodeInvalidParams, "Global variables can only be renamed to global names (starting with ':')")
+	}
+	if !strings.HasPrefix(refs.name, ":") && strings.HasPrefix(newName, ":") {
+		return nil, jsonrpc2.NewErrorf(jsonrpc2.CodeInvalidParams, "Local variables, macros, definitions and labels can not be renamed to global names")
+	}
+
+	// a change of the casing only is always allowed, as it does not change the meaning of the code
+	changesMeaning := !strings.EqualFold(refs.name, newName)
+
+	if changesMeaning && strings.HasSuffix(string(uri), ".nolol") {
+		diags, err := s.cache.GetDiagnostics(uri)
+		if err == nil && diags.AnalysisReport != nil && declarationOf(diags, newName) != nil {
+			return nil, jsonrpc2.NewErrorf(jsonrpc2.CodeInvalidParams, "There already is a macro, definition or label named '%s'", newName)
+		}
+	}
+
+	for path := range refs.files {
+		if stdlib.Is(path) {
+			return nil, jsonrpc2.NewErrorf(jsonrpc2.CodeInvalidParams, "'%s' is used by the standard-library and can not be renamed", refs.name)
+		}
+	}
+
+	edits := &lsp.WorkspaceEdit{
+		Changes: make(map[lsp.DocumentURI][]lsp.TextEdit),
+	}
+	for path, ranges := range refs.files {
+		isNolol := strings.HasSuffix(path, ".nolol")
+		if !isValidName(newName, isNolol) {
+			return nil, jsonrpc2.NewErrorf(jsonrpc2.CodeInvalidParams, "'%s' is not a valid name", newName)
+		}
+		if changesMeaning {
+			content, err := s.readFile(path)
+			if err != nil {
+				return nil, err
+			}
+			if len(findIdentifier(content, isNolol, newName)) > 0 {
+				return nil, jsonrpc2.NewErrorf(jsonrpc2.CodeInvalidParams, "'%s' is already used in %s", newName, filepath.Base(path))
+			}
+		}
+
+		fileURI, err := s.getURI(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range ranges {
+			edits.Changes[fileURI] = append(edits.Changes[fileURI], lsp.TextEdit{
+				Range:   r,
+				NewText: newName,
+			})
+		}
+	}
+	return edits, nil
+}
+
+// isValidName returns true if name is a single identifier (and not a keyword)
+func isValidName(name string, isNolol bool) bool {
+	var tokenizer *ast.Tokenizer
+	if isNolol {
+		tokenizer = nast.NewNololTokenizer()
+	} else {
+		tokenizer = ast.NewTokenizer()
+	}
+	tokenizer.Load(name)
+	token := tokenizer.Next()
+	return token.Type == ast.TypeID && token.Value == name && tokenizer.Next().Type == ast.TypeEOF
+}
@@ -0,0 +1,95 @@
+package langserver
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dbaumgarten/yodk/pkg/lsp"
+)
+
+func TestGetRenameEdits(t *testing.T) {
+	s, dir, cleanup := newTestServer(t)
+	defer cleanup()
+
+	cases := []struct {
+		name    string
+		file    string
+		line    int
+		char    int
+		newName string
+		// the expected number of edits per file
+		expected map[string]int
+		// a part of the expected error-message. Empty if no error is expected
+		err string
+	}{
+		{"definition", "main.nolol", 1, 12, "maximum", map[string]int{
+			"lib/util.nolol": 1,
+			"main.nolol":     1,
+			"other.nolol":    1,
+		}, ""},
+		{"global", "main.nolol", 2, 5, ":c", map[string]int{
+			"main.nolol": 4,
+			"chip.yolol": 2,
+		}, ""},
+		{"label", "main.nolol", 3, 23, "loop", map[string]int{
+			"main.nolol": 2,
+		}, ""},
+		{"macro-argument", "lib/util.nolol", 3, 1, "value", map[string]int{
+			"lib/util.nolol": 2,
+		}, ""},
+		{"casing", "main.nolol", 1, 12, "LIMIT", map[string]int{
+			"lib/util.nolol": 1,
+			"main.nolol":     1,
+			"other.nolol":    1,
+		}, ""},
+		{"global-to-local", "main.nolol", 2, 5, "c", nil, "only be renamed to global names"},
+		{"local-to-global", "main.nolol", 5, 0, ":x", nil, "can not be renamed to global names"},
+		{"existing-declaration", "main.nolol", 1, 12, "start", nil, "There already is a macro, definition or label named"},
+		{"existing-name", "main.nolol", 1, 2, "x", nil, "is already used in main.nolol"},
+		{"stdlib", "main.nolol", 4, 2, "pause", nil, "is used by the standard-library"},
+		{"invalid-name", "main.nolol", 1, 12, "if", nil, "is not a valid name"},
+		{"nothing", "main.nolol", 1, 10, "foo", nil, "nothing that can be renamed"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			params := lsp.RenameParams{
+				TextDocument: lsp.TextDocumentIdentifier{
+					URI: testURI(dir, c.file),
+				},
+				Position: lsp.Position{
+					Line:      float64(c.line),
+					Character: float64(c.char),
+				},
+				NewName: c.newName,
+			}
+			edits, err := s.GetRenameEdits(&params)
+			if c.err != "" {
+				if err == nil {
+					t.Fatalf("Expected error containing '%s', but got edits %v", c.err, edits)
+				}
+				if !strings.Contains(err.Error(), c.err) {
+					t.Fatalf("Expected error containing '%s', but got '%s'", c.err, err.Error())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(edits.Changes) != len(c.expected) {
+				t.Fatalf("Expected edits %v, but got %v", c.expected, edits.Changes)
+			}
+			for name, count := range c.expected {
+				changes := edits.Changes[testURI(dir, name)]
+				if len(changes) != count {
+					t.Fatalf("Expected %d edits in %s, but got %v", count, name, changes)
+				}
+				for _, change := range changes {
+					if change.NewText != c.newName {
+						t.Fatalf("Expected new text '%s', but got '%s'", c.newName, change.NewText)
+					}
+				}
+			}
+		})
+	}
+}
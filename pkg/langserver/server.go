@@ -11,9 +11,10 @@ import (
 )
 
 type LangServer struct {
-	client   lsp.Client
-	cache    *Cache
-	settings *Settings
+	client    lsp.Client
+	cache     *Cache
+	settings  *Settings
+	workspace *Workspace
 }
 
 func Run(ctx context.Context, stream jsonrpc2.Stream, enableHotkeys bool, opts ...interface{}) error {
@@ -22,6 +23,7 @@ func Run(ctx context.Context, stream jsonrpc2.Stream, enableHotkeys bool, opts .
 	s.client = client
 	s.cache = NewCache()
 	s.settings = DefaultSettings()
+	s.workspace = NewWorkspace()
 
 	if enableHotkeys {
 		// Register the global hotkeys
@@ -59,17 +61,39 @@ func (ls *LangServer) storeLastOpenedScript(uri string) {
 }
 
 func (ls *LangServer) Initialize(ctx context.Context, params *lsp.InitializeParams) (*lsp.InitializeResult, error) {
-	return &lsp.InitializeResult{
-		Capabilities: lsp.ServerCapabilities{
-			TextDocumentSync: lsp.TextDocumentSyncOptions{
-				Change:    float64(lsp.Full), // full contents of file sent on each update
-				OpenClose: true,
-			},
-			DocumentFormattingProvider: true,
-			CompletionProvider: &lsp.CompletionOptions{
-				TriggerCharacters: []string{" ", ":", "+", "-", "*", "/", "%", "=", "^", ">", "<"},
-			},
+	if len(params.WorkspaceFolders) > 0 {
+		for _, folder := range params.WorkspaceFolders {
+			ls.workspace.AddFolder(lsp.DocumentURI(folder.URI))
+		}
+	} else if params.RootURI != nil {
+		ls.workspace.AddFolder(*params.RootURI)
+	}
+
+	capabilities := lsp.ServerCapabilities{
+		TextDocumentSync: lsp.TextDocumentSyncOptions{
+			Change:    float64(lsp.Full), // full contents of file sent on each update
+			OpenClose: true,
 		},
+		DocumentFormattingProvider: true,
+		HoverProvider:              true,
+		DefinitionProvider:         true,
+		ReferencesProvider:         true,
+		RenameProvider:             true,
+		DocumentSymbolProvider:     true,
+		WorkspaceSymbolProvider:    true,
+		CodeActionProvider:         true,
+		ExecuteCommandProvider: &lsp.ExecuteCommandOptions{
+			Commands: []string{compileCommand},
+		},
+		CompletionProvider: &lsp.CompletionOptions{
+			TriggerCharacters: []string{" ", ":", "+", "-", "*", "/", "%", "=", "^", ">", "<"},
+		},
+	}
+	capabilities.Workspace.WorkspaceFolders.Supported = true
+	capabilities.Workspace.WorkspaceFolders.ChangeNotifications = true
+
+	return &lsp.InitializeResult{
+		Capabilities: capabilities,
 	}, nil
 }
 func (ls *LangServer) Initialized(ctx context.Context, params *lsp.InitializedParams) error {
@@ -83,7 +107,13 @@ func (ls *LangServer) Exit(ctx context.Context) error {
 	return unsupported()
 }
 func (ls *LangServer) DidChangeWorkspaceFolders(ctx context.Context, params *lsp.DidChangeWorkspaceFoldersParams) error {
-	return unsupported()
+	for _, folder := range params.Event.Removed {
+		ls.workspace.RemoveFolder(lsp.DocumentURI(folder.URI))
+	}
+	for _, folder := range params.Event.Added {
+		ls.workspace.AddFolder(lsp.DocumentURI(folder.URI))
+	}
+	return nil
 }
 func (ls *LangServer) DidChangeConfiguration(ctx context.Context, params *lsp.DidChangeConfigurationParams) error {
 	return ls.settings.Read(params.Settings)
@@ -92,7 +122,7 @@ func (ls *LangServer) DidChangeWatchedFiles(ctx context.Context, params *lsp.Did
 	return unsupported()
 }
 func (ls *LangServer) Symbols(ctx context.Context, params *lsp.WorkspaceSymbolParams) ([]lsp.SymbolInformation, error) {
-	return nil, unsupported()
+	return ls.GetWorkspaceSymbols(params)
 }
 func (ls *LangServer) ExecuteCommand(ctx context.Context, params *lsp.ExecuteCommandParams) (interface{}, error) {
 	if params.Command == "activeDocument" {
@@ -103,6 +133,13 @@ func (ls *LangServer) ExecuteCommand(ctx context.Context, params *lsp.ExecuteCom
 			}
 		}
 	}
+	if params.Command == compileCommand {
+		if len(params.Arguments) == 1 {
+			if argstr, is := params.Arguments[0].(string); is {
+				return nil, ls.CompileDocument(ctx, lsp.DocumentURI(argstr))
+			}
+		}
+	}
 	return nil, unsupported()
 }
 func (ls *LangServer) DidOpen(ctx context.Context, params *lsp.DidOpenTextDocumentParams) error {
@@ -140,13 +177,13 @@ func (ls *LangServer) CompletionResolve(ctx context.Context, params *lsp.Complet
 	return nil, unsupported()
 }
 func (ls *LangServer) Hover(ctx context.Context, params *lsp.TextDocumentPositionParams) (*lsp.Hover, error) {
-	return nil, unsupported()
+	return ls.GetHover(params)
 }
 func (ls *LangServer) SignatureHelp(ctx context.Context, params *lsp.TextDocumentPositionParams) (*lsp.SignatureHelp, error) {
 	return nil, unsupported()
 }
 func (ls *LangServer) Definition(ctx context.Context, params *lsp.TextDocumentPositionParams) ([]lsp.Location, error) {
-	return nil, unsupported()
+	return ls.GetDefinition(params)
 }
 func (ls *LangServer) TypeDefinition(ctx context.Context, params *lsp.TextDocumentPositionParams) ([]lsp.Location, error) {
 	return nil, unsupported()
@@ -155,16 +192,16 @@ func (ls *LangServer) Implementation(ctx context.Context, params *lsp.TextDocume
 	return nil, unsupported()
 }
 func (ls *LangServer) References(ctx context.Context, params *lsp.ReferenceParams) ([]lsp.Location, error) {
-	return nil, unsupported()
+	return ls.GetReferences(params)
 }
 func (ls *LangServer) DocumentHighlight(ctx context.Context, params *lsp.TextDocumentPositionParams) ([]lsp.DocumentHighlight, error) {
 	return nil, unsupported()
 }
 func (ls *LangServer) DocumentSymbol(ctx context.Context, params *lsp.DocumentSymbolParams) ([]lsp.DocumentSymbol, error) {
-	return nil, unsupported()
+	return ls.GetDocumentSymbols(params)
 }
 func (ls *LangServer) CodeAction(ctx context.Context, params *lsp.CodeActionParams) ([]lsp.CodeAction, error) {
-	return nil, unsupported()
+	return ls.GetCodeActions(params)
 }
 func (ls *LangServer) CodeLens(ctx context.Context, params *lsp.CodeLensParams) ([]lsp.CodeLens, error) {
 	return nil, nil
@@ -193,8 +230,8 @@ func (ls *LangServer) RangeFormatting(ctx context.Context, params *lsp.DocumentR
 func (ls *LangServer) OnTypeFormatting(ctx context.Context, params *lsp.DocumentOnTypeFormattingParams) ([]lsp.TextEdit, error) {
 	return nil, unsupported()
 }
-func (ls *LangServer) Rename(ctx context.Context, params *lsp.RenameParams) ([]lsp.WorkspaceEdit, error) {
-	return nil, unsupported()
+func (ls *LangServer) Rename(ctx context.Context, params *lsp.RenameParams) (*lsp.WorkspaceEdit, error) {
+	return ls.GetRenameEdits(params)
 }
 func (ls *LangServer) FoldingRanges(ctx context.Context, params *lsp.FoldingRangeRequestParam) ([]lsp.FoldingRange, error) {
 	return nil, unsupported()
@@ -0,0 +1,98 @@
+package langserver
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dbaumgarten/yodk/pkg/lsp"
+)
+
+// testFiles is the content of the workspace used by the tests
+var testFiles = map[string]string{
+	"lib/util.nolol":  "include \"std/logic\"\ndefine limit = 5\nmacro inc(x) line\n\tx++\nend\n",
+	"main.nolol":      "include \"lib/util\"\nstart> :a = limit\ninc(:a)\nif :a < 10 then goto start end\nlogic_wait(:a > 1)\nx = 1\n",
+	"other.nolol":     "include \"lib/util\"\n:b = limit\n",
+	"unrelated.nolol": "limit = 3\n",
+	"chip.yolol":      ":a = :A + 1 x = 2\n",
+}
+
+// testClient is a lsp-client that signals every published diagnostic
+type testClient struct {
+	lsp.Client
+	published chan lsp.DocumentURI
+}
+
+func (c testClient) PublishDiagnostics(ctx context.Context, params *lsp.PublishDiagnosticsParams) error {
+	c.published <- params.URI
+	return nil
+}
+
+func (c testClient) ShowMessage(ctx context.Context, params *lsp.ShowMessageParams) error {
+	return nil
+}
+
+// newTestServer creates a langserver whose workspace contains the testFiles. All files are opened and diagnosed.
+// The returned function removes the workspace
+func newTestServer(t *testing.T) (*LangServer, string, func()) {
+	dir, err := ioutil.TempDir("", "yodk-langserver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cleanup := func() {
+		os.RemoveAll(dir)
+	}
+	for name, content := range testFiles {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			cleanup()
+			t.Fatal(err)
+		}
+	}
+
+	client := testClient{
+		published: make(chan lsp.DocumentURI),
+	}
+	s := &LangServer{
+		client:    client,
+		cache:     NewCache(),
+		settings:  DefaultSettings(),
+		workspace: NewWorkspace(),
+	}
+	s.workspace.AddFolder(getFileURI(dir))
+
+	for name, content := range testFiles {
+		uri := testURI(dir, name)
+		s.cache.Set(uri, content)
+		s.Diagnose(context.Background(), uri)
+		select {
+		case <-client.published:
+		case <-time.After(10 * time.Second):
+			cleanup()
+			t.Fatalf("Timeout while diagnosing %s", name)
+		}
+	}
+	return s, dir, cleanup
+}
+
+// testURI returns the uri of the given file of the test-workspace
+func testURI(dir string, name string) lsp.DocumentURI {
+	return getFileURI(filepath.Join(dir, filepath.FromSlash(name)))
+}
+
+// testPosition returns the params for the given position inside the given file of the test-workspace
+func testPosition(dir string, name string, line int, char int) lsp.TextDocumentPositionParams {
+	return lsp.TextDocumentPositionParams{
+		TextDocument: lsp.TextDocumentIdentifier{
+			URI: testURI(dir, name),
+		},
+		Position: lsp.Position{
+			Line:      float64(line),
+			Character: float64(char),
+		},
+	}
+}
@@ -0,0 +1,252 @@
+package langserver
+
+import (
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dbaumgarten/yodk/pkg/lsp"
+	"github.com/dbaumgarten/yodk/pkg/nolol"
+	"github.com/dbaumgarten/yodk/pkg/nolol/nast"
+	"github.com/dbaumgarten/yodk/pkg/parser"
+	"github.com/dbaumgarten/yodk/pkg/parser/ast"
+	"github.com/dbaumgarten/yodk/stdlib"
+)
+
+// GetDocumentSymbols returns the symbols of the given document.
+// For nolol these are macros, definitions, labels, loops and ifs (as a tree). For yolol these are the lines and the globals assigned in them.
+func (s *LangServer) GetDocumentSymbols(params *lsp.DocumentSymbolParams) ([]lsp.DocumentSymbol, error) {
+	uri := params.TextDocument.URI
+	text, err := s.cache.Get(uri)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasSuffix(string(uri), ".nolol") {
+		prog, err := nolol.NewParser().Parse(text)
+		if err != nil {
+			return nil, nil
+		}
+		elements := make([]ast.Node, len(prog.Elements))
+		for i, element := range prog.Elements {
+			elements[i] = element
+		}
+		return nololSymbols(text, elements), nil
+	} else if strings.HasSuffix(string(uri), ".yolol") {
+		prog, _ := parser.NewParser().Parse(text)
+		if prog == nil {
+			return nil, nil
+		}
+		return yololSymbols(text, prog), nil
+	}
+	return nil, nil
+}
+
+// nololSymbols returns the symbols for the given nolol-elements
+func nololSymbols(text string, elements []ast.Node) []lsp.DocumentSymbol {
+	symbols := make([]lsp.DocumentSymbol, 0)
+	printer := nolol.NewPrinter()
+	for _, element := range elements {
+		switch e := element.(type) {
+		case *nast.MacroDefinition:
+			symbol := newDocumentSymbol(text, e.Name, lsp.FunctionSymbol, e, e.Name)
+			symbol.Detail = macroSignature(e)
+			if block, isBlock := e.Code.(*nast.Block); isBlock {
+				symbol.Children = nololSymbols(text, blockElements(block))
+			}
+			symbols = append(symbols, symbol)
+		case *nast.Definition:
+			symbol := newDocumentSymbol(text, e.Name, lsp.ConstantSymbol, e, e.Name)
+			if value, err := printer.Print(e.Value); err == nil {
+				symbol.Detail = strings.TrimSpace(value)
+			}
+			symbols = append(symbols, symbol)
+		case *nast.StatementLine:
+			if e.Label != "" {
+				symbols = append(symbols, newDocumentSymbol(text, e.Label, lsp.KeySymbol, e, e.Label))
+			}
+		case *nast.WhileLoop:
+			symbol := newDocumentSymbol(text, "while", lsp.NamespaceSymbol, e, "while")
+			if condition, err := printer.Print(e.Condition); err == nil {
+				symbol.Name = "while " + strings.TrimSpace(condition)
+			}
+			symbol.Children = nololSymbols(text, blockElements(e.Block))
+			symbols = append(symbols, symbol)
+		case *nast.MultilineIf:
+			symbol := newDocumentSymbol(text, "if", lsp.NamespaceSymbol, e, "if")
+			if condition, err := printer.Print(e.Conditions[0]); err == nil {
+				symbol.Name = "if " + strings.TrimSpace(condition)
+			}
+			children := make([]ast.Node, 0)
+			for _, block := range e.Blocks {
+				children = append(children, blockElements(block)...)
+			}
+			if e.ElseBlock != nil {
+				children = append(children, blockElements(e.ElseBlock)...)
+			}
+			symbol.Children = nololSymbols(text, children)
+			symbols = append(symbols, symbol)
+		}
+	}
+	return symbols
+}
+
+// yololSymbols returns a symbol for every line of the program, containing the global variables assigned in that line
+func yololSymbols(text string, prog *ast.Program) []lsp.DocumentSymbol {
+	lines := strings.Split(text, "\n")
+	symbols := make([]lsp.DocumentSymbol, 0, len(prog.Lines))
+	for i, line := range prog.Lines {
+		if len(line.Statements) == 0 {
+			continue
+		}
+		symbol := lsp.DocumentSymbol{
+			Name:           "Line " + strconv.Itoa(i+1),
+			Kind:           lsp.NamespaceSymbol,
+			Range:          lineRange(lines, i),
+			SelectionRange: lineRange(lines, i),
+			Children:       make([]lsp.DocumentSymbol, 0),
+		}
+		if i < len(lines) {
+			symbol.Detail = strings.TrimSpace(lines[i])
+		}
+		assigned := make(map[string]bool)
+		line.Accept(ast.VisitorFunc(func(node ast.Node, visitType int) error {
+			if assignment, is := node.(*ast.Assignment); is && visitType == ast.PreVisit && strings.HasPrefix(assignment.Variable, ":") {
+				name := strings.ToLower(assignment.Variable)
+				if !assigned[name] {
+					assigned[name] = true
+					symbol.Children = append(symbol.Children, newDocumentSymbol(text, assignment.Variable, lsp.VariableSymbol, assignment, assignment.Variable))
+				}
+			}
+			return nil
+		}))
+		symbols = append(symbols, symbol)
+	}
+	return symbols
+}
+
+// GetWorkspaceSymbols returns all macros and definitions of the nolol-files in the workspace and the standard-library
+// whose name contains the query (case-insensitive)
+func (s *LangServer) GetWorkspaceSymbols(params *lsp.WorkspaceSymbolParams) ([]lsp.SymbolInformation, error) {
+	files := make([]string, 0)
+	for _, file := range s.workspace.Files() {
+		if strings.HasSuffix(file, ".nolol") {
+			files = append(files, file)
+		}
+	}
+	stdlibFiles := stdlib.AssetNames()
+	sort.Strings(stdlibFiles)
+	for _, file := range stdlibFiles {
+		files = append(files, stdlib.Prefix+file)
+	}
+
+	query := strings.ToLower(params.Query)
+	symbols := make([]lsp.SymbolInformation, 0)
+	for _, file := range files {
+		text, err := s.readFile(file)
+		if err != nil {
+			continue
+		}
+		prog, err := nolol.NewParser().Parse(text)
+		if err != nil {
+			continue
+		}
+		container := filepath.Base(file)
+		if stdlib.Is(file) {
+			container = strings.TrimSuffix(file, ".nolol")
+		}
+		for _, element := range prog.Elements {
+			var name string
+			var kind lsp.SymbolKind
+			switch e := element.(type) {
+			case *nast.MacroDefinition:
+				name = e.Name
+				kind = lsp.FunctionSymbol
+			case *nast.Definition:
+				name = e.Name
+				kind = lsp.ConstantSymbol
+			default:
+				continue
+			}
+			if !strings.Contains(strings.ToLower(name), query) {
+				continue
+			}
+			uri, err := s.getURI(file)
+			if err != nil {
+				continue
+			}
+			symbol := newDocumentSymbol(text, name, kind, element, name)
+			symbols = append(symbols, lsp.SymbolInformation{
+				Name: name,
+				Kind: float64(kind),
+				Location: lsp.Location{
+					URI:   uri,
+					Range: symbol.SelectionRange,
+				},
+				ContainerName: container,
+			})
+		}
+	}
+	return symbols, nil
+}
+
+// newDocumentSymbol creates a symbol for the given node. The selection-range of the symbol is the first mentioning
+// of selection (an identifier or keyword) inside the node
+func newDocumentSymbol(text string, name string, kind lsp.SymbolKind, node ast.Node, selection string) lsp.DocumentSymbol {
+	start := node.Start()
+	end := node.End()
+	if end.Before(start) {
+		end = start
+	}
+	symbolRange := lsp.Range{
+		Start: lsp.Position{Line: float64(start.Line - 1), Character: float64(start.Coloumn - 1)},
+		End:   lsp.Position{Line: float64(end.Line - 1), Character: float64(end.Coloumn - 1)},
+	}
+	selectionRange := lsp.Range{
+		Start: symbolRange.Start,
+		End:   symbolRange.Start,
+	}
+	lines := strings.Split(text, "\n")
+	if start.Line-1 < len(lines) {
+		line := strings.ToLower(lines[start.Line-1])
+		if start.Coloumn-1 <= len(line) {
+			if idx := strings.Index(line[start.Coloumn-1:], strings.ToLower(selection)); idx >= 0 {
+				selectionRange.Start.Character = float64(start.Coloumn - 1 + idx)
+				selectionRange.End.Character = selectionRange.Start.Character + float64(len(selection))
+			}
+		}
+	}
+	if symbolRange.End.Line == symbolRange.Start.Line && symbolRange.End.Character < selectionRange.End.Character {
+		symbolRange.End = selectionRange.End
+	}
+	return lsp.DocumentSymbol{
+		Name:           name,
+		Kind:           kind,
+		Range:          symbolRange,
+		SelectionRange: selectionRange,
+	}
+}
+
+// blockElements returns the elements of the given block
+func blockElements(block *nast.Block) []ast.Node {
+	if block == nil {
+		return []ast.Node{}
+	}
+	elements := make([]ast.Node, len(block.Elements))
+	for i, element := range block.Elements {
+		elements[i] = element
+	}
+	return elements
+}
+
+// lineRange returns the range covering the given (zero-based) line
+func lineRange(lines []string, line int) lsp.Range {
+	length := 0
+	if line < len(lines) {
+		length = len(strings.TrimRight(lines[line], "\r"))
+	}
+	return lsp.Range{
+		Start: lsp.Position{Line: float64(line)},
+		End:   lsp.Position{Line: float64(line), Character: float64(length)},
+	}
+}
@@ -0,0 +1,95 @@
+package langserver
+
+import (
+	"testing"
+
+	"github.com/dbaumgarten/yodk/pkg/lsp"
+)
+
+func TestGetDocumentSymbols(t *testing.T) {
+	s, dir, cleanup := newTestServer(t)
+	defer cleanup()
+
+	getSymbols := func(name string) []lsp.DocumentSymbol {
+		symbols, err := s.GetDocumentSymbols(&lsp.DocumentSymbolParams{
+			TextDocument: lsp.TextDocumentIdentifier{
+				URI: testURI(dir, name),
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return symbols
+	}
+
+	symbols := getSymbols("lib/util.nolol")
+	if len(symbols) != 2 {
+		t.Fatalf("Expected 2 symbols, but got %v", symbols)
+	}
+	if symbols[0].Name != "limit" || symbols[0].Kind != lsp.ConstantSymbol || symbols[0].Detail != "5" || symbols[0].SelectionRange.Start.Line != 1 {
+		t.Fatalf("Wrong symbol for definition: %v", symbols[0])
+	}
+	if symbols[1].Name != "inc" || symbols[1].Kind != lsp.FunctionSymbol || symbols[1].Detail != "macro inc(x) line" {
+		t.Fatalf("Wrong symbol for macro: %v", symbols[1])
+	}
+	if symbols[1].SelectionRange.Start.Character != 6 || symbols[1].SelectionRange.End.Character != 9 {
+		t.Fatalf("Wrong selection-range for macro: %v", symbols[1].SelectionRange)
+	}
+
+	symbols = getSymbols("main.nolol")
+	found := false
+	for _, symbol := range symbols {
+		if symbol.Name == "start" && symbol.Kind == lsp.KeySymbol && symbol.SelectionRange.Start.Line == 1 {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("Expected a symbol for label start, but got %v", symbols)
+	}
+
+	symbols = getSymbols("chip.yolol")
+	if len(symbols) != 1 || symbols[0].Name != "Line 1" {
+		t.Fatalf("Expected one symbol for the yolol-line, but got %v", symbols)
+	}
+	if len(symbols[0].Children) != 1 || symbols[0].Children[0].Name != ":a" {
+		t.Fatalf("Expected the assigned global as child, but got %v", symbols[0].Children)
+	}
+}
+
+func TestGetWorkspaceSymbols(t *testing.T) {
+	s, dir, cleanup := newTestServer(t)
+	defer cleanup()
+
+	cases := []struct {
+		query string
+		// the containers of the expected symbols
+		expected map[string]string
+	}{
+		{"limit", map[string]string{"limit": "util.nolol"}},
+		{"INC", map[string]string{"inc": "util.nolol"}},
+		{"logic_wait", map[string]string{"logic_wait": "std/logic"}},
+	}
+
+	for _, c := range cases {
+		symbols, err := s.GetWorkspaceSymbols(&lsp.WorkspaceSymbolParams{Query: c.query})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, container := range c.expected {
+			found := false
+			for _, symbol := range symbols {
+				if symbol.Name == name && symbol.ContainerName == container {
+					found = true
+				}
+			}
+			if !found {
+				t.Fatalf("Expected symbol %s in %s for query '%s', but got %v", name, container, c.query, symbols)
+			}
+		}
+		for _, symbol := range symbols {
+			if symbol.Location.URI == testURI(dir, "unrelated.nolol") {
+				t.Fatalf("Assignments must not be reported as symbols: %v", symbol)
+			}
+		}
+	}
+}
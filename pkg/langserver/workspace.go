@@ -0,0 +1,161 @@
+package langserver
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/dbaumgarten/yodk/pkg/lsp"
+	"github.com/dbaumgarten/yodk/stdlib"
+)
+
+// Workspace keeps track of the folders that are opened in the editor
+type Workspace struct {
+	folders []string
+	lock    *sync.Mutex
+}
+
+// NewWorkspace returns a new, empty workspace
+func NewWorkspace() *Workspace {
+	return &Workspace{
+		folders: make([]string, 0),
+		lock:    &sync.Mutex{},
+	}
+}
+
+// AddFolder adds the folder with the given uri to the workspace
+func (w *Workspace) AddFolder(uri lsp.DocumentURI) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	path := getFilePath(uri)
+	for _, folder := range w.folders {
+		if folder == path {
+			return
+		}
+	}
+	w.folders = append(w.folders, path)
+}
+
+// RemoveFolder removes the folder with the given uri from the workspace
+func (w *Workspace) RemoveFolder(uri lsp.DocumentURI) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	path := getFilePath(uri)
+	for i, folder := range w.folders {
+		if folder == path {
+			w.folders = append(w.folders[:i], w.folders[i+1:]...)
+			return
+		}
+	}
+}
+
+// Files returns the sorted paths of all yolol- and nolol-files inside the workspace-folders. Hidden directories are skipped
+func (w *Workspace) Files() []string {
+	w.lock.Lock()
+	folders := make([]string, len(w.folders))
+	copy(folders, w.folders)
+	w.lock.Unlock()
+
+	found := make(map[string]bool)
+	for _, folder := range folders {
+		filepath.Walk(folder, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return nil
+			}
+			if info.IsDir() {
+				if path != folder && strings.HasPrefix(info.Name(), ".") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if strings.HasSuffix(path, ".yolol") || strings.HasSuffix(path, ".nolol") {
+				found[path] = true
+			}
+			return nil
+		})
+	}
+
+	files := make([]string, 0, len(found))
+	for file := range found {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	return files
+}
+
+// getFileURI is the inverse of getFilePath
+func getFileURI(path string) lsp.DocumentURI {
+	path = filepath.ToSlash(path)
+	if !strings.HasPrefix(path, "/") {
+		// windows-paths start with a drive-letter
+		path = "/" + path
+	}
+	u := url.URL{
+		Scheme: "file",
+		Path:   path,
+	}
+	return lsp.DocumentURI(u.String())
+}
+
+// openDocument returns the uri of the opened document with the given path
+func (s *LangServer) openDocument(path string) (lsp.DocumentURI, bool) {
+	s.cache.Lock.Lock()
+	defer s.cache.Lock.Unlock()
+	for uri := range s.cache.Files {
+		if getFilePath(uri) == path {
+			return uri, true
+		}
+	}
+	return "", false
+}
+
+// readFile returns the content of the file with the given path. If the file is opened in the editor, the (possibly unsaved) content
+// of the editor is returned. Files of the standard-library can be read using their names (like std/logic.nolol)
+func (s *LangServer) readFile(path string) (string, error) {
+	if stdlib.Is(path) {
+		return stdlib.Get(path)
+	}
+	if uri, isOpen := s.openDocument(path); isOpen {
+		return s.cache.Get(uri)
+	}
+	content, err := ioutil.ReadFile(path)
+	return string(content), err
+}
+
+// getURI returns the uri for the file with the given path. For opened documents the uri used by the editor is returned.
+// As the editor can not open the embedded files of the standard-library, these files are written to a temporary directory.
+func (s *LangServer) getURI(path string) (lsp.DocumentURI, error) {
+	if stdlib.Is(path) {
+		extracted, err := extractStdlibFile(path)
+		if err != nil {
+			return "", err
+		}
+		return getFileURI(extracted), nil
+	}
+	if uri, isOpen := s.openDocument(path); isOpen {
+		return uri, nil
+	}
+	return getFileURI(path), nil
+}
+
+// extractStdlibFile writes the given file of the standard-library to a temporary directory and returns its path
+func extractStdlibFile(name string) (string, error) {
+	content, err := stdlib.Get(name)
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(os.TempDir(), "yodk-stdlib", filepath.FromSlash(name))
+	existing, err := ioutil.ReadFile(path)
+	if err == nil && string(existing) == content {
+		return path, nil
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return "", err
+	}
+	return path, ioutil.WriteFile(path, []byte(content), 0644)
+}
@@ -690,14 +690,14 @@ type CodeAction struct {
 	/**
 	 * The workspace edit this code action performs.
 	 */
-	Edit WorkspaceEdit `json:"edit,omitempty"`
+	Edit *WorkspaceEdit `json:"edit,omitempty"`
 
 	/**
 	 * A command this code action executes. If a code action
 	 * provides an edit and a command, first the edit is
 	 * executed and then the command.
 	 */
-	Command Command `json:"command,omitempty"`
+	Command *Command `json:"command,omitempty"`
 }
 
 type CodeLensParams struct {
@@ -723,7 +723,7 @@ type CodeLens struct {
 	/**
 	 * The command this code lens represents.
 	 */
-	Command Command `json:"command,omitempty"`
+	Command *Command `json:"command,omitempty"`
 
 	/**
 	 * A data entry field that is preserved on a code lens item between
@@ -41,6 +41,8 @@ func Analyse(prog *nast.Program) (*AnalysisReport, error) {
 			if prevDocstrings != "" {
 				res.Docstrings[n.Name] = prevDocstrings
 			}
+			// the docstring belongs to this element only
+			prevDocstrings = ""
 			return ast.NewNodeReplacementSkip()
 		case *nast.MacroDefinition:
 			isStartOfFile = false
@@ -48,6 +50,8 @@ func Analyse(prog *nast.Program) (*AnalysisReport, error) {
 			if prevDocstrings != "" {
 				res.Docstrings[n.Name] = prevDocstrings
 			}
+			// the docstring belongs to this element only
+			prevDocstrings = ""
 			return ast.NewNodeReplacementSkip()
 		case *ast.Assignment:
 			isStartOfFile = false
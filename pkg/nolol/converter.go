@@ -45,6 +45,13 @@ type Converter struct {
 	// if true, enable debug-logging
 	debug          bool
 	targetChipType string
+	// the name of the main file that is converted
+	mainFile string
+	// information about the included files, indexed by the file-name used in the positions of the included nodes.
+	// Used to generate source-maps
+	includes map[string]includeInfo
+	// for every node produced by a macro-insertion the stack of insertions (innermost first). Used to generate source-maps
+	macroExpansions map[ast.Node][]MacroExpansion
 }
 
 // NewConverter creates a new converter
@@ -59,6 +66,8 @@ func NewConverter() ConverterEmpty {
 		varnameOptimizer: optimizers.NewVariableNameOptimizer(),
 		loopLevel:        make([]loopinfo, 0),
 		targetChipType:   validators.ChipTypeAuto,
+		includes:         make(map[string]includeInfo),
+		macroExpansions:  make(map[ast.Node][]MacroExpansion),
 	}
 }
 
@@ -111,6 +120,7 @@ func (c *Converter) LoadFile(mainfile string) ConverterIncludes {
 // LoadFileEx acts like LoadFile, but allows the passing of a custom filesystem from which the source files
 // are retrieved. This way, files that are not stored on disk can be converted
 func (c *Converter) LoadFileEx(mainfile string, files FileSystem) ConverterIncludes {
+	c.mainFile = mainfile
 	file, err := files.Get(mainfile)
 	if err != nil {
 		c.err = err
@@ -243,7 +253,7 @@ func (c *Converter) ProcessNodes() ConverterLines {
 	c.varnameOptimizer.InitializeByFrequency(c.prog, blacklist)
 
 	// convert the remaining nodes to yolol
-	f := func(node ast.Node, visitType int) error {
+	convert := func(node ast.Node, visitType int) error {
 		switch n := node.(type) {
 
 		case *nast.FuncCall:
@@ -279,6 +289,9 @@ func (c *Converter) ProcessNodes() ConverterLines {
 
 		return nil
 	}
+	f := func(node ast.Node, visitType int) error {
+		return c.inheritMacroExpansions(node, convert(node, visitType))
+	}
 	c.err = c.prog.Accept(ast.VisitorFunc(f))
 	return c
 }
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/dbaumgarten/yodk/pkg/nolol/nast"
@@ -28,13 +29,15 @@ func (c *Converter) convertInclude(include *nast.IncludeDirective) error {
 	filesnames := make([]string, 1)
 	filesnames[0] = include.File
 
-	file, err := c.getIncludedFile(include)
+	file, filename, err := c.getIncludedFile(include)
 	if err != nil {
 		return err
 	}
 
+	// the nodes of the included file are named after the resolved file, as the same directive can refer to different files
+	// (depending on the directory of the including file)
 	p := NewParser().(*Parser)
-	p.SetFilename(include.File)
+	p.SetFilename(filename)
 	parsed, err := p.Parse(file)
 	if err != nil {
 		// override the position of the error with the position of the include
@@ -47,6 +50,13 @@ func (c *Converter) convertInclude(include *nast.IncludeDirective) error {
 		}
 	}
 
+	if _, exists := c.includes[filename]; !exists {
+		c.includes[filename] = includeInfo{
+			Filename: filename,
+			From:     include.Start(),
+		}
+	}
+
 	if usesTimeTracking(parsed) {
 		c.usesTimeTracking = true
 	}
@@ -58,7 +68,8 @@ func (c *Converter) convertInclude(include *nast.IncludeDirective) error {
 	return ast.NewNodeReplacement(replacements...)
 }
 
-func (c *Converter) getIncludedFile(include *nast.IncludeDirective) (string, error) {
+// getIncludedFile returns the content and the name of the file that is included by the given directive
+func (c *Converter) getIncludedFile(include *nast.IncludeDirective) (string, string, error) {
 
 	importname := include.File
 	getfunc := c.files.Get
@@ -87,33 +98,60 @@ func (c *Converter) getIncludedFile(include *nast.IncludeDirective) (string, err
 	// first try to import exact file
 	file, origerr := getfunc(filename)
 	if origerr == nil {
-		return file, nil
+		return file, filename, nil
 	}
 
 	// next try all available chip-specific imports
 	switch c.targetChipType {
 	case validators.ChipTypeProfessional:
-		file, err := getfunc(importname + "_" + validators.ChipTypeProfessional + ".nolol")
+		filename := importname + "_" + validators.ChipTypeProfessional + ".nolol"
+		file, err := getfunc(filename)
 		if err == nil {
-			return file, nil
+			return file, filename, nil
 		}
 		fallthrough
 	case validators.ChipTypeAdvanced:
-		file, err := getfunc(importname + "_" + validators.ChipTypeAdvanced + ".nolol")
+		filename := importname + "_" + validators.ChipTypeAdvanced + ".nolol"
+		file, err := getfunc(filename)
 		if err == nil {
-			return file, nil
+			return file, filename, nil
 		}
 		fallthrough
 	case validators.ChipTypeBasic:
-		file, err := getfunc(importname + "_" + validators.ChipTypeBasic + ".nolol")
+		filename := importname + "_" + validators.ChipTypeBasic + ".nolol"
+		file, err := getfunc(filename)
 		if err == nil {
-			return file, nil
+			return file, filename, nil
 		}
 	}
 
-	return "", &parser.Error{
+	return "", "", &parser.Error{
 		Message:       fmt.Sprintf("Error when opening included file '%s': %s", importname, origerr.Error()),
 		StartPosition: include.Start(),
 		EndPosition:   include.End(),
 	}
 }
+
+// GetIncludedFiles returns the sorted names of all files that have been included while converting the program.
+// The names are relative to the FileSystem the program has been loaded from. Files of the standard-library are omitted
+func (c *Converter) GetIncludedFiles() []string {
+	files := make([]string, 0, len(c.includes))
+	for _, info := range c.includes {
+		if !stdlib.Is(info.Filename) {
+			files = append(files, info.Filename)
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+// GetIncludes returns for every included file the name of the file.
+// The keys are the file-names used as File in the positions of the included nodes.
+// The values are relative to the FileSystem the program has been loaded from, or are the names of files of the standard-library.
+func (c *Converter) GetIncludes() map[string]string {
+	includes := make(map[string]string, len(c.includes))
+	for name, info := range c.includes {
+		includes[name] = info.Filename
+	}
+	return includes
+}
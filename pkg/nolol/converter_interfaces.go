@@ -26,6 +26,7 @@ type ConverterIncludes interface {
 // ConverterExpansions is part of the Sequenced-Builder-Pattern of the Converter
 type ConverterExpansions interface {
 	ProcessCodeExpansion() ConverterNodes
+	GetIncludes() map[string]string
 	Error() error
 	GetIntermediateProgram() *nast.Program
 }
@@ -55,6 +56,9 @@ type ConverterFinal interface {
 type ConverterDone interface {
 	Get() (*ast.Program, error)
 	GetVariableTranslations() map[string]string
+	GetSourceMap() *SourceMap
+	GetIncludedFiles() []string
+	GetIncludes() map[string]string
 	Error() error
 	GetIntermediateProgram() *nast.Program
 }
@@ -160,6 +160,7 @@ func (c *Converter) convertMacroInsertion(ins *nast.FuncCall, visitType int) err
 		if err != nil {
 			return err
 		}
+		c.recordMacroExpansion(ins, result)
 
 		// Replace the funccall with an InsertedMacro, which will later be replaced with the actual code
 		// We do not directly insert the actual code, because we need to get the chance to have a PostVisit on the inserted code
@@ -0,0 +1,264 @@
+package nolol
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/dbaumgarten/yodk/pkg/nolol/nast"
+	"github.com/dbaumgarten/yodk/pkg/parser"
+	"github.com/dbaumgarten/yodk/pkg/parser/ast"
+)
+
+// SourceMapVersion is the version of the source-map format. It is increased on incompatible changes
+const SourceMapVersion = 1
+
+// SourceLocation is a position inside a nolol-file
+type SourceLocation struct {
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+}
+
+// String returns the location in the form file:line:column
+func (l SourceLocation) String() string {
+	return fmt.Sprintf("%s:%d:%d", l.File, l.Line, l.Column)
+}
+
+// MacroExpansion is the insertion of a macro into the code
+type MacroExpansion struct {
+	// The name of the inserted macro
+	Macro string `json:"macro"`
+	// The location of the insertion
+	SourceLocation
+}
+
+// SourceMapping maps a statement of the generated yolol-code to its origin in the nolol-code
+type SourceMapping struct {
+	// The position of the statement in the generated yolol-code (as printed by the compact printer, 1-indexed)
+	YololLine   int `json:"yololLine"`
+	YololColumn int `json:"yololColumn"`
+	// The origin of the statement
+	SourceLocation
+	// The include-directives that caused the file of the statement to be included. The innermost include comes first
+	Includes []SourceLocation `json:"includes,omitempty"`
+	// The macro-insertions that produced the statement. The innermost insertion comes first
+	Macros []MacroExpansion `json:"macros,omitempty"`
+}
+
+// String returns a human-readable description of the origin of the statement
+func (m SourceMapping) String() string {
+	txt := m.SourceLocation.String()
+	for _, macro := range m.Macros {
+		txt += fmt.Sprintf(", in macro %s inserted at %s", macro.Macro, macro.SourceLocation)
+	}
+	for _, include := range m.Includes {
+		txt += fmt.Sprintf(", included at %s", include)
+	}
+	return txt
+}
+
+// SourceMap maps the statements of the generated yolol-code to their origin in the nolol-code
+type SourceMap struct {
+	Version int `json:"version"`
+	// The nolol-file that has been compiled
+	File string `json:"file"`
+	// One mapping for every statement of the yolol-code, ordered by their position in the yolol-code
+	Mappings []SourceMapping `json:"mappings"`
+	// maps the file-names used in the positions of the ast to the names of the actual files
+	astFiles map[string]string
+}
+
+// Save writes the source-map as json into the given file
+func (s *SourceMap) Save(filename string) error {
+	content, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, content, 0700)
+}
+
+// LoadSourceMap reads a source-map from the given file
+func LoadSourceMap(filename string) (*SourceMap, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var s SourceMap
+	err = json.Unmarshal(content, &s)
+	if err != nil {
+		return nil, err
+	}
+	if s.Version != SourceMapVersion {
+		return nil, fmt.Errorf("Unsupported source-map version %d. Expected version %d", s.Version, SourceMapVersion)
+	}
+	return &s, nil
+}
+
+// Lookup returns the mapping of the statement at the given position of the generated yolol-code
+// The statement at the position is the last statement of the line that starts at or before the given column
+func (s *SourceMap) Lookup(yololLine int, yololColumn int) (SourceMapping, bool) {
+	var found SourceMapping
+	exists := false
+	for _, m := range s.Mappings {
+		if m.YololLine == yololLine && m.YololColumn <= yololColumn {
+			found = m
+			exists = true
+		}
+	}
+	return found, exists
+}
+
+// Find returns the mapping for the statement on the given line of the generated yolol-code, that contains pos.
+// pos is a position inside the nolol-code, as it is stored inside the nodes of the generated yolol-ast.
+// This can be used to find the origin of a runtime-error
+func (s *SourceMap) Find(yololLine int, pos ast.Position) (SourceMapping, bool) {
+	file := pos.File
+	if file == "" {
+		file = s.File
+	} else if actual, exists := s.astFiles[file]; exists {
+		file = actual
+	}
+	var found *SourceMapping
+	for i, m := range s.Mappings {
+		if m.YololLine != yololLine || m.File != file {
+			continue
+		}
+		// the statement containing pos is the one that starts last before pos
+		if m.Line > pos.Line || (m.Line == pos.Line && m.Column > pos.Coloumn) {
+			continue
+		}
+		if found == nil || m.Line > found.Line || (m.Line == found.Line && m.Column > found.Column) {
+			found = &s.Mappings[i]
+		}
+	}
+	if found == nil {
+		return SourceMapping{}, false
+	}
+	return *found, true
+}
+
+// GetSourceMap returns a source-map for the converted program.
+// The yolol-positions in the map refer to the code generated by the compact printer (like 'yodk compile' does)
+func (c *Converter) GetSourceMap() *SourceMap {
+	sm := &SourceMap{
+		Version:  SourceMapVersion,
+		File:     c.mainFile,
+		Mappings: make([]SourceMapping, 0),
+		astFiles: make(map[string]string),
+	}
+	for name, include := range c.includes {
+		sm.astFiles[name] = include.Filename
+	}
+	if c.convertedProg == nil {
+		return sm
+	}
+
+	printer := parser.Printer{}
+	for i, line := range c.convertedProg.Lines {
+		for j, stmt := range line.Statements {
+			if stmt.Start() == ast.UnknownPosition {
+				continue
+			}
+			column := 1
+			if j > 0 {
+				// the statement starts after the previous statements and a separating space
+				previous, err := printer.Print(&ast.Line{
+					Statements: line.Statements[:j],
+				})
+				if err != nil {
+					continue
+				}
+				column = len(strings.TrimSuffix(previous, "\n")) + 2
+			}
+			sm.Mappings = append(sm.Mappings, SourceMapping{
+				YololLine:      i + 1,
+				YololColumn:    column,
+				SourceLocation: c.sourceLocation(stmt.Start()),
+				Includes:       c.includeChain(stmt.Start().File),
+				Macros:         c.macroExpansions[stmt],
+			})
+		}
+	}
+	return sm
+}
+
+// includeInfo stores where a file has been included from
+type includeInfo struct {
+	// the actual name of the included file
+	Filename string
+	// the position of the first include-directive that included the file
+	From ast.Position
+}
+
+// sourceLocation converts an ast-position to a SourceLocation
+func (c *Converter) sourceLocation(pos ast.Position) SourceLocation {
+	file := pos.File
+	if file == "" {
+		file = c.mainFile
+	} else if include, exists := c.includes[file]; exists {
+		file = include.Filename
+	}
+	return SourceLocation{
+		File:   file,
+		Line:   pos.Line,
+		Column: pos.Coloumn,
+	}
+}
+
+// includeChain returns the locations of the include-directives that lead to the inclusion of the given file
+func (c *Converter) includeChain(file string) []SourceLocation {
+	var chain []SourceLocation
+	for file != "" && len(chain) <= c.includecount {
+		include, exists := c.includes[file]
+		if !exists {
+			break
+		}
+		chain = append(chain, c.sourceLocation(include.From))
+		file = include.From.File
+	}
+	return chain
+}
+
+// recordMacroExpansion remembers for all nodes of the expanded code, that they have been produced by the given insertion
+func (c *Converter) recordMacroExpansion(ins *nast.FuncCall, expanded ast.Node) {
+	stack := []MacroExpansion{
+		{
+			Macro:          ins.Function,
+			SourceLocation: c.sourceLocation(ins.Start()),
+		},
+	}
+	// the insertion itself may be part of the code of another macro
+	stack = append(stack, c.macroExpansions[ins]...)
+	expanded.Accept(ast.VisitorFunc(func(node ast.Node, visitType int) error {
+		if visitType == ast.PreVisit || visitType == ast.SingleVisit {
+			c.macroExpansions[node] = stack
+		}
+		return nil
+	}))
+}
+
+// inheritMacroExpansions makes sure that nodes that replace a node produced by a macro-insertion are also marked as produced by that insertion.
+// result is the value returned by the visitor-function for node. It is returned unchanged
+func (c *Converter) inheritMacroExpansions(node ast.Node, result error) error {
+	repl, isReplacement := result.(ast.NodeReplacement)
+	if !isReplacement {
+		return result
+	}
+	stack, exists := c.macroExpansions[node]
+	if !exists {
+		return result
+	}
+	for _, replacement := range repl.Replacement {
+		replacement.Accept(ast.VisitorFunc(func(node ast.Node, visitType int) error {
+			if visitType == ast.PreVisit || visitType == ast.SingleVisit {
+				if _, exists := c.macroExpansions[node]; !exists {
+					c.macroExpansions[node] = stack
+				}
+			}
+			return nil
+		}))
+	}
+	return result
+}
@@ -0,0 +1,103 @@
+package nolol_test
+
+import (
+	"testing"
+
+	"github.com/dbaumgarten/yodk/pkg/nolol"
+	"github.com/dbaumgarten/yodk/pkg/parser/ast"
+)
+
+var sourceMapFs = nolol.MemoryFileSystem{
+	"main.nolol": `include "lib"
+:a=1
+setb()
+`,
+	"lib.nolol": `macro setb() block
+	:b=:a+1
+end
+`,
+}
+
+func TestSourceMap(t *testing.T) {
+	conv := nolol.NewConverter().LoadFileEx("main.nolol", sourceMapFs).RunConversion()
+	_, err := conv.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm := conv.GetSourceMap()
+
+	if sm.Version != nolol.SourceMapVersion || sm.File != "main.nolol" {
+		t.Fatalf("Wrong header of source-map: %d %s", sm.Version, sm.File)
+	}
+
+	main, found := sm.Lookup(1, 1)
+	if !found {
+		t.Fatal("No mapping for the first statement")
+	}
+	if main.File != "main.nolol" || main.Line != 2 || main.Column != 1 || len(main.Macros) != 0 {
+		t.Fatalf("Wrong mapping for the first statement: %s", main)
+	}
+
+	// ':a=1' is 4 characters long. The statement produced by the macro starts after a separating space
+	inserted, found := sm.Lookup(1, 6)
+	if !found {
+		t.Fatal("No mapping for the inserted statement")
+	}
+	if inserted.YololColumn != 6 || inserted.File != "lib.nolol" || inserted.Line != 2 {
+		t.Fatalf("Wrong mapping for the inserted statement: %s", inserted)
+	}
+	if len(inserted.Macros) != 1 || inserted.Macros[0].Macro != "setb" || inserted.Macros[0].File != "main.nolol" || inserted.Macros[0].Line != 3 {
+		t.Fatalf("Wrong macro-stack for the inserted statement: %s", inserted)
+	}
+	if len(inserted.Includes) != 1 || inserted.Includes[0].Line != 1 {
+		t.Fatalf("Wrong include-chain for the inserted statement: %s", inserted)
+	}
+
+	// positions of nodes inside the statement are mapped to the statement
+	found2, _ := sm.Find(1, ast.NewPosition("lib.nolol", 2, 6))
+	if found2.YololColumn != 6 {
+		t.Fatalf("Find() returned the wrong statement: %s", found2)
+	}
+}
+
+var sameNameFs = nolol.MemoryFileSystem{
+	"main.nolol": `include "util"
+include "sub/x"
+:a=1
+`,
+	"util.nolol": `:b=2
+`,
+	"sub/x.nolol": `include "util"
+`,
+	"sub/util.nolol": `:c=3
+`,
+}
+
+func TestIncludesWithSameName(t *testing.T) {
+	conv := nolol.NewConverter().LoadFileEx("main.nolol", sameNameFs).RunConversion()
+	_, err := conv.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	included := conv.GetIncludedFiles()
+	expected := []string{"sub/util.nolol", "sub/x.nolol", "util.nolol"}
+	if len(included) != len(expected) {
+		t.Fatalf("Expected included files %v, but got %v", expected, included)
+	}
+	for i := range expected {
+		if included[i] != expected[i] {
+			t.Fatalf("Expected included files %v, but got %v", expected, included)
+		}
+	}
+
+	// the statements are attributed to the file they have actually been read from
+	sm := conv.GetSourceMap()
+	files := make(map[string]int)
+	for _, m := range sm.Mappings {
+		files[m.File] = m.Line
+	}
+	if files["util.nolol"] != 1 || files["sub/util.nolol"] != 1 || files["main.nolol"] != 3 {
+		t.Fatalf("Wrong files in the source-map: %v", sm.Mappings)
+	}
+}
@@ -66,6 +66,7 @@ type YololParserFunctions interface {
 // YololParser is an interface that hides all overridable-methods from normal users
 type YololParser interface {
 	Parse(prog string) (*ast.Program, error)
+	ParseExpressionString(expr string) (ast.Expression, error)
 	SetDebugLog(b bool)
 	SetAllErrors(b bool)
 }
@@ -236,6 +237,42 @@ func (p *Parser) Parse(prog string) (*ast.Program, error) {
 	return parsed, nil
 }
 
+// ParseExpressionString parses a single yolol-expression (for example a condition entered by a user)
+func (p *Parser) ParseExpressionString(expr string) (ast.Expression, error) {
+	p.Reset()
+	p.Tokenizer.Load(expr)
+
+	// Advance once to fill CurrentToken
+	p.Advance()
+	parsed := p.This.ParseExpression()
+	if parsed == nil {
+		p.ErrorExpectedExpression("")
+	} else if p.HasNext() {
+		p.ErrorString("Expected end of expression", ErrExpectedToken)
+	}
+	if len(p.Errors) != 0 {
+		return nil, p.Errors
+	}
+
+	validationErrors := Validate(parsed, ValidateAll)
+	p.Errors = append(p.Errors, validationErrors...)
+	if len(p.Errors) != 0 {
+		return nil, p.Errors
+	}
+
+	// the root-node itself can not be replaced by RemoveParenthesis
+	for {
+		unar, is := parsed.(*ast.UnaryOperation)
+		if !is || unar.Operator != "()" {
+			break
+		}
+		parsed = unar.Exp
+	}
+	RemoveParenthesis(parsed)
+
+	return parsed, nil
+}
+
 // ParseProgram parses a programm-node
 func (p *Parser) ParseProgram() *ast.Program {
 	p.Log()
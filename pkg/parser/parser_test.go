@@ -76,3 +76,20 @@ func TestNodePositions(t *testing.T) {
 
 	result.Accept(&tester)
 }
+
+func TestParseExpressionString(t *testing.T) {
+	p := parser.NewParser()
+
+	expr, err := p.ParseExpressionString("(a + :b) * 2 > 3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, is := expr.(*ast.BinaryOperation); !is {
+		t.Fatalf("Expected a binary operation, but got %T", expr)
+	}
+
+	_, err = p.ParseExpressionString("a + b c")
+	if err == nil {
+		t.Fatal("Trailing tokens after the expression must result in an error")
+	}
+}
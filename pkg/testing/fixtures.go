@@ -0,0 +1,233 @@
+package testing
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Fixture is a yaml-file with setup-values and cases that can be imported by tests
+type Fixture struct {
+	// Other fixture-files to import. Paths are relative to the fixture-file
+	Imports []string
+	// Values of global variables that are set before every case of the importing test
+	Setup map[string]interface{}
+	// Cases that are added to the importing test
+	Cases []Case
+	// the paths of this fixture-file and all files imported by it
+	files []string
+}
+
+// placeholderRegex matches the placeholders for parameters, like {name}
+var placeholderRegex = regexp.MustCompile(`\{([a-zA-Z0-9_]+)\}`)
+
+// resolveFixtures imports the fixtures of the test, expands parameterized cases and merges the setup into all cases
+func (t *Test) resolveFixtures() error {
+	setup := make(map[string]interface{})
+	cases := make([]Case, 0, len(t.Cases))
+	dir := filepath.Dir(t.Path)
+	for _, imp := range t.Imports {
+		fixture, err := loadFixture(filepath.Join(dir, imp), []string{t.Path})
+		if err != nil {
+			return err
+		}
+		mergeInputs(setup, fixture.Setup)
+		cases = append(cases, fixture.Cases...)
+		t.fixtureFiles = append(t.fixtureFiles, fixture.files...)
+	}
+	mergeInputs(setup, t.Setup)
+	t.Setup = setup
+	cases = append(cases, t.Cases...)
+
+	t.Cases = make([]Case, 0, len(cases))
+	for _, c := range cases {
+		expanded, err := c.expandParameters()
+		if err != nil {
+			return err
+		}
+		t.Cases = append(t.Cases, expanded...)
+	}
+
+	for i := range t.Cases {
+		t.Cases[i].Inputs = withSetup(setup, t.Cases[i].Inputs)
+	}
+	if t.Fuzz != nil {
+		t.Fuzz.Case.Inputs = withSetup(setup, t.Fuzz.Case.Inputs)
+	}
+	return nil
+}
+
+// loadFixture loads the given fixture-file and all fixtures imported by it
+// The returned fixture contains the merged setup and cases of all imported fixtures
+// chain are the files that (transitively) imported the file. Used to detect import-cycles
+func loadFixture(filename string, chain []string) (Fixture, error) {
+	var fixture Fixture
+	for _, importer := range chain {
+		if importer == filename {
+			return fixture, fmt.Errorf("Import-cycle detected: %s -> %s", strings.Join(chain, " -> "), filename)
+		}
+	}
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return fixture, fmt.Errorf("Could not load fixture: %s", err.Error())
+	}
+	err = yaml.UnmarshalStrict(content, &fixture)
+	if err != nil {
+		return fixture, fmt.Errorf("The fixture-file '%s' is invalid: %s", filename, err.Error())
+	}
+
+	merged := Fixture{
+		Setup: make(map[string]interface{}),
+		Cases: make([]Case, 0),
+		files: []string{filename},
+	}
+	chain = append(chain, filename)
+	for _, imp := range fixture.Imports {
+		imported, err := loadFixture(filepath.Join(filepath.Dir(filename), imp), chain)
+		if err != nil {
+			return fixture, err
+		}
+		mergeInputs(merged.Setup, imported.Setup)
+		merged.Cases = append(merged.Cases, imported.Cases...)
+		merged.files = append(merged.files, imported.files...)
+	}
+	mergeInputs(merged.Setup, fixture.Setup)
+	merged.Cases = append(merged.Cases, fixture.Cases...)
+	return merged, nil
+}
+
+// mergeInputs copies all values from src to dst. Existing values of dst are overwritten
+// Variable-names are prefixed, so a and :a refer to the same variable
+func mergeInputs(dst map[string]interface{}, src map[string]interface{}) {
+	for k, v := range src {
+		dst[prefixVarname(k)] = v
+	}
+}
+
+// withSetup returns the inputs of a case merged with the setup-values. The inputs of the case take precedence
+func withSetup(setup map[string]interface{}, inputs map[string]interface{}) map[string]interface{} {
+	if len(setup) == 0 {
+		return inputs
+	}
+	merged := make(map[string]interface{}, len(setup)+len(inputs))
+	mergeInputs(merged, setup)
+	mergeInputs(merged, inputs)
+	return merged
+}
+
+// expandParameters returns one case for every set of parameters of c.
+// The placeholders ({name}) in the name, inputs, outputs, stop-conditions and steps of the case are replaced by the parameter-values.
+// If c has no parameters, c is returned unchanged.
+func (c Case) expandParameters() ([]Case, error) {
+	if len(c.Parameters) == 0 {
+		return []Case{c}, nil
+	}
+	if !placeholderRegex.MatchString(c.Name) {
+		return nil, fmt.Errorf("Case '%s': The name of a parameterized case must contain at least one parameter (like {name})", c.Name)
+	}
+	cases := make([]Case, len(c.Parameters))
+	names := make(map[string]int, len(c.Parameters))
+	for i, params := range c.Parameters {
+		tmpl := &template{
+			params: params,
+		}
+		expanded := c
+		expanded.Parameters = nil
+		expanded.Name = tmpl.replace(c.Name)
+		expanded.Inputs = tmpl.values(c.Inputs)
+		expanded.Outputs = tmpl.values(c.Outputs)
+		expanded.StopWhen = tmpl.values(c.StopWhen)
+		if c.Steps != nil {
+			expanded.Steps = make([]Step, len(c.Steps))
+			for j, step := range c.Steps {
+				expanded.Steps[j] = Step{
+					Lines:   step.Lines,
+					When:    tmpl.replace(step.When),
+					Inputs:  tmpl.values(step.Inputs),
+					Outputs: tmpl.values(step.Outputs),
+				}
+			}
+		}
+		if len(tmpl.unknown) > 0 {
+			return nil, fmt.Errorf("Case '%s', parameter-set %d: Unknown parameters: %s", c.Name, i+1, strings.Join(tmpl.unknownNames(), ", "))
+		}
+		if previous, exists := names[expanded.Name]; exists {
+			return nil, fmt.Errorf("Case '%s': Parameter-sets %d and %d result in the same name '%s'", c.Name, previous+1, i+1, expanded.Name)
+		}
+		names[expanded.Name] = i
+		cases[i] = expanded
+	}
+	return cases, nil
+}
+
+// template replaces placeholders by parameter-values
+type template struct {
+	params map[string]interface{}
+	// placeholders for which no parameter exists
+	unknown map[string]bool
+}
+
+// replace replaces all placeholders in str by the string-representation of the parameter-values
+func (t *template) replace(str string) string {
+	return placeholderRegex.ReplaceAllStringFunc(str, func(placeholder string) string {
+		name := placeholder[1 : len(placeholder)-1]
+		value, exists := t.params[name]
+		if !exists {
+			t.markUnknown(name)
+			return placeholder
+		}
+		return fmt.Sprint(value)
+	})
+}
+
+// value replaces the placeholders in a value. If the value consists of a single placeholder,
+// it is replaced by the parameter-value, keeping the type of the parameter
+func (t *template) value(value interface{}) interface{} {
+	str, isString := value.(string)
+	if !isString {
+		return value
+	}
+	if match := placeholderRegex.FindStringSubmatch(str); match != nil && match[0] == str {
+		param, exists := t.params[match[1]]
+		if !exists {
+			t.markUnknown(match[1])
+			return value
+		}
+		return param
+	}
+	return t.replace(str)
+}
+
+// values returns a copy of the given map with all placeholders in the values replaced
+func (t *template) values(values map[string]interface{}) map[string]interface{} {
+	if values == nil {
+		return nil
+	}
+	replaced := make(map[string]interface{}, len(values))
+	for k, v := range values {
+		replaced[k] = t.value(v)
+	}
+	return replaced
+}
+
+func (t *template) markUnknown(name string) {
+	if t.unknown == nil {
+		t.unknown = make(map[string]bool)
+	}
+	t.unknown[name] = true
+}
+
+// unknownNames returns the sorted names of the unknown parameters
+func (t *template) unknownNames() []string {
+	names := make([]string, 0, len(t.unknown))
+	for name := range t.unknown {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,354 @@
+package testing
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dbaumgarten/yodk/pkg/number"
+	"github.com/dbaumgarten/yodk/pkg/parser"
+	"github.com/dbaumgarten/yodk/pkg/parser/ast"
+	"github.com/dbaumgarten/yodk/pkg/vm"
+)
+
+// DefaultFuzzRuns is the number of randomized cases that are run if Fuzz.Runs is not set
+const DefaultFuzzRuns = 100
+
+// maxShrinkRuns limits the number of runs that are used to shrink a failing input
+const maxShrinkRuns = 1000
+
+// defaultChars are the characters used to generate strings if Generator.Chars is not set
+const defaultChars = "abcdefghijklmnopqrstuvwxyz"
+
+// Fuzz runs the scripts of a test with randomly generated inputs and checks that an invariant holds after every run.
+// If a run fails, the failing inputs are shrinked to a minimal counterexample.
+type Fuzz struct {
+	// Number of randomized cases to run. Defaults to DefaultFuzzRuns
+	Runs int
+	// Seed for the random generator. If 0, a random seed is chosen. The seed is reported when fuzzing fails
+	Seed int64
+	// Generators for the values of global variables, indexed by variable-name
+	Inputs map[string]Generator
+	// A yolol-expression that must be true (not 0) after every run. It is evaluated in the context of the first script
+	Invariant string
+	// Further settings and expectations for the generated cases. The generated inputs are added to Case.Inputs
+	Case Case
+}
+
+// Generator describes how to generate random values for a variable.
+// If Values is set, one of the values is chosen. If MaxLength or Chars is set, a string is generated.
+// Otherwise a number between Min and Max is generated.
+type Generator struct {
+	// Range of the generated numbers (both inclusive)
+	Min float64
+	Max float64
+	// The generated numbers are Min plus a multiple of Step. Defaults to 1
+	Step float64
+	// Range of the length of the generated strings (both inclusive)
+	MinLength int
+	MaxLength int
+	// The characters to build strings from. Defaults to a-z
+	Chars string
+	// Choose one of these values
+	Values []interface{}
+}
+
+// generator is the prepared form of a Generator
+type generator struct {
+	Generator
+	min   number.Number
+	step  number.Number
+	steps int64
+	chars []rune
+}
+
+// newGenerator validates and prepares the given Generator
+func newGenerator(g Generator) (*generator, error) {
+	gen := &generator{
+		Generator: g,
+	}
+	switch {
+	case len(g.Values) > 0:
+		for _, value := range g.Values {
+			if _, err := vm.VariableFromType(value); err != nil {
+				return nil, err
+			}
+		}
+	case g.MaxLength > 0 || g.Chars != "":
+		if g.MinLength < 0 || g.MaxLength < g.MinLength {
+			return nil, fmt.Errorf("Invalid length-range %d-%d", g.MinLength, g.MaxLength)
+		}
+		gen.chars = []rune(g.Chars)
+		if len(gen.chars) == 0 {
+			gen.chars = []rune(defaultChars)
+		}
+	default:
+		if g.Max < g.Min {
+			return nil, fmt.Errorf("Invalid range %v-%v", g.Min, g.Max)
+		}
+		step := g.Step
+		if step <= 0 {
+			step = 1
+		}
+		gen.min = toNumber(g.Min)
+		gen.step = toNumber(step)
+		if gen.step == 0 {
+			return nil, fmt.Errorf("Step %v is too small", step)
+		}
+		gen.steps = int64(toNumber(g.Max)-gen.min) / int64(gen.step)
+	}
+	return gen, nil
+}
+
+// toNumber converts a float to a yolol-number, rounding to the precision of yolol-numbers
+func toNumber(f float64) number.Number {
+	return number.MustFromString(strconv.FormatFloat(f, 'f', 3, 64))
+}
+
+// generate returns a random value
+func (g *generator) generate(rng *rand.Rand) interface{} {
+	switch {
+	case len(g.Values) > 0:
+		return g.Values[rng.Intn(len(g.Values))]
+	case g.chars != nil:
+		length := g.MinLength + rng.Intn(g.MaxLength-g.MinLength+1)
+		str := make([]rune, length)
+		for i := range str {
+			str[i] = g.chars[rng.Intn(len(g.chars))]
+		}
+		return string(str)
+	default:
+		return g.number(rng.Int63n(g.steps + 1))
+	}
+}
+
+// number returns the number with the given index in the range of the generator
+func (g *generator) number(idx int64) number.Number {
+	return g.min + g.step*number.Number(idx)
+}
+
+// shrink returns simpler variants of value, simplest first
+func (g *generator) shrink(value interface{}) []interface{} {
+	candidates := make([]interface{}, 0)
+	switch {
+	case len(g.Values) > 0:
+		// values listed first are simpler
+		for _, v := range g.Values {
+			if v == value {
+				break
+			}
+			candidates = append(candidates, v)
+		}
+	case g.chars != nil:
+		str := []rune(value.(string))
+		if len(str) > g.MinLength {
+			candidates = append(candidates, string(str[:g.MinLength]))
+			if half := len(str) / 2; half > g.MinLength {
+				candidates = append(candidates, string(str[:half]))
+			}
+			for i := range str {
+				candidates = append(candidates, string(str[:i])+string(str[i+1:]))
+			}
+		}
+		for i, c := range str {
+			if c != g.chars[0] {
+				candidates = append(candidates, string(str[:i])+string(g.chars[0])+string(str[i+1:]))
+			}
+		}
+	default:
+		// numbers closer to zero are simpler
+		idx := int64(value.(number.Number)-g.min) / int64(g.step)
+		target := int64(-g.min) / int64(g.step)
+		if target < 0 {
+			target = 0
+		} else if target > g.steps {
+			target = g.steps
+		}
+		for distance := idx - target; distance != 0; distance /= 2 {
+			candidates = append(candidates, g.number(idx-distance))
+		}
+	}
+	return candidates
+}
+
+// fuzzer runs the randomized cases of a test
+type fuzzer struct {
+	test       Test
+	fuzz       Fuzz
+	names      []string
+	generators map[string]*generator
+	invariant  ast.Expression
+}
+
+// newFuzzer validates the fuzz-settings of t and prepares the fuzzing
+func newFuzzer(t Test) (*fuzzer, error) {
+	f := &fuzzer{
+		test:       t,
+		fuzz:       *t.Fuzz,
+		names:      make([]string, 0, len(t.Fuzz.Inputs)),
+		generators: make(map[string]*generator, len(t.Fuzz.Inputs)),
+	}
+	// every run uses fresh VMs
+	f.test.Sequential = false
+	f.test.previousRunner = nil
+	if f.fuzz.Runs <= 0 {
+		f.fuzz.Runs = DefaultFuzzRuns
+	}
+	if f.fuzz.Seed == 0 {
+		f.fuzz.Seed = time.Now().UnixNano()
+	}
+	for name, g := range f.fuzz.Inputs {
+		gen, err := newGenerator(g)
+		if err != nil {
+			return nil, fmt.Errorf("Fuzzing: Input '%s': %s", name, err.Error())
+		}
+		f.names = append(f.names, name)
+		f.generators[name] = gen
+	}
+	// sort, so that a seed always generates the same inputs
+	sort.Strings(f.names)
+	if f.fuzz.Invariant != "" {
+		invariant, err := parser.NewParser().ParseExpressionString(f.fuzz.Invariant)
+		if err != nil {
+			return nil, fmt.Errorf("Fuzzing: Invalid invariant '%s': %s", f.fuzz.Invariant, err.Error())
+		}
+		f.invariant = invariant
+	}
+	return f, nil
+}
+
+// runFuzz runs the randomized cases of the test and returns the combined result
+func (t Test) runFuzz(callback func(Case), finished func(*CaseRunner)) CaseResult {
+	start := time.Now()
+	fuzzer, err := newFuzzer(t)
+	if err != nil {
+		return CaseResult{
+			Name:     "fuzzing",
+			Fails:    []error{err},
+			Duration: time.Since(start),
+		}
+	}
+	result := CaseResult{
+		Name: fmt.Sprintf("fuzzing (%d runs, seed %d)", fuzzer.fuzz.Runs, fuzzer.fuzz.Seed),
+	}
+	if callback != nil {
+		callback(Case{
+			Name: result.Name,
+		})
+	}
+	result.Fails, result.Metrics = fuzzer.run(finished)
+	result.Duration = time.Since(start)
+	return result
+}
+
+// run executes the randomized cases. If a case fails, its inputs are shrinked
+// and the failures of the minimal counterexample are returned.
+// Also returns the executed lines and ticks of all randomized cases combined.
+// finished is called after each randomized case (but not for the runs used for shrinking)
+func (f *fuzzer) run(finished func(*CaseRunner)) ([]error, Metrics) {
+	rng := rand.New(rand.NewSource(f.fuzz.Seed))
+	total := Metrics{
+		ExecutedLines: make([]int, len(f.test.Scripts)),
+	}
+	for i := 1; i <= f.fuzz.Runs; i++ {
+		inputs := make(map[string]interface{}, len(f.names))
+		for _, name := range f.names {
+			inputs[name] = f.generators[name].generate(rng)
+		}
+		runner, fails := f.runCase(fmt.Sprintf("fuzz run %d", i), inputs)
+		if runner != nil {
+			m := runner.Metrics()
+			for j, lines := range m.ExecutedLines {
+				total.ExecutedLines[j] += lines
+			}
+			total.Ticks += m.Ticks
+			if finished != nil {
+				finished(runner)
+			}
+		}
+		if len(fails) > 0 {
+			inputs, fails = f.shrink(inputs, fails)
+			header := fmt.Errorf("Fuzzing with seed %d failed in run %d. Minimal failing inputs: %s", f.fuzz.Seed, i, formatInputs(inputs))
+			return append([]error{header}, fails...), total
+		}
+	}
+	return []error{}, total
+}
+
+// runCase runs a single case with the given generated inputs and checks the invariant
+// Returns the runner that executed the case (nil if the case could not be started) and the failures of the case
+func (f *fuzzer) runCase(name string, inputs map[string]interface{}) (*CaseRunner, []error) {
+	c := f.fuzz.Case
+	c.Name = name
+	c.Inputs = make(map[string]interface{}, len(f.fuzz.Case.Inputs)+len(inputs))
+	for k, v := range f.fuzz.Case.Inputs {
+		c.Inputs[k] = v
+	}
+	for k, v := range inputs {
+		c.Inputs[k] = v
+	}
+
+	t := f.test
+	t.Cases = []Case{c}
+	runner, err := t.GetRunner(0)
+	if err != nil {
+		return nil, []error{err}
+	}
+	fails := runner.Run()
+	if f.invariant != nil {
+		result, err := runner.VMs[0].Evaluate(f.invariant)
+		if err != nil {
+			fails = append(fails, fmt.Errorf("Case '%s': Error when evaluating the invariant '%s': %s", name, f.fuzz.Invariant, err.Error()))
+		} else if !result.IsNumber() || result.Number() == number.Zero {
+			fails = append(fails, fmt.Errorf("Case '%s': The invariant '%s' does not hold", name, f.fuzz.Invariant))
+		}
+	}
+	return runner, fails
+}
+
+// shrink repeatedly replaces the failing inputs by simpler inputs that still fail.
+// Returns the simplest failing inputs that have been found and their failures.
+func (f *fuzzer) shrink(inputs map[string]interface{}, fails []error) (map[string]interface{}, []error) {
+	runs := 0
+	for improved := true; improved && runs < maxShrinkRuns; {
+		improved = false
+		for _, name := range f.names {
+			for _, candidate := range f.generators[name].shrink(inputs[name]) {
+				if runs >= maxShrinkRuns {
+					break
+				}
+				runs++
+				try := make(map[string]interface{}, len(inputs))
+				for k, v := range inputs {
+					try[k] = v
+				}
+				try[name] = candidate
+				if _, tryfails := f.runCase("fuzz counterexample", try); len(tryfails) > 0 {
+					inputs = try
+					fails = tryfails
+					improved = true
+					break
+				}
+			}
+		}
+	}
+	return inputs, fails
+}
+
+// formatInputs returns a human-readable representation of the given inputs
+func formatInputs(inputs map[string]interface{}) string {
+	names := make([]string, 0, len(inputs))
+	for name := range inputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, len(names))
+	for i, name := range names {
+		value, _ := vm.VariableFromType(inputs[name])
+		parts[i] = prefixVarname(name) + "=" + value.Repr()
+	}
+	return strings.Join(parts, ", ")
+}
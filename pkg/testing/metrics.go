@@ -0,0 +1,207 @@
+package testing
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/dbaumgarten/yodk/pkg/vm"
+)
+
+// ChangeAssertion requires a global variable to change within a window of ticks
+type ChangeAssertion struct {
+	// The global variable to watch. Supports the network/name syntax
+	Variable string
+	// The variable must change in this tick or later. Ticks are counted from the start of the case, beginning with 1
+	From int
+	// The variable must change in this tick or earlier. 0 means: until the end of the case
+	To int
+	// If set, the variable must change to this value
+	Value interface{}
+}
+
+// ObservedChange is a change of a watched variable during the execution of a case
+type ObservedChange struct {
+	// The tick (counted from the start of the case, beginning with 1) in which the variable changed
+	Tick int
+	// The value after the change
+	Value vm.Variable
+}
+
+// Metrics contains measurements about the execution of a case
+type Metrics struct {
+	// The number of lines each VM executed during the case
+	ExecutedLines []int
+	// The number of ticks (rounds of coordinated execution) until the case stopped
+	Ticks int
+	// The observed changes of the variables used in the ChangeAssertions of the case, indexed by the (prefixed) variable-name
+	Changes map[string][]ObservedChange
+}
+
+// metricsRecorder collects the Metrics of a running case
+type metricsRecorder struct {
+	lock    *sync.Mutex
+	metrics Metrics
+	// executed lines and rounds of the coordinator when the case started
+	startLines  []int
+	startRounds int
+	// true once the case has stopped
+	stopped bool
+	// the last known values of the watched variables
+	values map[string]*vm.Variable
+}
+
+// newMetricsRecorder starts recording the metrics for the given runner
+func newMetricsRecorder(runner *CaseRunner) *metricsRecorder {
+	r := &metricsRecorder{
+		lock:        &sync.Mutex{},
+		startLines:  make([]int, len(runner.VMs)),
+		startRounds: runner.Coordinator.GetRounds(),
+		values:      make(map[string]*vm.Variable),
+		metrics: Metrics{
+			Changes: make(map[string][]ObservedChange),
+		},
+	}
+	for i, v := range runner.VMs {
+		r.startLines[i] = v.GetExecutedLines()
+	}
+	for _, change := range runner.Case.Changes {
+		name := prefixVarname(change.Variable)
+		r.metrics.Changes[name] = make([]ObservedChange, 0)
+		r.values[name] = getNetworkVariable(runner.Coordinator, name)
+	}
+	return r
+}
+
+// getNetworkVariable returns the current value of the given (prefixed) variable. Returns nil if the variable does not exist
+func getNetworkVariable(coord *vm.Coordinator, name string) *vm.Variable {
+	network, varname := splitVarname(name)
+	value, exists := coord.GetNetworkVariable(networkOrDefault(network), varname)
+	if !exists {
+		return nil
+	}
+	// copy the value, so later changes do not modify it
+	copied := *value
+	return &copied
+}
+
+// sample checks the watched variables for changes that happened during the given tick
+func (r *metricsRecorder) sample(coord *vm.Coordinator, tick int) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.stopped {
+		return
+	}
+	r.sampleLocked(coord, tick)
+}
+
+func (r *metricsRecorder) sampleLocked(coord *vm.Coordinator, tick int) {
+	for name, previous := range r.values {
+		current := getNetworkVariable(coord, name)
+		if current == nil || (previous != nil && previous.SameType(current) && previous.Equals(current)) {
+			continue
+		}
+		r.metrics.Changes[name] = append(r.metrics.Changes[name], ObservedChange{
+			Tick:  tick,
+			Value: *current,
+		})
+		r.values[name] = current
+	}
+}
+
+// tick returns the current tick of the case
+func (r *metricsRecorder) tick(coord *vm.Coordinator) int {
+	// the current round has not yet been completed
+	return coord.GetRounds() - r.startRounds + 1
+}
+
+// stop finishes the recording. Must be called while the case is stopping, before any other line is executed.
+func (r *metricsRecorder) stop(runner *CaseRunner) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.stopped {
+		return
+	}
+	r.metrics.Ticks = r.tick(runner.Coordinator)
+	r.metrics.ExecutedLines = make([]int, len(runner.VMs))
+	for i, v := range runner.VMs {
+		r.metrics.ExecutedLines[i] = v.GetExecutedLines() - r.startLines[i]
+	}
+	// changes in the last (incomplete) tick
+	r.sampleLocked(runner.Coordinator, r.metrics.Ticks)
+	r.stopped = true
+}
+
+// get returns the recorded metrics
+func (r *metricsRecorder) get() Metrics {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.metrics
+}
+
+// checkMetrics compares the metrics of the execution with the expectations of c and returns found errors
+func (c Case) checkMetrics(m Metrics, scripts []string) []error {
+	fails := make([]error, 0)
+	for i, lines := range m.ExecutedLines {
+		if c.MaxExecutedLines > 0 && lines > c.MaxExecutedLines {
+			fails = append(fails, fmt.Errorf("Case '%s': Script '%s' executed %d lines but should execute at most %d", c.Name, scripts[i], lines, c.MaxExecutedLines))
+		}
+		if c.MinExecutedLines > 0 && lines < c.MinExecutedLines {
+			fails = append(fails, fmt.Errorf("Case '%s': Script '%s' executed %d lines but should execute at least %d", c.Name, scripts[i], lines, c.MinExecutedLines))
+		}
+	}
+	if c.MaxTicks > 0 && m.Ticks > c.MaxTicks {
+		fails = append(fails, fmt.Errorf("Case '%s': Stopped after %d ticks but should stop after at most %d", c.Name, m.Ticks, c.MaxTicks))
+	}
+	if c.MinTicks > 0 && m.Ticks < c.MinTicks {
+		fails = append(fails, fmt.Errorf("Case '%s': Stopped after %d ticks but should stop after at least %d", c.Name, m.Ticks, c.MinTicks))
+	}
+	for _, change := range c.Changes {
+		if fail := change.check(c.Name, m.Changes[prefixVarname(change.Variable)]); fail != nil {
+			fails = append(fails, fail)
+		}
+	}
+	return fails
+}
+
+// check returns an error if none of the observed changes satisfies the assertion
+func (a ChangeAssertion) check(casename string, observed []ObservedChange) error {
+	var expected *vm.Variable
+	if a.Value != nil {
+		var err error
+		expected, err = vm.VariableFromType(a.Value)
+		if err != nil {
+			return fmt.Errorf("Invalid type for expected value of '%s': %T", a.Variable, a.Value)
+		}
+	}
+	from := a.From
+	if from < 1 {
+		from = 1
+	}
+	window := fmt.Sprintf("between tick %d and the end of the case", from)
+	if a.To > 0 {
+		window = fmt.Sprintf("between tick %d and %d", from, a.To)
+	}
+	if expected != nil {
+		window = "to " + expected.Repr() + " " + window
+	}
+
+	ticks := make([]int, 0, len(observed))
+	for _, change := range observed {
+		if change.Tick < from || (a.To > 0 && change.Tick > a.To) {
+			ticks = append(ticks, change.Tick)
+			continue
+		}
+		if expected != nil && !(change.Value.SameType(expected) && change.Value.Equals(expected)) {
+			ticks = append(ticks, change.Tick)
+			continue
+		}
+		return nil
+	}
+
+	if len(ticks) == 0 {
+		return fmt.Errorf("Case '%s': Variable '%s' did not change, but should change %s", casename, prefixVarname(a.Variable), window)
+	}
+	sort.Ints(ticks)
+	return fmt.Errorf("Case '%s': Variable '%s' changed in ticks %v, but should change %s", casename, prefixVarname(a.Variable), ticks, window)
+}
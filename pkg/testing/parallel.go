@@ -0,0 +1,97 @@
+package testing
+
+import (
+	"sync"
+	"time"
+)
+
+// Limiter limits the number of cases that are run concurrently. A limiter can be shared between multiple tests
+type Limiter chan struct{}
+
+// NewLimiter returns a limiter that allows n cases to run at the same time. n < 1 is treated as 1
+func NewLimiter(n int) Limiter {
+	if n < 1 {
+		n = 1
+	}
+	return make(Limiter, n)
+}
+
+func (l Limiter) acquire() {
+	l <- struct{}{}
+}
+
+func (l Limiter) release() {
+	<-l
+}
+
+// RunParallel acts like RunEx, but runs the cases of non-sequential tests concurrently.
+// The number of concurrently running cases is limited by limiter. If limiter is nil, the cases are run one after another.
+// callback is called in the order of the cases, right before a case is started.
+// finished is called from the goroutines running the cases and therefore must be safe for concurrent use.
+// The results are always returned in the order of the cases.
+func (t Test) RunParallel(limiter Limiter, callback func(Case), finished func(*CaseRunner)) TestResult {
+	if limiter == nil {
+		limiter = NewLimiter(1)
+	}
+	start := time.Now()
+	t.Snapshot = t.snapshotsEnabled()
+	result := TestResult{
+		File:    t.Path,
+		Scripts: t.Scripts,
+		Cases:   make([]CaseResult, len(t.Cases)),
+	}
+	wg := &sync.WaitGroup{}
+	for i := range t.Cases {
+		limiter.acquire()
+		if callback != nil {
+			callback(t.Cases[i])
+		}
+		if t.Sequential {
+			// the cases share their VMs and must run in order
+			result.Cases[i] = t.runCase(i, finished)
+			limiter.release()
+			continue
+		}
+		wg.Add(1)
+		// every case gets its own copy of the test, so GetRunner does not modify shared state
+		go func(i int, test Test) {
+			defer wg.Done()
+			defer limiter.release()
+			result.Cases[i] = test.runCase(i, finished)
+		}(i, t)
+	}
+	wg.Wait()
+	if t.Snapshot {
+		t.processSnapshots(&result)
+	}
+	if t.Fuzz != nil {
+		limiter.acquire()
+		result.Cases = append(result.Cases, t.runFuzz(callback, finished))
+		limiter.release()
+	}
+	result.Duration = time.Since(start)
+	return result
+}
+
+// runCase runs the case with the given index and returns the result
+func (t *Test) runCase(casenr int, finished func(*CaseRunner)) CaseResult {
+	start := time.Now()
+	result := CaseResult{
+		Name: t.Cases[casenr].Name,
+	}
+	runner, err := t.GetRunner(casenr)
+	if err != nil {
+		result.Fails = []error{err}
+	} else {
+		result.Fails = runner.Run()
+		result.Metrics = runner.Metrics()
+		if t.Snapshot {
+			result.snapshot = t.takeSnapshot(runner)
+		}
+		if finished != nil {
+			finished(runner)
+		}
+	}
+	result.Duration = time.Since(start)
+	return result
+}
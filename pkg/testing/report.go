@@ -0,0 +1,180 @@
+package testing
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// junitTestsuites is the root-element of a junit-report
+type junitTestsuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestsuite `xml:"testsuite"`
+}
+
+// junitTestsuite contains the results of one test-file
+type junitTestsuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestcase `xml:"testcase"`
+}
+
+// junitTestcase contains the result of one case
+type junitTestcase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+// junitFailure describes why a case failed
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Content string `xml:",chardata"`
+}
+
+// WriteJUnitReport writes the given results as junit-xml to w. Every test-file is reported as a testsuite
+func WriteJUnitReport(w io.Writer, results []TestResult) error {
+	report := junitTestsuites{
+		Suites: make([]junitTestsuite, len(results)),
+	}
+	var total time.Duration
+	for i, result := range results {
+		suite := junitTestsuite{
+			Name:  result.File,
+			Tests: len(result.Cases),
+			Time:  formatSeconds(result.Duration),
+			Cases: make([]junitTestcase, len(result.Cases)),
+		}
+		for j, c := range result.Cases {
+			testcase := junitTestcase{
+				Name:      c.Name,
+				Classname: result.File,
+				Time:      formatSeconds(c.Duration),
+				SystemOut: formatMetrics(c.Metrics, result.Scripts),
+			}
+			if !c.Passed() {
+				suite.Failures++
+				messages := errorStrings(c.Fails)
+				testcase.Failure = &junitFailure{
+					Message: messages[0],
+					Content: strings.Join(messages, "\n"),
+				}
+			}
+			suite.Cases[j] = testcase
+		}
+		report.Tests += suite.Tests
+		report.Failures += suite.Failures
+		total += result.Duration
+		report.Suites[i] = suite
+	}
+	report.Time = formatSeconds(total)
+
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	err = encoder.Encode(report)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+// jsonReport is the root-element of a json-report
+type jsonReport struct {
+	Passed bool       `json:"passed"`
+	Files  []jsonFile `json:"files"`
+}
+
+// jsonFile contains the results of one test-file
+type jsonFile struct {
+	File     string     `json:"file"`
+	Passed   bool       `json:"passed"`
+	Duration float64    `json:"duration"`
+	Cases    []jsonCase `json:"cases"`
+}
+
+// jsonCase contains the result of one case
+type jsonCase struct {
+	Name          string         `json:"name"`
+	Passed        bool           `json:"passed"`
+	Duration      float64        `json:"duration"`
+	ExecutedLines map[string]int `json:"executedLines"`
+	Ticks         int            `json:"ticks"`
+	Failures      []string       `json:"failures"`
+}
+
+// WriteJSONReport writes the given results as json to w. Durations are given in seconds
+func WriteJSONReport(w io.Writer, results []TestResult) error {
+	report := jsonReport{
+		Passed: true,
+		Files:  make([]jsonFile, len(results)),
+	}
+	for i, result := range results {
+		file := jsonFile{
+			File:     result.File,
+			Passed:   result.Passed(),
+			Duration: result.Duration.Seconds(),
+			Cases:    make([]jsonCase, len(result.Cases)),
+		}
+		for j, c := range result.Cases {
+			executedLines := make(map[string]int, len(c.Metrics.ExecutedLines))
+			for k, lines := range c.Metrics.ExecutedLines {
+				executedLines[result.Scripts[k]] = lines
+			}
+			file.Cases[j] = jsonCase{
+				Name:          c.Name,
+				Passed:        c.Passed(),
+				Duration:      c.Duration.Seconds(),
+				ExecutedLines: executedLines,
+				Ticks:         c.Metrics.Ticks,
+				Failures:      errorStrings(c.Fails),
+			}
+		}
+		report.Passed = report.Passed && file.Passed
+		report.Files[i] = file
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+// errorStrings returns the messages of the given errors
+func errorStrings(errs []error) []string {
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.Error()
+	}
+	return messages
+}
+
+// formatSeconds formats a duration as seconds, like junit expects it
+func formatSeconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+// formatMetrics returns a human-readable summary of the given metrics
+func formatMetrics(m Metrics, scripts []string) string {
+	if len(m.ExecutedLines) == 0 {
+		return ""
+	}
+	parts := make([]string, 0, len(m.ExecutedLines)+1)
+	for i, lines := range m.ExecutedLines {
+		parts = append(parts, fmt.Sprintf("%s: %d executed lines", scripts[i], lines))
+	}
+	parts = append(parts, fmt.Sprintf("ticks: %d", m.Ticks))
+	return strings.Join(parts, "\n")
+}
@@ -0,0 +1,274 @@
+package testing
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/dbaumgarten/yodk/pkg/number"
+	"github.com/dbaumgarten/yodk/pkg/parser"
+	"github.com/dbaumgarten/yodk/pkg/vm"
+)
+
+// Snapshot contains the recorded results of a test. Used to compare the results of later runs against it
+type Snapshot struct {
+	// The values of all global variables after each case, indexed by case-name and (prefixed) variable-name
+	// Variables of networks other than the default network use the network/name syntax
+	Cases map[string]map[string]interface{}
+	// The compiled yolol-code of every nolol-script, indexed by script-name
+	Code map[string]string `yaml:",omitempty"`
+}
+
+// caseSnapshot contains the values recorded for a single case
+type caseSnapshot struct {
+	variables map[string]interface{}
+	// the compiled code of the nolol-scripts. nil if the code is not recorded
+	code map[string]string
+}
+
+// SnapshotFile returns the path of the file that contains the snapshot of the test
+func (t Test) SnapshotFile() string {
+	return strings.TrimSuffix(t.Path, ".yaml") + ".snapshot.yaml"
+}
+
+// snapshotsEnabled returns true if the results of the test are compared with (or recorded into) a snapshot
+// This is the case if the test requests it, if a new snapshot is to be recorded or if there already is a snapshot for the test
+func (t Test) snapshotsEnabled() bool {
+	if t.Snapshot || t.UpdateSnapshots {
+		return true
+	}
+	if t.Path == "" {
+		return false
+	}
+	_, err := os.Stat(t.SnapshotFile())
+	return err == nil
+}
+
+// takeSnapshot records the values of the global variables (and if requested the compiled code) after runner has finished
+func (t Test) takeSnapshot(runner *CaseRunner) *caseSnapshot {
+	snap := &caseSnapshot{
+		variables: make(map[string]interface{}),
+	}
+	for _, network := range runner.Coordinator.GetNetworks() {
+		prefix := ""
+		if network != vm.DefaultNetwork {
+			prefix = network + "/"
+		}
+		for name, value := range runner.Coordinator.GetNetworkVariables(network) {
+			snap.variables[prefix+prefixVarname(name)] = snapshotValue(&value)
+		}
+	}
+	if t.SnapshotCode {
+		snap.code = make(map[string]string)
+		printer := parser.Printer{}
+		for i, script := range t.Scripts {
+			if !strings.HasSuffix(script, ".nolol") {
+				continue
+			}
+			code, err := printer.Print(runner.VMs[i].GetProgram())
+			if err == nil {
+				snap.code[script] = code
+			}
+		}
+	}
+	return snap
+}
+
+// snapshotValue converts a variable into a value that can be stored in a snapshot-file
+func snapshotValue(v *vm.Variable) interface{} {
+	if !v.IsNumber() {
+		return v.String()
+	}
+	n := v.Number()
+	if n == number.FromInt(n.Int()) {
+		return n.Int()
+	}
+	// use the string-representation to avoid rounding-errors
+	f, _ := strconv.ParseFloat(n.String(), 64)
+	return f
+}
+
+// formatSnapshotValue returns a comparable representation of a value from a snapshot
+func formatSnapshotValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return strconv.Quote(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// processSnapshots compares the snapshots taken during the cases with the snapshot-file of the test,
+// or updates the snapshot-file if t.UpdateSnapshots is set.
+// Failures are added to the case-results. Differences of the compiled code are reported as an additional case.
+func (t Test) processSnapshots(result *TestResult) {
+	keys := snapshotKeys(result.Cases)
+	current := Snapshot{
+		Cases: make(map[string]map[string]interface{}),
+	}
+	for i, c := range result.Cases {
+		if c.snapshot == nil {
+			continue
+		}
+		current.Cases[keys[i]] = c.snapshot.variables
+		if c.snapshot.code != nil && current.Code == nil {
+			current.Code = c.snapshot.code
+		}
+	}
+
+	if t.UpdateSnapshots {
+		err := current.Save(t.SnapshotFile())
+		if err != nil {
+			result.Cases = append(result.Cases, CaseResult{
+				Name:  "snapshot",
+				Fails: []error{fmt.Errorf("Could not write snapshot: %s", err.Error())},
+			})
+		}
+		return
+	}
+
+	recorded, err := LoadSnapshot(t.SnapshotFile())
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = fmt.Errorf("The snapshot-file '%s' does not exist. Run the test with --update-snapshots to create it", t.SnapshotFile())
+		}
+		result.Cases = append(result.Cases, CaseResult{
+			Name:  "snapshot",
+			Fails: []error{err},
+		})
+		return
+	}
+
+	for i, c := range result.Cases {
+		if c.snapshot == nil {
+			continue
+		}
+		result.Cases[i].Fails = append(result.Cases[i].Fails, compareVariables(keys[i], recorded.Cases[keys[i]], c.snapshot.variables)...)
+	}
+
+	if t.SnapshotCode {
+		fails := compareCode(recorded.Code, current.Code)
+		result.Cases = append(result.Cases, CaseResult{
+			Name:  "snapshot of compiled code",
+			Fails: fails,
+		})
+	}
+}
+
+// snapshotKeys returns the names under which the cases are stored in the snapshot
+// If multiple cases have the same name, a counter is appended to the names of the later cases
+func snapshotKeys(cases []CaseResult) []string {
+	keys := make([]string, len(cases))
+	seen := make(map[string]int, len(cases))
+	for i, c := range cases {
+		seen[c.Name]++
+		keys[i] = c.Name
+		if seen[c.Name] > 1 {
+			keys[i] = fmt.Sprintf("%s (%d)", c.Name, seen[c.Name])
+		}
+	}
+	return keys
+}
+
+// compareVariables compares the variables recorded in the snapshot with the current variables of a case
+func compareVariables(casename string, recorded map[string]interface{}, current map[string]interface{}) []error {
+	if recorded == nil {
+		return []error{fmt.Errorf("Case '%s': The case is missing in the snapshot. Run the test with --update-snapshots to add it", casename)}
+	}
+	fails := make([]error, 0)
+	names := make([]string, 0, len(recorded)+len(current))
+	for name := range recorded {
+		names = append(names, name)
+	}
+	for name := range current {
+		if _, exists := recorded[name]; !exists {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		want, wanted := recorded[name]
+		got, exists := current[name]
+		switch {
+		case !exists:
+			fails = append(fails, fmt.Errorf("Case '%s': Variable '%s' does not exist, but is %s in the snapshot", casename, name, formatSnapshotValue(want)))
+		case !wanted:
+			fails = append(fails, fmt.Errorf("Case '%s': Variable '%s' is %s, but does not exist in the snapshot", casename, name, formatSnapshotValue(got)))
+		case formatSnapshotValue(want) != formatSnapshotValue(got):
+			fails = append(fails, fmt.Errorf("Case '%s': Variable '%s' is %s, but %s in the snapshot", casename, name, formatSnapshotValue(got), formatSnapshotValue(want)))
+		}
+	}
+	return fails
+}
+
+// compareCode compares the recorded compiled code with the current compiled code
+func compareCode(recorded map[string]string, current map[string]string) []error {
+	fails := make([]error, 0)
+	scripts := make([]string, 0, len(current))
+	for script := range current {
+		scripts = append(scripts, script)
+	}
+	sort.Strings(scripts)
+	for _, script := range scripts {
+		want, exists := recorded[script]
+		if !exists {
+			fails = append(fails, fmt.Errorf("The compiled code of '%s' is missing in the snapshot", script))
+			continue
+		}
+		if line, got, wanted := firstDifference(current[script], want); line > 0 {
+			fails = append(fails, fmt.Errorf("The compiled code of '%s' differs from the snapshot in line %d. Got: '%s', Snapshot: '%s'", script, line, got, wanted))
+		}
+	}
+	return fails
+}
+
+// firstDifference returns the number and content of the first line that differs between a and b
+// Returns 0 as line-number if a and b are equal
+func firstDifference(a string, b string) (int, string, string) {
+	linesA := strings.Split(a, "\n")
+	linesB := strings.Split(b, "\n")
+	for i := 0; i < len(linesA) || i < len(linesB); i++ {
+		lineA := ""
+		if i < len(linesA) {
+			lineA = linesA[i]
+		}
+		lineB := ""
+		if i < len(linesB) {
+			lineB = linesB[i]
+		}
+		if lineA != lineB || i >= len(linesA) || i >= len(linesB) {
+			return i + 1, lineA, lineB
+		}
+	}
+	return 0, "", ""
+}
+
+// Save writes the snapshot to the given file
+func (s Snapshot) Save(filename string) error {
+	content, err := yaml.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, content, 0644)
+}
+
+// LoadSnapshot loads a snapshot from the given file
+func LoadSnapshot(filename string) (Snapshot, error) {
+	var snap Snapshot
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return snap, err
+	}
+	err = yaml.UnmarshalStrict(content, &snap)
+	if err != nil {
+		return snap, fmt.Errorf("The snapshot-file '%s' is invalid: %s", filename, err.Error())
+	}
+	return snap, nil
+}
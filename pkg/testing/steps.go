@@ -0,0 +1,116 @@
+package testing
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/dbaumgarten/yodk/pkg/number"
+	"github.com/dbaumgarten/yodk/pkg/parser"
+	"github.com/dbaumgarten/yodk/pkg/parser/ast"
+	"github.com/dbaumgarten/yodk/pkg/vm"
+)
+
+// Step changes inputs and/or checks intermediate outputs while a case is running.
+// The steps of a case are executed in the given order. A step is only considered after all previous steps have been executed.
+type Step struct {
+	// The step is executed once a script has executed at least this many lines (counted from the start of the case)
+	Lines int
+	// The step is executed once this yolol-expression is true (not 0).
+	// The expression is evaluated after every executed line, in the context of the script that executed the line
+	When string
+	// Values of global variables to set when the step is executed
+	Inputs map[string]interface{}
+	// Expected values of global variables when the step is executed (before the inputs are set)
+	Outputs map[string]interface{}
+}
+
+// stepRunner executes the steps of a running case
+type stepRunner struct {
+	lock  *sync.Mutex
+	steps []Step
+	// the parsed When-expressions of the steps. nil if a step has no condition
+	conditions []ast.Expression
+	// index of the next step to execute
+	next int
+	// the number of executed lines of every vm when the case started
+	startLines map[*vm.VM]int
+	fails      []error
+	casename   string
+	// true once the case has stopped. No more steps are executed then
+	stopped bool
+}
+
+// newStepRunner prepares the execution of the steps of the case run by runner
+func newStepRunner(runner *CaseRunner) (*stepRunner, error) {
+	r := &stepRunner{
+		lock:       &sync.Mutex{},
+		steps:      runner.Case.Steps,
+		conditions: make([]ast.Expression, len(runner.Case.Steps)),
+		startLines: make(map[*vm.VM]int),
+		fails:      make([]error, 0),
+		casename:   runner.Case.Name,
+	}
+	for i, step := range r.steps {
+		if step.When == "" {
+			continue
+		}
+		cond, err := parser.NewParser().ParseExpressionString(step.When)
+		if err != nil {
+			return nil, fmt.Errorf("Case '%s', step %d: Invalid condition '%s': %s", r.casename, i+1, step.When, err.Error())
+		}
+		r.conditions[i] = cond
+	}
+	for _, v := range runner.VMs {
+		r.startLines[v] = v.GetExecutedLines()
+	}
+	return r, nil
+}
+
+// lineExecuted must be called after v executed a line. Executes all steps that are due
+func (r *stepRunner) lineExecuted(v *vm.VM, coord *vm.Coordinator) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for !r.stopped && r.next < len(r.steps) && r.isDue(r.next, v) {
+		step := r.steps[r.next]
+		context := fmt.Sprintf("Case '%s', step %d", r.casename, r.next+1)
+		r.fails = append(r.fails, checkOutputs(coord, step.Outputs, context)...)
+		err := setVariables(coord, step.Inputs)
+		if err != nil {
+			r.fails = append(r.fails, fmt.Errorf("%s: %s", context, err.Error()))
+		}
+		r.next++
+	}
+}
+
+// isDue returns true if the step with the given index is to be executed after v executed a line
+func (r *stepRunner) isDue(idx int, v *vm.VM) bool {
+	step := r.steps[idx]
+	if step.Lines > 0 && v.GetExecutedLines()-r.startLines[v] < step.Lines {
+		return false
+	}
+	if r.conditions[idx] != nil {
+		result, err := v.Evaluate(r.conditions[idx])
+		if err != nil || !result.IsNumber() || result.Number() == number.Zero {
+			return false
+		}
+	}
+	return true
+}
+
+// stop prevents the execution of any further steps
+func (r *stepRunner) stop() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.stopped = true
+}
+
+// results returns the failures of the executed steps and an error for every step that has not been executed
+func (r *stepRunner) results() []error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	fails := append([]error{}, r.fails...)
+	for i := r.next; i < len(r.steps); i++ {
+		fails = append(fails, fmt.Errorf("Case '%s', step %d: The step has not been executed before the case stopped", r.casename, i+1))
+	}
+	return fails
+}
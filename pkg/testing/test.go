@@ -4,8 +4,10 @@ import (
 	"fmt"
 	"io/ioutil"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	yaml "gopkg.in/yaml.v2"
 
@@ -24,6 +26,10 @@ type Test struct {
 	ScriptContents []string
 	// Cases for this test
 	Cases []Case
+	// Fixture-files whose setup and cases are added to this test. Paths are relative to the test-file
+	Imports []string
+	// Values of global variables that are set before every case. The inputs of a case take precedence
+	Setup map[string]interface{}
 	// Maximum number of lines to run from the script (0=infinite)
 	MaxLines int
 	// Stop when is a map from global variable-name to value
@@ -35,8 +41,28 @@ type Test struct {
 	ChipType string
 	// Run tests on after another and keep the state between cases
 	Sequential bool
+	// Simulated devices whose fields are available as global variables to the scripts
+	Devices []vm.Device
+	// Simulated chips whose behaviour is described by simple rules instead of scripts
+	Stubs []vm.Stub
+	// Networks maps network-names to the scripts (and stubs) that are connected to the network
+	// Scripts that are not listed in any network are connected to the default network
+	Networks map[string][]string
+	// Relays forward fields between networks
+	Relays []vm.Relay
+	// Run additional cases with randomly generated inputs
+	Fuzz *Fuzz
+	// Compare the global variables after each case with the values recorded in the snapshot-file of the test
+	// Snapshots are also compared if this is false, but the snapshot-file exists
+	Snapshot bool
+	// Also compare the compiled code of all nolol-scripts with the snapshot. Requires Snapshot
+	SnapshotCode bool
+	// Record a new snapshot instead of comparing against the existing one. Usually set by the test-runner, not in the test-file
+	UpdateSnapshots bool
 
 	previousRunner *CaseRunner
+	// the fixture-files that have been imported by the test
+	fixtureFiles []string
 }
 
 // Case defines inputs and expected outputs for a run
@@ -51,6 +77,20 @@ type Case struct {
 	StopWhen map[string]interface{}
 	// Maximum amount of lines to run for this case
 	MaxLines int
+	// Every script must execute at most/at least this many lines during this case (0 = no limit)
+	MaxExecutedLines int
+	MinExecutedLines int
+	// The case must stop (reach a stop-condition) after at most/at least this many ticks (0 = no limit)
+	// A tick is one round of coordinated execution, in which every script executes one line
+	MaxTicks int
+	MinTicks int
+	// Variables that must change within a given window of ticks
+	Changes []ChangeAssertion
+	// Inputs and expected outputs that are applied/checked while the case is running
+	Steps []Step
+	// If set, the case is expanded into one case per entry. Placeholders like {name} in the name, inputs, outputs,
+	// stop-conditions and steps of the case are replaced by the values of the entry
+	Parameters []map[string]interface{}
 }
 
 // CaseRunner represents a prepared test-case that is ready to run
@@ -58,22 +98,50 @@ type CaseRunner struct {
 	Coordinator     *vm.Coordinator
 	VMs             []*vm.VM
 	VarTranslations []map[string]string
-	Test            *Test
-	Case            *Case
-	StopConditions  map[string]*vm.Variable
+	// source-maps for the VMs that run nolol-code. nil for yolol-scripts
+	SourceMaps     []*nolol.SourceMap
+	Test           *Test
+	Case           *Case
+	StopConditions map[string]*vm.Variable
 	// If true, the VMs are already running, but currently paused
 	Paused bool
 	// This channel will be closed once the test-case has been executed
 	Done chan struct{}
+	// records the metrics of the execution
+	metrics *metricsRecorder
+	// executes the steps of the case
+	steps *stepRunner
 }
 
+// prefixVarname adds the ":"-prefix to the given variable-name
+// Supports variable-names of the form network/name
 func prefixVarname(inp string) string {
+	if idx := strings.Index(inp, "/"); idx >= 0 {
+		return inp[:idx+1] + prefixVarname(inp[idx+1:])
+	}
 	if !strings.HasPrefix(inp, ":") {
 		return ":" + inp
 	}
 	return inp
 }
 
+// splitVarname splits a variable-name of the form network/name into the network and the prefixed variable-name
+// If the name does not contain a network, the returned network is empty
+func splitVarname(inp string) (string, string) {
+	if idx := strings.Index(inp, "/"); idx >= 0 {
+		return inp[:idx], prefixVarname(inp[idx+1:])
+	}
+	return "", prefixVarname(inp)
+}
+
+// networkOrDefault returns the given network, or the default-network if network is empty
+func networkOrDefault(network string) string {
+	if network == "" {
+		return vm.DefaultNetwork
+	}
+	return network
+}
+
 // Parse parses a yaml file into a Test
 // path is the path from where the test was loaded. This is needed as the scripts are located relative to the test-file
 func Parse(file []byte, path string) (Test, error) {
@@ -83,6 +151,10 @@ func Parse(file []byte, path string) (Test, error) {
 		return test, fmt.Errorf("The provided test-file is invalid: %s", err.Error())
 	}
 	test.Path = path
+	err = test.resolveFixtures()
+	if err != nil {
+		return test, err
+	}
 	// set a default for MaxLines
 	if test.MaxLines == 0 {
 		test.MaxLines = 2000
@@ -112,24 +184,86 @@ func (t Test) GetScriptCode(index int) (string, error) {
 	return string(f), nil
 }
 
-// Run runs all test-cases
-func (t Test) Run(callback func(Case)) []error {
+// TestResult contains the results of running all cases of a test
+type TestResult struct {
+	// The path of the test-file
+	File string
+	// The scripts that have been tested
+	Scripts []string
+	// The results of the individual cases
+	Cases []CaseResult
+	// The time it took to run all cases
+	Duration time.Duration
+}
+
+// CaseResult is the result of running a single case
+type CaseResult struct {
+	Name string
+	// The errors found while running the case. Empty if the case passed
+	Fails []error
+	// The time it took to run the case
+	Duration time.Duration
+	// Measurements about the execution of the case
+	Metrics Metrics
+	// the values recorded for the snapshot of the test. nil if snapshots are disabled
+	snapshot *caseSnapshot
+}
+
+// Passed returns true if the case has no failures
+func (r CaseResult) Passed() bool {
+	return len(r.Fails) == 0
+}
+
+// Fails returns the failures of all cases
+func (r TestResult) Fails() []error {
 	fails := make([]error, 0)
-	for i := range t.Cases {
-		if callback != nil {
-			callback(t.Cases[i])
-		}
-		runner, err := t.GetRunner(i)
-		if err != nil {
-			fails = append(fails, err)
-			continue
-		}
-		casefails := runner.Run()
-		fails = append(fails, casefails...)
+	for _, c := range r.Cases {
+		fails = append(fails, c.Fails...)
 	}
 	return fails
 }
 
+// Passed returns true if all cases passed
+func (r TestResult) Passed() bool {
+	return len(r.Fails()) == 0
+}
+
+// Dependencies returns the paths of all files the test depends on: the test-file, the imported fixtures,
+// the scripts, all files included by the nolol-scripts and the snapshot-file (if it exists)
+func (t Test) Dependencies() []string {
+	deps := []string{t.Path}
+	deps = append(deps, t.fixtureFiles...)
+	dir := filepath.Dir(t.Path)
+	for _, script := range t.Scripts {
+		file := filepath.Join(dir, script)
+		deps = append(deps, file)
+		if strings.HasSuffix(script, ".nolol") {
+			converter := nolol.NewConverter()
+			converter.SetChipType(t.ChipType)
+			done := converter.LoadFile(file).RunConversion()
+			for _, included := range done.GetIncludedFiles() {
+				deps = append(deps, filepath.Join(filepath.Dir(file), filepath.FromSlash(included)))
+			}
+		}
+	}
+	// when updating, the snapshot is an output of the test and not an input
+	if t.snapshotsEnabled() && !t.UpdateSnapshots {
+		deps = append(deps, t.SnapshotFile())
+	}
+	return deps
+}
+
+// Run runs all test-cases
+func (t Test) Run(callback func(Case)) TestResult {
+	return t.RunEx(callback, nil)
+}
+
+// RunEx acts like Run, but additionally calls finished after each case has been run.
+// finished receives the runner that executed the case. This can be used to inspect the VMs after the run.
+func (t Test) RunEx(callback func(Case), finished func(*CaseRunner)) TestResult {
+	return t.RunParallel(nil, callback, finished)
+}
+
 // GetRunner creates an executable TestRunner for the given testcase
 func (t *Test) GetRunner(casenr int) (runner *CaseRunner, err error) {
 	c := t.Cases[casenr]
@@ -141,6 +275,7 @@ func (t *Test) GetRunner(casenr int) (runner *CaseRunner, err error) {
 			Test:           t,
 			StopConditions: make(map[string]*vm.Variable, len(t.Scripts)),
 			VMs:            t.previousRunner.VMs,
+			SourceMaps:     t.previousRunner.SourceMaps,
 			Done:           make(chan struct{}),
 			Paused:         true,
 		}
@@ -153,7 +288,19 @@ func (t *Test) GetRunner(casenr int) (runner *CaseRunner, err error) {
 			VMs:            make([]*vm.VM, len(t.Scripts)),
 			Done:           make(chan struct{}),
 		}
-		runner.VMs, runner.VarTranslations, err = t.createVMs(runner.Coordinator)
+		for _, device := range t.Devices {
+			err = runner.Coordinator.AddDevice(device)
+			if err != nil {
+				return nil, err
+			}
+		}
+		for _, relay := range t.Relays {
+			err = runner.Coordinator.AddRelay(relay)
+			if err != nil {
+				return nil, err
+			}
+		}
+		runner.VMs, runner.VarTranslations, runner.SourceMaps, err = t.createVMs(runner.Coordinator)
 		if err != nil {
 			return nil, err
 		}
@@ -161,10 +308,23 @@ func (t *Test) GetRunner(casenr int) (runner *CaseRunner, err error) {
 
 	t.previousRunner = runner
 
-	c.initializeVariables(runner.Coordinator)
+	err = c.initializeVariables(runner.Coordinator)
+	if err != nil {
+		return nil, err
+	}
 
 	runner.StopConditions = mergeStopConditions(t, &c)
 
+	runner.steps, err = newStepRunner(runner)
+	if err != nil {
+		return nil, err
+	}
+
+	runner.metrics = newMetricsRecorder(runner)
+	runner.Coordinator.SetRoundHandler(func(coord *vm.Coordinator, round int) {
+		runner.metrics.sample(coord, round-runner.metrics.startRounds)
+	})
+
 	casemaxlines := -1
 	if c.MaxLines > 0 {
 		casemaxlines = c.MaxLines + runner.VMs[0].GetExecutedLines()
@@ -172,16 +332,24 @@ func (t *Test) GetRunner(casenr int) (runner *CaseRunner, err error) {
 
 	vmsReachedMaxlines := 0
 
-	lineExecutedHandler := func(vm *vm.VM) bool {
+	lineExecutedHandler := func(v *vm.VM) bool {
+
+		runner.steps.lineExecuted(v, runner.Coordinator)
 
-		if (t.MaxLines > 0 && vm.GetExecutedLines() >= t.MaxLines) || (casemaxlines > 0 && vm.GetExecutedLines() >= casemaxlines) {
+		if (t.MaxLines > 0 && v.GetExecutedLines() >= t.MaxLines) || (casemaxlines > 0 && v.GetExecutedLines() >= casemaxlines) {
 			vmsReachedMaxlines++
 		}
 
 		stopConditionReached := vmsReachedMaxlines >= len(runner.VMs)
 
 		for name, want := range runner.StopConditions {
-			current, exists := vm.GetVariable(name)
+			var current *vm.Variable
+			var exists bool
+			if network, varname := splitVarname(name); network != "" {
+				current, exists = runner.Coordinator.GetNetworkVariable(network, varname)
+			} else {
+				current, exists = v.GetVariable(name)
+			}
 			if exists && current.Equals(want) {
 				// found a condition-variable
 				stopConditionReached = true
@@ -193,6 +361,8 @@ func (t *Test) GetRunner(casenr int) (runner *CaseRunner, err error) {
 			case <-runner.Done:
 				// channel is already closed
 			default:
+				runner.metrics.stop(runner)
+				runner.steps.stop()
 				close(runner.Done)
 				if !t.Sequential || casenr == len(t.Cases)-1 {
 					// terminate all VMs
@@ -219,24 +389,35 @@ func (t *Test) GetRunner(casenr int) (runner *CaseRunner, err error) {
 // initializeVariables adds the variables required for the testcase
 // to the variables of the given Coordinator
 func (c Case) initializeVariables(coord *vm.Coordinator) error {
-	for key, value := range c.Inputs {
+	return setVariables(coord, c.Inputs)
+}
+
+// setVariables sets the given global variables on the given Coordinator
+func setVariables(coord *vm.Coordinator, values map[string]interface{}) error {
+	for key, value := range values {
 		//key = strings.ToLower(key)
 		variable, err := vm.VariableFromType(value)
 		if err != nil {
 			return err
 		}
-		coord.SetVariable(prefixVarname(key), variable)
+		network, name := splitVarname(key)
+		coord.SetNetworkVariable(networkOrDefault(network), name, variable)
 	}
 	return nil
 }
 
-// createVMs creates and sets up the required vms for this test
+// createVMs creates and sets up the required vms for this test. Also adds the stubs of the test to coord
 // coord is the coordinator to use with the VMs
 // Run() has been called on the returned VMs, but they are paused until coord.Run() is called
-// Also returns variable-name translation-tables for nolol scripts
-func (t Test) createVMs(coord *vm.Coordinator) ([]*vm.VM, []map[string]string, error) {
+// Also returns variable-name translation-tables and source-maps for nolol scripts
+func (t Test) createVMs(coord *vm.Coordinator) ([]*vm.VM, []map[string]string, []*nolol.SourceMap, error) {
+	scriptNetworks, err := t.scriptNetworks()
+	if err != nil {
+		return nil, nil, nil, err
+	}
 	vms := make([]*vm.VM, len(t.Scripts))
 	translationTables := make([]map[string]string, len(t.Scripts))
+	sourceMaps := make([]*nolol.SourceMap, len(t.Scripts))
 	for i, script := range t.Scripts {
 		var v *vm.VM
 
@@ -246,27 +427,65 @@ func (t Test) createVMs(coord *vm.Coordinator) ([]*vm.VM, []map[string]string, e
 			converter.SetChipType(t.ChipType)
 			conv := converter.LoadFile(file).RunConversion()
 			translationTables[i] = conv.GetVariableTranslations()
+			sourceMaps[i] = conv.GetSourceMap()
 			prog, err := conv.Get()
 			if err != nil {
-				return nil, nil, err
+				return nil, nil, nil, err
 			}
 			v = vm.Create(prog)
 		} else {
 			scriptContent, err := t.GetScriptCode(i)
 			if err != nil {
-				return nil, nil, err
+				return nil, nil, nil, err
 			}
 			v, err = vm.CreateFromSource(string(scriptContent))
 			if err != nil {
-				return nil, nil, err
+				return nil, nil, nil, err
 			}
 		}
 
 		v.SetCoordinator(coord)
+		v.SetNetworks(scriptNetworks[script]...)
 		vms[i] = v
 		v.Resume()
 	}
-	return vms, translationTables, nil
+	for _, stub := range t.Stubs {
+		if len(stub.Networks) == 0 {
+			stub.Networks = scriptNetworks[stub.Name]
+		}
+		err = coord.AddStub(stub)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	return vms, translationTables, sourceMaps, nil
+}
+
+// scriptNetworks returns a map from script-name (or stub-name) to the networks the script is connected to
+func (t Test) scriptNetworks() (map[string][]string, error) {
+	known := make(map[string]bool, len(t.Scripts)+len(t.Stubs))
+	for _, script := range t.Scripts {
+		known[script] = true
+	}
+	for _, stub := range t.Stubs {
+		known[stub.Name] = true
+	}
+	networkNames := make([]string, 0, len(t.Networks))
+	for network := range t.Networks {
+		networkNames = append(networkNames, network)
+	}
+	// sort, to make the order of networks deterministic
+	sort.Strings(networkNames)
+	scriptNetworks := make(map[string][]string)
+	for _, network := range networkNames {
+		for _, script := range t.Networks[network] {
+			if !known[script] {
+				return nil, fmt.Errorf("Network '%s' contains the script '%s', which is not part of the test", network, script)
+			}
+			scriptNetworks[script] = append(scriptNetworks[script], network)
+		}
+	}
+	return scriptNetworks, nil
 }
 
 func mergeStopConditions(test *Test, c *Case) map[string]*vm.Variable {
@@ -288,11 +507,13 @@ func (cr CaseRunner) Run() []error {
 	fails := make([]error, 0)
 	flock := &sync.Mutex{}
 
-	errHandler := func(vm *vm.VM, err error) bool {
+	errHandler := func(v *vm.VM, err error) bool {
 		if !cr.Test.IgnoreErrs {
 			flock.Lock()
 			defer flock.Unlock()
-			fails = append(fails, err)
+			fails = append(fails, cr.locateError(v, err))
+			cr.metrics.stop(&cr)
+			cr.steps.stop()
 			go cr.Coordinator.Terminate()
 			close(cr.Done)
 			return false
@@ -314,14 +535,59 @@ func (cr CaseRunner) Run() []error {
 
 	caseFails := cr.Case.checkResults(cr.Coordinator)
 	fails = append(fails, caseFails...)
+	metricFails := cr.Case.checkMetrics(cr.Metrics(), cr.Test.Scripts)
+	fails = append(fails, metricFails...)
+	fails = append(fails, cr.steps.results()...)
 	return fails
 }
 
+// Metrics returns the measurements of the execution of the case. Only complete after Run() has returned
+func (cr CaseRunner) Metrics() Metrics {
+	return cr.metrics.get()
+}
+
+// locateError adds the name of the script and (for nolol-scripts) the location in the nolol-source to a runtime-error of v
+func (cr CaseRunner) locateError(v *vm.VM, err error) error {
+	for i := range cr.VMs {
+		if cr.VMs[i] == v {
+			var sm *nolol.SourceMap
+			if i < len(cr.SourceMaps) {
+				sm = cr.SourceMaps[i]
+			}
+			return fmt.Errorf("%s: %s", cr.Test.Scripts[i], LocateError(sm, v.LastAstLine(), err))
+		}
+	}
+	return err
+}
+
+// LocateError replaces the position of a runtime-error with the location of the failing statement in the nolol-source.
+// The location includes the macro-insertions and includes that produced the statement.
+// sm is the source-map of the executed program and yololLine the line of the generated code that caused the error.
+// If sm is nil or the location can not be found, err is returned unchanged
+func LocateError(sm *nolol.SourceMap, yololLine int, err error) error {
+	rterr, isRuntimeError := err.(vm.RuntimeError)
+	if sm == nil || !isRuntimeError {
+		return err
+	}
+	mapping, found := sm.Find(yololLine, rterr.Node.Start())
+	if !found {
+		return err
+	}
+	return fmt.Errorf("Runtime error at %s: %s", mapping, rterr.Base.Error())
+}
+
 // checkResults compares the global variables of coord with the expected results for c
 // and returns found errors
 func (c Case) checkResults(coord *vm.Coordinator) []error {
+	return checkOutputs(coord, c.Outputs, fmt.Sprintf("Case '%s'", c.Name))
+}
+
+// checkOutputs compares the global variables of coord with the expected outputs and returns found errors
+// context is used as prefix for the error-messages
+func checkOutputs(coord *vm.Coordinator, outputs map[string]interface{}, context string) []error {
 	fails := make([]error, 0)
-	for key, value := range c.Outputs {
+	for key, value := range outputs {
+		network, name := splitVarname(key)
 		key = prefixVarname(key)
 		var fail error
 		expected, err := vm.VariableFromType(value)
@@ -330,16 +596,16 @@ func (c Case) checkResults(coord *vm.Coordinator) []error {
 			fails = append(fails, fail)
 			continue
 		}
-		actual, exists := coord.GetVariable(key)
+		actual, exists := coord.GetNetworkVariable(networkOrDefault(network), name)
 
 		if !exists {
 			fail = fmt.Errorf("Expected output variable %s does not exist", key)
 		} else {
 			if !actual.SameType(expected) {
-				fail = fmt.Errorf("Case '%s': Output '%s' has type '%s' but should be '%s' ", c.Name, key, actual.TypeName(), expected.TypeName())
+				fail = fmt.Errorf("%s: Output '%s' has type '%s' but should be '%s' ", context, key, actual.TypeName(), expected.TypeName())
 
 			} else if !actual.Equals(expected) {
-				fail = fmt.Errorf("Case '%s': Output '%s' has value %s but should be %s ", c.Name, key, actual.Repr(), expected.Repr())
+				fail = fmt.Errorf("%s: Output '%s' has value %s but should be %s ", context, key, actual.Repr(), expected.Repr())
 			}
 		}
 		if fail != nil {
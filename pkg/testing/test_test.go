@@ -1,6 +1,12 @@
 package testing_test
 
 import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	thistesting "github.com/dbaumgarten/yodk/pkg/testing"
@@ -45,7 +51,7 @@ if :number%5==0 then :out+="buzz " end
 	test.ScriptContents = make([]string, 2)
 	test.ScriptContents[0] = script
 	test.ScriptContents[1] = script2
-	fails := test.Run(nil)
+	fails := test.Run(nil).Fails()
 	if len(fails) > 0 {
 		t.Log("Testcase had errors but should not")
 		for _, f := range fails {
@@ -55,8 +61,406 @@ if :number%5==0 then :out+="buzz " end
 	}
 
 	test.Cases[0].Outputs["number"] = 1337
-	fails = test.Run(nil)
+	fails = test.Run(nil).Fails()
 	if len(fails) != 1 {
 		t.Fatalf("Testcase should have 1 error, but had: %d", len(fails))
 	}
 }
+
+func TestMetrics(t *testing.T) {
+	testcase := `scripts: 
+    - counter.yolol
+cases:
+    - name: Counting
+      maxexecutedlines: 4
+      maxticks: 3
+      changes:
+        - variable: a
+          from: 2
+          to: 2
+          value: 2
+        - variable: b
+`
+	script := `:a++ :done=:a==3 goto 1`
+
+	test, err := thistesting.Parse([]byte(testcase), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.ScriptContents = []string{script}
+
+	runner, err := test.GetRunner(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fails := runner.Run()
+
+	metrics := runner.Metrics()
+	if metrics.Ticks != 3 || len(metrics.ExecutedLines) != 1 || metrics.ExecutedLines[0] != 3 {
+		t.Fatalf("Wrong metrics: %v", metrics)
+	}
+	if len(metrics.Changes[":a"]) != 3 || metrics.Changes[":a"][1].Tick != 2 {
+		t.Fatalf("Wrong changes for :a: %v", metrics.Changes[":a"])
+	}
+
+	// only the assertion for :b must fail
+	if len(fails) != 1 {
+		t.Fatalf("Testcase should have 1 error, but had: %v", fails)
+	}
+}
+
+func TestSteps(t *testing.T) {
+	testcase := `scripts: 
+    - steps.yolol
+maxlines: 20
+cases:
+    - name: Steps
+      steps:
+        - lines: 2
+          inputs:
+            a: 5
+        - when: ":b == 5"
+          outputs:
+            a: 6
+        - when: ":b == 100"
+`
+	script := `:b=:a
+:done=:b>5 goto 1`
+
+	test, err := thistesting.Parse([]byte(testcase), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.ScriptContents = []string{script}
+
+	fails := test.Run(nil).Fails()
+	// the output of the second step is wrong and the third step is never executed
+	if len(fails) != 2 {
+		t.Fatalf("Testcase should have 2 errors, but had: %v", fails)
+	}
+}
+
+func TestFuzz(t *testing.T) {
+	testcase := `scripts: 
+    - fuzz.yolol
+fuzz:
+    runs: 50
+    seed: 1
+    inputs:
+        a:
+            min: -100
+            max: 100
+        s:
+            maxlength: 5
+    invariant: ":out == :a*2 and :len == :s"
+`
+	script := `:out=:a*2 :len=:s :done=1`
+
+	test, err := thistesting.Parse([]byte(testcase), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.ScriptContents = []string{script}
+
+	fails := test.Run(nil).Fails()
+	if len(fails) > 0 {
+		t.Fatalf("Fuzzing should succeed, but failed with: %v", fails)
+	}
+
+	test.Fuzz.Invariant = ":out < 10"
+	fails = test.Run(nil).Fails()
+	if len(fails) != 2 {
+		t.Fatalf("Fuzzing should fail with 2 errors, but had: %v", fails)
+	}
+	// the inputs must be shrinked to the smallest failing values
+	if !strings.Contains(fails[0].Error(), `:a=5, :s=""`) {
+		t.Fatalf("Wrong counterexample: %s", fails[0])
+	}
+}
+
+func TestReports(t *testing.T) {
+	testcase := `scripts: 
+    - report.yolol
+cases:
+    - name: Passing
+      outputs:
+        out: 2
+    - name: Failing
+      outputs:
+        out: 3
+`
+	script := `:out=2 :done=1`
+
+	test, err := thistesting.Parse([]byte(testcase), "report_test.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.ScriptContents = []string{script}
+
+	result := test.Run(nil)
+	if len(result.Cases) != 2 || !result.Cases[0].Passed() || result.Cases[1].Passed() {
+		t.Fatalf("Wrong case-results: %v", result.Cases)
+	}
+	if result.Cases[0].Metrics.ExecutedLines[0] != 1 {
+		t.Fatalf("Wrong executed lines: %v", result.Cases[0].Metrics.ExecutedLines)
+	}
+
+	junit := &bytes.Buffer{}
+	err = thistesting.WriteJUnitReport(junit, []thistesting.TestResult{result})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(junit.String(), `<testsuite name="report_test.yaml" tests="2" failures="1"`) || !strings.Contains(junit.String(), `<failure message="Case &#39;Failing&#39;: Output &#39;:out&#39; has value 2 but should be 3 ">`) {
+		t.Fatalf("Wrong junit-report: %s", junit.String())
+	}
+
+	jsonReport := &bytes.Buffer{}
+	err = thistesting.WriteJSONReport(jsonReport, []thistesting.TestResult{result})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var parsed struct {
+		Passed bool
+		Files  []struct {
+			Cases []struct {
+				Name          string
+				ExecutedLines map[string]int
+				Failures      []string
+			}
+		}
+	}
+	err = json.Unmarshal(jsonReport.Bytes(), &parsed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Passed || len(parsed.Files) != 1 || len(parsed.Files[0].Cases[1].Failures) != 1 || parsed.Files[0].Cases[0].ExecutedLines["report.yolol"] != 1 {
+		t.Fatalf("Wrong json-report: %s", jsonReport.String())
+	}
+}
+
+func TestParallel(t *testing.T) {
+	testcase := `scripts: 
+    - parallel.yolol
+cases:
+    - name: Slow
+      inputs:
+        n: 200
+      outputs:
+        out: 200
+    - name: Fast
+      inputs:
+        n: 1
+      outputs:
+        out: 1
+    - name: Failing
+      inputs:
+        n: 5
+      outputs:
+        out: 6
+    - name: Medium
+      inputs:
+        n: 50
+      outputs:
+        out: 50
+`
+	script := `:out++ :done=:out>=:n goto 1`
+
+	test, err := thistesting.Parse([]byte(testcase), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.ScriptContents = []string{script}
+
+	started := make([]string, 0)
+	result := test.RunParallel(thistesting.NewLimiter(4), func(c thistesting.Case) {
+		started = append(started, c.Name)
+	}, nil)
+
+	expected := []string{"Slow", "Fast", "Failing", "Medium"}
+	for i, name := range expected {
+		if started[i] != name || result.Cases[i].Name != name {
+			t.Fatalf("Cases are not reported in order: started %v, results %v", started, result.Cases)
+		}
+		if result.Cases[i].Passed() != (name != "Failing") {
+			t.Fatalf("Wrong result for case %s: %v", name, result.Cases[i].Fails)
+		}
+	}
+	if result.Cases[0].Metrics.ExecutedLines[0] != 200 {
+		t.Fatalf("The cases influenced each other: %v", result.Cases[0].Metrics)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	testcase := `scripts: 
+    - snapshot.yolol
+snapshot: true
+cases:
+    - name: First
+      inputs:
+        a: 1
+    - name: Second
+      inputs:
+        a: 2.5
+`
+	script := `:b=:a*2 :c="x"+:a :done=1`
+
+	dir, err := ioutil.TempDir("", "snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	test, err := thistesting.Parse([]byte(testcase), filepath.Join(dir, "snapshot_test.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.ScriptContents = []string{script}
+
+	// there is no snapshot yet
+	fails := test.Run(nil).Fails()
+	if len(fails) != 1 {
+		t.Fatalf("Test should fail because of the missing snapshot, but had: %v", fails)
+	}
+
+	test.UpdateSnapshots = true
+	fails = test.Run(nil).Fails()
+	if len(fails) != 0 {
+		t.Fatalf("Recording the snapshot failed: %v", fails)
+	}
+
+	test.UpdateSnapshots = false
+	fails = test.Run(nil).Fails()
+	if len(fails) != 0 {
+		t.Fatalf("Test should match the snapshot, but had: %v", fails)
+	}
+
+	test.ScriptContents = []string{`:b=:a*3 :c="x"+:a :done=1`}
+	fails = test.Run(nil).Fails()
+	if len(fails) != 2 || !strings.Contains(fails[1].Error(), "Variable ':b' is 7.5, but 5 in the snapshot") {
+		t.Fatalf("Test should differ from the snapshot, but had: %v", fails)
+	}
+}
+
+func TestFixtures(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fixtures")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fixture := `setup:
+    a: 1
+    b: 2
+cases:
+    - name: FromFixture
+      outputs:
+        sum: 3
+`
+	err = ioutil.WriteFile(filepath.Join(dir, "fixture.yaml"), []byte(fixture), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "cycle.yaml"), []byte("imports:\n    - cycle.yaml\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testcase := `scripts: 
+    - fixtures.yolol
+imports:
+    - fixture.yaml
+setup:
+    b: 10
+cases:
+    - name: "Sum {a}"
+      parameters:
+        - {a: 1, sum: 11}
+        - {a: 5, sum: 15}
+      inputs:
+        a: "{a}"
+      outputs:
+        sum: "{sum}"
+`
+	test, err := thistesting.Parse([]byte(testcase), filepath.Join(dir, "fixtures_test.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.ScriptContents = []string{`:sum=:a+:b :done=1`}
+	names := make([]string, len(test.Cases))
+	for i, c := range test.Cases {
+		names[i] = c.Name
+	}
+	if strings.Join(names, ",") != "FromFixture,Sum 1,Sum 5" {
+		t.Fatalf("Wrong cases: %v", names)
+	}
+	// the setup of the test overrides the setup of the fixture
+	fails := test.Run(nil).Fails()
+	if len(fails) != 1 || !strings.Contains(fails[0].Error(), "'FromFixture'") {
+		t.Fatalf("Only the case from the fixture should fail, but got: %v", fails)
+	}
+
+	invalid := map[string]string{
+		"imports:\n    - missing.yaml\n":                                                       "Could not load fixture",
+		"imports:\n    - cycle.yaml\n":                                                         "Import-cycle detected",
+		"cases:\n    - name: NoPlaceholder\n      parameters:\n        - {a: 1}\n":             "must contain at least one parameter",
+		"cases:\n    - name: \"{a}\"\n      parameters:\n        - {b: 1}\n":                   "Unknown parameters: a",
+		"cases:\n    - name: \"{a}\"\n      parameters:\n        - {a: 1}\n        - {a: 1}\n": "result in the same name",
+	}
+	for content, expected := range invalid {
+		_, err := thistesting.Parse([]byte(content), filepath.Join(dir, "invalid_test.yaml"))
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Fatalf("Parsing should fail with '%s', but got: %v", expected, err)
+		}
+	}
+}
+
+func TestDependencies(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dependencies")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"fixture.yaml":       "setup:\n    a: 1\n",
+		"main.nolol":         "include \"inc/included\"\ninclude \"util\"\n:b = :a\n",
+		"inc/included.nolol": "include \"util\"\n:c = 1\n",
+		"util.nolol":         ":d = 1\n",
+		// included by inc/included.nolol. Has the same name as the file included by main.nolol
+		"inc/util.nolol": ":e = 1\n",
+	}
+	for name, content := range files {
+		err = os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testcase := `scripts: 
+    - main.nolol
+imports:
+    - fixture.yaml
+cases:
+    - name: Test
+`
+	test, err := thistesting.Parse([]byte(testcase), filepath.Join(dir, "main_test.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		filepath.Join(dir, "main_test.yaml"),
+		filepath.Join(dir, "fixture.yaml"),
+		filepath.Join(dir, "main.nolol"),
+		filepath.Join(dir, "inc", "included.nolol"),
+		filepath.Join(dir, "inc", "util.nolol"),
+		filepath.Join(dir, "util.nolol"),
+	}
+	deps := test.Dependencies()
+	if strings.Join(deps, ",") != strings.Join(expected, ",") {
+		t.Fatalf("Wrong dependencies. Expected %v, but got %v", expected, deps)
+	}
+}
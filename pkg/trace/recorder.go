@@ -0,0 +1,170 @@
+package trace
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/dbaumgarten/yodk/pkg/vm"
+)
+
+// Recorder records the execution of one or more VMs into a Trace
+type Recorder struct {
+	trace *Trace
+	// variable-changes of the currently executed line of each vm
+	pending map[int][]VariableChange
+	// writes to global variables that have not been performed by a recorded vm
+	external []VariableChange
+	// the indices of the attached vms
+	vms map[*vm.VM]int
+	// if true, global variables are recorded by the coordinator and not by the vms
+	coordinated bool
+	lock        *sync.Mutex
+}
+
+// NewRecorder creates a new recorder. scripts are the names of the scripts that are recorded
+func NewRecorder(scripts []string) *Recorder {
+	return &Recorder{
+		trace: &Trace{
+			Version:  FormatVersion,
+			Scripts:  scripts,
+			Networks: make([][]string, len(scripts)),
+			Globals:  make(map[string]map[string]string),
+			Entries:  make([]Entry, 0, 1000),
+		},
+		pending: make(map[int][]VariableChange),
+		vms:     make(map[*vm.VM]int),
+		lock:    &sync.Mutex{},
+	}
+}
+
+// Attach hooks the recorder into the given vm. index is the index of the vm's script (see NewRecorder)
+// Already registered LineExecuted- and ErrorHandlers are preserved and called after the recording.
+// MUST be called before the vm starts executing, and after all other handlers have been set.
+func (r *Recorder) Attach(v *vm.VM, index int) {
+	prevLineHandler := v.GetLineExecutedHandler()
+	prevErrHandler := v.GetErrorHandler()
+
+	r.lock.Lock()
+	r.vms[v] = index
+	r.trace.Networks[index] = v.GetNetworks()
+	r.lock.Unlock()
+
+	v.SetVariableChangedHandler(func(v *vm.VM, name string, oldValue *vm.Variable, newValue *vm.Variable) {
+		change := newVariableChange(name, oldValue, newValue)
+		r.lock.Lock()
+		defer r.lock.Unlock()
+		if strings.HasPrefix(name, ":") {
+			if r.coordinated {
+				// recorded (for every written network) by the coordinator
+				return
+			}
+			change.Network = vm.DefaultNetwork
+		}
+		r.pending[index] = append(r.pending[index], change)
+	})
+
+	v.SetLineExecutedHandler(func(v *vm.VM) bool {
+		r.record(v, index, nil)
+		if prevLineHandler != nil {
+			return prevLineHandler(v)
+		}
+		return true
+	})
+
+	v.SetErrorHandler(func(v *vm.VM, err error) bool {
+		r.record(v, index, err)
+		if prevErrHandler != nil {
+			return prevErrHandler(v, err)
+		}
+		// without an error-handler, the vm would terminate on errors
+		go v.Terminate()
+		return false
+	})
+}
+
+// AttachCoordinator hooks the recorder into the given coordinator, so every write to a global variable is recorded on the network it happened.
+// This includes the writes of simulated devices, stubs, relays and test-steps, which are recorded as External entries.
+// The current values of the global variables of all networks are stored as the initial state of the trace.
+// Already registered GlobalChangedHandlers are preserved. MUST be called before the execution starts.
+func (r *Recorder) AttachCoordinator(c *vm.Coordinator) {
+	prevHandler := c.GetGlobalChangedHandler()
+
+	r.lock.Lock()
+	r.coordinated = true
+	for _, network := range c.GetNetworks() {
+		globals := make(map[string]string)
+		for name, value := range c.GetNetworkVariables(network) {
+			globals[name] = value.Repr()
+		}
+		r.trace.Globals[network] = globals
+	}
+	r.lock.Unlock()
+
+	c.SetGlobalChangedHandler(func(c *vm.Coordinator, writer *vm.VM, network string, name string, oldValue *vm.Variable, newValue *vm.Variable) {
+		change := newVariableChange(name, oldValue, newValue)
+		change.Network = network
+		r.lock.Lock()
+		if index, recorded := r.vms[writer]; writer != nil && recorded {
+			r.pending[index] = append(r.pending[index], change)
+		} else {
+			r.external = append(r.external, change)
+		}
+		r.lock.Unlock()
+		if prevHandler != nil {
+			prevHandler(c, writer, network, name, oldValue, newValue)
+		}
+	})
+}
+
+// newVariableChange creates a VariableChange for the given write
+func newVariableChange(name string, oldValue *vm.Variable, newValue *vm.Variable) VariableChange {
+	change := VariableChange{
+		Name: name,
+		New:  newValue.Repr(),
+	}
+	if oldValue != nil {
+		change.Old = oldValue.Repr()
+		change.Existed = true
+	}
+	return change
+}
+
+// record adds a new entry for the line that has just been executed by the given vm
+func (r *Recorder) record(v *vm.VM, index int, err error) {
+	entry := Entry{
+		VM:           index,
+		AstLine:      v.LastAstLine(),
+		SourceLine:   v.CurrentSourceLine(),
+		SourceColumn: v.CurrentSourceColoumn(),
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.flushExternal()
+	entry.Changes = r.pending[index]
+	delete(r.pending, index)
+	r.trace.Entries = append(r.trace.Entries, entry)
+}
+
+// flushExternal adds an External entry for the writes that happened since the last recorded entry
+// Does not use the lock. ONLY USE WHEN LOCK IS ALREADY HELD
+func (r *Recorder) flushExternal() {
+	if len(r.external) == 0 {
+		return
+	}
+	r.trace.Entries = append(r.trace.Entries, Entry{
+		VM:      External,
+		Changes: r.external,
+	})
+	r.external = nil
+}
+
+// Trace returns the recorded trace. Do not call this while the recorded VMs are still running
+func (r *Recorder) Trace() *Trace {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.flushExternal()
+	return r.trace
+}
@@ -0,0 +1,174 @@
+package trace
+
+import (
+	"strings"
+
+	"github.com/dbaumgarten/yodk/pkg/vm"
+)
+
+// Replayer steps through a recorded trace and reconstructs the state of the variables at every point of the trace
+// Global variables are reconstructed per network
+type Replayer struct {
+	trace *Trace
+	// number of entries that have been applied
+	position int
+	// the global variables of each network
+	globals map[string]map[string]*vm.Variable
+	locals  []map[string]*vm.Variable
+}
+
+// NewReplayer creates a replayer for the given trace. The replayer is positioned before the first entry
+func NewReplayer(t *Trace) *Replayer {
+	r := &Replayer{
+		trace:   t,
+		globals: make(map[string]map[string]*vm.Variable, len(t.Globals)),
+		locals:  make([]map[string]*vm.Variable, len(t.Scripts)),
+	}
+	for network, globals := range t.Globals {
+		for name, value := range globals {
+			r.network(network)[name] = vm.VariableFromString(value)
+		}
+	}
+	for i := range r.locals {
+		r.locals[i] = make(map[string]*vm.Variable)
+	}
+	return r
+}
+
+// Trace returns the replayed trace
+func (r *Replayer) Trace() *Trace {
+	return r.trace
+}
+
+// Position returns the number of entries that have been replayed so far
+func (r *Replayer) Position() int {
+	return r.position
+}
+
+// Len returns the number of entries in the replayed trace
+func (r *Replayer) Len() int {
+	return len(r.trace.Entries)
+}
+
+// Current returns the entry that has been replayed last. Returns nil if no entry has been replayed yet
+func (r *Replayer) Current() *Entry {
+	if r.position == 0 {
+		return nil
+	}
+	return &r.trace.Entries[r.position-1]
+}
+
+// Step replays the next entry. Returns false if the end of the trace has been reached
+func (r *Replayer) Step() bool {
+	if r.position >= len(r.trace.Entries) {
+		return false
+	}
+	entry := r.trace.Entries[r.position]
+	for _, change := range entry.Changes {
+		r.scope(entry.VM, change)[change.Name] = vm.VariableFromString(change.New)
+	}
+	r.position++
+	return true
+}
+
+// StepBack undoes the last replayed entry. Returns false if the start of the trace has been reached
+func (r *Replayer) StepBack() bool {
+	if r.position == 0 {
+		return false
+	}
+	entry := r.trace.Entries[r.position-1]
+	// undo the changes in reverse order
+	for i := len(entry.Changes) - 1; i >= 0; i-- {
+		change := entry.Changes[i]
+		scope := r.scope(entry.VM, change)
+		if change.Existed {
+			scope[change.Name] = vm.VariableFromString(change.Old)
+		} else {
+			delete(scope, change.Name)
+		}
+	}
+	r.position--
+	return true
+}
+
+// StepVM replays entries until an entry of the given vm has been replayed
+// Returns false if the end of the trace has been reached
+func (r *Replayer) StepVM(vmidx int) bool {
+	for r.Step() {
+		if r.Current().VM == vmidx {
+			return true
+		}
+	}
+	return false
+}
+
+// StepBackVM undoes entries until the last replayed entry belongs to the given vm
+// Returns false if the start of the trace has been reached
+func (r *Replayer) StepBackVM(vmidx int) bool {
+	for r.StepBack() {
+		if r.Current() != nil && r.Current().VM == vmidx {
+			return true
+		}
+	}
+	return false
+}
+
+// Seek moves the replayer to the given position (number of replayed entries)
+func (r *Replayer) Seek(position int) {
+	for r.position < position && r.Step() {
+	}
+	for r.position > position && r.StepBack() {
+	}
+}
+
+// GetVariables returns the variables (local and global) of the given vm at the current position
+// Global variables are read from the networks of the vm. If a variable exists on multiple networks, the value from the first of the networks is used
+func (r *Replayer) GetVariables(vmidx int) map[string]vm.Variable {
+	varlist := make(map[string]vm.Variable)
+	var networks []string
+	if vmidx < len(r.trace.Networks) {
+		networks = r.trace.Networks[vmidx]
+	}
+	if len(networks) == 0 {
+		networks = []string{vm.DefaultNetwork}
+	}
+	for i := len(networks) - 1; i >= 0; i-- {
+		for name, value := range r.globals[networks[i]] {
+			varlist[name] = *value
+		}
+	}
+	for name, value := range r.locals[vmidx] {
+		varlist[name] = *value
+	}
+	return varlist
+}
+
+// GetNetworkVariables returns the global variables of the given network at the current position
+func (r *Replayer) GetNetworkVariables(network string) map[string]vm.Variable {
+	varlist := make(map[string]vm.Variable)
+	for name, value := range r.globals[network] {
+		varlist[name] = *value
+	}
+	return varlist
+}
+
+// scope returns the variable-map that contains the changed variable
+func (r *Replayer) scope(vmidx int, change VariableChange) map[string]*vm.Variable {
+	if strings.HasPrefix(change.Name, ":") {
+		if change.Network == "" {
+			return r.network(vm.DefaultNetwork)
+		}
+		return r.network(change.Network)
+	}
+	return r.locals[vmidx]
+}
+
+// network returns the variables of the given network. Creates the network if it does not exist
+func (r *Replayer) network(name string) map[string]*vm.Variable {
+	net, exists := r.globals[name]
+	if !exists {
+		net = make(map[string]*vm.Variable)
+		r.globals[name] = net
+	}
+	return net
+}
@@ -0,0 +1,106 @@
+package trace
+
+import (
+	"compress/gzip"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+)
+
+// FormatVersion is the version of the trace-file format. Stored in every trace to detect incompatible files
+const FormatVersion = 2
+
+// External is the value of Entry.VM for entries that record writes not performed by a script (devices, stubs, relays, test-steps, ...)
+const External = -1
+
+// VariableChange describes a single write to a variable
+type VariableChange struct {
+	// The (lowercased) name of the variable
+	Name string
+	// The network the (global) variable has been written on. Empty for local variables
+	Network string
+	// The value before the write (see vm.Variable.Repr()). Empty if the variable did not exist before
+	Old string
+	// The value after the write (see vm.Variable.Repr())
+	New string
+	// True if the variable did exist before the write
+	Existed bool
+}
+
+// Entry is the record of a single executed line, or of writes to global variables that happened outside of the scripts
+type Entry struct {
+	// The index of the vm (script) that executed the line. External if the entry does not belong to a script
+	VM int
+	// The executed ast-line (the line of the yolol-code)
+	AstLine int
+	// The source-line and -column of the last executed statement. Differs from AstLine when running nolol
+	SourceLine   int
+	SourceColumn int
+	// All writes to variables performed by the line, in the order they happened
+	Changes []VariableChange
+	// If the line caused a runtime-error, this contains the error-message
+	Error string
+}
+
+// Trace is the recording of a (coordinated) run of one or more scripts
+type Trace struct {
+	Version int
+	// The names of the scripts that have been run. Indexed by Entry.VM
+	Scripts []string
+	// The networks each script has been connected to. Indexed by Entry.VM
+	Networks [][]string
+	// The values of the global variables of each network before the first recorded line (see vm.Variable.Repr())
+	Globals map[string]map[string]string
+	// The executed lines, in order of execution
+	Entries []Entry
+}
+
+// Write writes the trace in the compact (gzipped, binary) trace-format to w
+func (t *Trace) Write(w io.Writer) error {
+	gz := gzip.NewWriter(w)
+	t.Version = FormatVersion
+	err := gob.NewEncoder(gz).Encode(t)
+	if err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// Read reads a trace in the compact trace-format from r
+func Read(r io.Reader) (*Trace, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("The given file is not a valid trace: %s", err.Error())
+	}
+	defer gz.Close()
+	var t Trace
+	err = gob.NewDecoder(gz).Decode(&t)
+	if err != nil {
+		return nil, fmt.Errorf("The given file is not a valid trace: %s", err.Error())
+	}
+	if t.Version != FormatVersion {
+		return nil, fmt.Errorf("Unsupported trace-version %d. Expected version %d", t.Version, FormatVersion)
+	}
+	return &t, nil
+}
+
+// Save writes the trace to the given file
+func (t *Trace) Save(filename string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return t.Write(f)
+}
+
+// Load reads a trace from the given file
+func Load(filename string) (*Trace, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Read(f)
+}
@@ -0,0 +1,108 @@
+package trace_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/dbaumgarten/yodk/pkg/trace"
+	"github.com/dbaumgarten/yodk/pkg/vm"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	prog := "a = 1\n:b = a + 1 goto 3\nif :b > 0 then a++ end"
+	coord := vm.NewCoordinator()
+	v, _ := vm.CreateFromSource(prog)
+	v.SetCoordinator(coord)
+	v.SetMaxExecutedLines(2)
+
+	recorder := trace.NewRecorder([]string{"test.yolol"})
+	recorder.Attach(v, 0)
+
+	v.Resume()
+	coord.Run()
+	coord.WaitForTermination()
+
+	buf := &bytes.Buffer{}
+	err := recorder.Trace().Write(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr, err := trace.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tr.Entries) != 3 {
+		t.Fatalf("Expected 3 recorded lines, but got %d", len(tr.Entries))
+	}
+	for i, entry := range tr.Entries {
+		if entry.AstLine != i+1 {
+			t.Fatalf("Entry %d should be for line %d, but is for line %d", i, i+1, entry.AstLine)
+		}
+	}
+
+	replayer := trace.NewReplayer(tr)
+	replayer.Seek(replayer.Len())
+	vars := replayer.GetVariables(0)
+	if a := vars["a"]; a.Itoa() != "2" {
+		t.Fatalf("a should be 2 at the end of the trace, but is %s", a.Itoa())
+	}
+	if b := vars[":b"]; b.Itoa() != "2" {
+		t.Fatalf(":b should be 2 at the end of the trace, but is %s", b.Itoa())
+	}
+
+	replayer.StepBack()
+	if a := replayer.GetVariables(0)["a"]; a.Itoa() != "1" {
+		t.Fatalf("a should be 1 after stepping back, but is %s", a.Itoa())
+	}
+
+	replayer.Seek(0)
+	if len(replayer.GetVariables(0)) != 0 {
+		t.Fatal("There should be no variables at the start of the trace")
+	}
+}
+
+func TestRecordNetworksAndExternalWrites(t *testing.T) {
+	coord := vm.NewCoordinator()
+	coord.SetNetworkVariable("other", ":x", &vm.Variable{Value: "initial"})
+	v1, _ := vm.CreateFromSource(":x = 1")
+	v2, _ := vm.CreateFromSource(":x = 2")
+	v1.SetCoordinator(coord)
+	v2.SetCoordinator(coord)
+	v2.SetNetworks("other")
+	v1.SetMaxExecutedLines(1)
+	v2.SetMaxExecutedLines(1)
+
+	recorder := trace.NewRecorder([]string{"a.yolol", "b.yolol"})
+	recorder.Attach(v1, 0)
+	recorder.Attach(v2, 1)
+	recorder.AttachCoordinator(coord)
+
+	v1.Resume()
+	v2.Resume()
+	coord.Run()
+	coord.WaitForTermination()
+	// a write that is not performed by a script (like a device or a test-step would do)
+	coord.SetVariable(":y", &vm.Variable{Value: "ext"})
+
+	tr := recorder.Trace()
+	last := tr.Entries[len(tr.Entries)-1]
+	if last.VM != trace.External || len(last.Changes) != 1 || last.Changes[0].Name != ":y" {
+		t.Fatalf("The external write should have been recorded as last entry, but got: %v", last)
+	}
+
+	replayer := trace.NewReplayer(tr)
+	if x := replayer.GetVariables(1)[":x"]; x.Repr() != "\"initial\"" {
+		t.Fatalf(":x should initially be \"initial\" on the network of b.yolol, but is %s", x.Repr())
+	}
+	replayer.Seek(replayer.Len())
+	if x := replayer.GetVariables(0)[":x"]; x.Itoa() != "1" {
+		t.Fatalf(":x should be 1 for a.yolol, but is %s", x.Repr())
+	}
+	if x := replayer.GetVariables(1)[":x"]; x.Itoa() != "2" {
+		t.Fatalf(":x should be 2 for b.yolol, but is %s", x.Repr())
+	}
+	if y := replayer.GetNetworkVariables(vm.DefaultNetwork)[":y"]; y.Repr() != "\"ext\"" {
+		t.Fatalf(":y should have been replayed, but is %s", y.Repr())
+	}
+}
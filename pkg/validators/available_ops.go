@@ -43,6 +43,20 @@ func contains(list []string, element string) bool {
 	return false
 }
 
+// ChipTypes contains all chip-types, from the least to the most capable one
+var ChipTypes = []string{ChipTypeBasic, ChipTypeAdvanced, ChipTypeProfessional}
+
+// AvailableChipTypes returns the chip-types on which the given operator (or function) is available
+func AvailableChipTypes(op string) []string {
+	available := make([]string, 0, len(ChipTypes))
+	for _, chiptype := range ChipTypes {
+		if !contains(unavailableBinaryOps[chiptype], op) && !contains(unavailableUnaryOps[chiptype], op) && !contains(unavailableAssignments[chiptype], op) {
+			available = append(available, chiptype)
+		}
+	}
+	return available
+}
+
 var filenameChiptypeRegex = regexp.MustCompile(".*_(basic|advanced|professional).(?:n|y)olol")
 
 // AutoChooseChipType chooses a chip-type based on the provided type and the filename of the source-file
@@ -1,6 +1,7 @@
 package validators_test
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/dbaumgarten/yodk/pkg/nolol"
@@ -165,3 +166,18 @@ func TestAvailableOps(t *testing.T) {
 
 	}
 }
+
+func TestAvailableChipTypes(t *testing.T) {
+	testdata := map[string][]string{
+		"+":    {validators.ChipTypeBasic, validators.ChipTypeAdvanced, validators.ChipTypeProfessional},
+		"%=":   {validators.ChipTypeAdvanced, validators.ChipTypeProfessional},
+		"abs":  {validators.ChipTypeAdvanced, validators.ChipTypeProfessional},
+		"atan": {validators.ChipTypeProfessional},
+	}
+	for op, wanted := range testdata {
+		available := validators.AvailableChipTypes(op)
+		if strings.Join(available, ",") != strings.Join(wanted, ",") {
+			t.Fatalf("Wrong chip-types for '%s': %v", op, available)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package vm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/dbaumgarten/yodk/pkg/number"
+	"github.com/dbaumgarten/yodk/pkg/parser"
+	"github.com/dbaumgarten/yodk/pkg/parser/ast"
+)
+
+// the operators that can be used in the hit-condition of a breakpoint. Longer operators first, to simplify parsing
+var hitOperators = []string{"==", "!=", "<=", ">=", "<", ">", "%"}
+
+// LogpointFunc is a function that is called when a breakpoint with a log-message is hit.
+// message is the log-message of the breakpoint with all expressions replaced by their values.
+// Logpoints never pause the execution
+type LogpointFunc func(vm *VM, bp Breakpoint, message string)
+
+// Breakpoint pauses the execution when the source-line is reached
+type Breakpoint struct {
+	// The source-line of the breakpoint
+	Line int
+	// An optional yolol-expression. The breakpoint only triggers if the expression evaluates to a non-zero number
+	Condition string
+	// An optional condition for the number of times the breakpoint has been hit (with a fulfilled condition).
+	// Has the form "<operator> <number>", e.g. "== 5" or "% 2". A number without operator is the same as ">= number"
+	HitCondition string
+	// If set, the breakpoint does not pause the execution, but logs this message.
+	// Expressions in curly braces are replaced by their values, e.g. "a is {a}"
+	LogMessage string
+	// the parsed conditions
+	condition   ast.Expression
+	hitOperator string
+	hitValue    int
+	// the parsed log-message
+	logParts []logPart
+	// number of times the breakpoint has been hit
+	hits int
+}
+
+// logPart is either a literal text or an expression of a log-message
+type logPart struct {
+	text string
+	expr ast.Expression
+}
+
+// NewBreakpoint creates a new breakpoint and validates its parameters.
+// condition, hitCondition and logMessage are optional and can be empty
+func NewBreakpoint(line int, condition string, hitCondition string, logMessage string) (Breakpoint, error) {
+	bp := Breakpoint{
+		Line:         line,
+		Condition:    strings.TrimSpace(condition),
+		HitCondition: strings.TrimSpace(hitCondition),
+		LogMessage:   logMessage,
+	}
+
+	if bp.Condition != "" {
+		expr, err := parseConditionExpression(bp.Condition)
+		if err != nil {
+			return bp, fmt.Errorf("Invalid breakpoint-condition '%s': %s", bp.Condition, err.Error())
+		}
+		bp.condition = expr
+	}
+
+	if bp.HitCondition != "" {
+		bp.hitOperator = ">="
+		value := bp.HitCondition
+		for _, op := range hitOperators {
+			if strings.HasPrefix(value, op) {
+				bp.hitOperator = op
+				value = strings.TrimSpace(value[len(op):])
+				break
+			}
+		}
+		count, err := strconv.Atoi(value)
+		if err != nil || count < 0 || (bp.hitOperator == "%" && count == 0) {
+			return bp, fmt.Errorf("Invalid hit-condition '%s'. The hit-condition must be a positive number, optionally prefixed by one of %s", bp.HitCondition, strings.Join(hitOperators, ", "))
+		}
+		bp.hitValue = count
+	}
+
+	if bp.LogMessage != "" {
+		parts, err := parseLogMessage(bp.LogMessage)
+		if err != nil {
+			return bp, fmt.Errorf("Invalid log-message '%s': %s", bp.LogMessage, err.Error())
+		}
+		bp.logParts = parts
+	}
+
+	return bp, nil
+}
+
+// IsLogpoint returns true if the breakpoint logs a message instead of pausing the execution
+func (bp Breakpoint) IsLogpoint() bool {
+	return bp.LogMessage != ""
+}
+
+// TranslateVariables renames the variables used in the condition and the log-message of the breakpoint.
+// Necessary if the variable-names of the source-code differ from the ones of the executed program (e.g. for nolol)
+func (bp Breakpoint) TranslateVariables(translate func(name string) string) {
+	rename := ast.VisitorFunc(func(node ast.Node, visitType int) error {
+		if deref, is := node.(*ast.Dereference); is {
+			deref.Variable = translate(deref.Variable)
+		}
+		return nil
+	})
+	if bp.condition != nil {
+		bp.condition.Accept(rename)
+	}
+	for _, part := range bp.logParts {
+		if part.expr != nil {
+			part.expr.Accept(rename)
+		}
+	}
+}
+
+// matchesHitCount checks if the given number of hits fulfills the hit-condition
+func (bp Breakpoint) matchesHitCount(hits int) bool {
+	switch bp.hitOperator {
+	case "==":
+		return hits == bp.hitValue
+	case "!=":
+		return hits != bp.hitValue
+	case "<=":
+		return hits <= bp.hitValue
+	case ">=":
+		return hits >= bp.hitValue
+	case "<":
+		return hits < bp.hitValue
+	case ">":
+		return hits > bp.hitValue
+	case "%":
+		return hits%bp.hitValue == 0
+	}
+	return true
+}
+
+// parseConditionExpression parses an expression used in a breakpoint.
+// The evaluation of these expressions must not modify any variables
+func parseConditionExpression(expr string) (ast.Expression, error) {
+	parsed, err := parser.NewParser().ParseExpressionString(expr)
+	if err != nil {
+		return nil, err
+	}
+	err = parsed.Accept(ast.VisitorFunc(func(node ast.Node, visitType int) error {
+		if deref, is := node.(*ast.Dereference); is && deref.Operator != "" {
+			return fmt.Errorf("Expressions in breakpoints can not use %s", deref.Operator)
+		}
+		return nil
+	}))
+	if err != nil {
+		return nil, err
+	}
+	return parsed, nil
+}
+
+// parseLogMessage splits a log-message into literal texts and the expressions enclosed in curly braces
+func parseLogMessage(message string) ([]logPart, error) {
+	parts := make([]logPart, 0)
+	for len(message) > 0 {
+		start := strings.Index(message, "{")
+		if start < 0 {
+			parts = append(parts, logPart{text: message})
+			break
+		}
+		end := strings.Index(message[start:], "}")
+		if end < 0 {
+			return nil, fmt.Errorf("Missing closing '}'")
+		}
+		end += start
+		expr, err := parseConditionExpression(message[start+1 : end])
+		if err != nil {
+			return nil, err
+		}
+		if start > 0 {
+			parts = append(parts, logPart{text: message[:start]})
+		}
+		parts = append(parts, logPart{expr: expr})
+		message = message[end+1:]
+	}
+	return parts, nil
+}
+
+// SetBreakpoint adds the given breakpoint to the vm. An existing breakpoint on the same line is replaced.
+// Use NewBreakpoint() to create breakpoints with conditions or log-messages
+func (v *VM) SetBreakpoint(bp Breakpoint) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	bp.hits = 0
+	v.breakpoints[bp.Line] = &bp
+}
+
+// GetBreakpoints returns all active breakpoints
+func (v *VM) GetBreakpoints() []Breakpoint {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	li := make([]Breakpoint, 0, len(v.breakpoints))
+	for _, bp := range v.breakpoints {
+		li = append(li, *bp)
+	}
+	return li
+}
+
+// SetLogpointHandler sets the function to be called when a breakpoint with a log-message is hit
+func (v *VM) SetLogpointHandler(f LogpointFunc) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.logpointHandler = f
+}
+
+// breakpointTriggered checks the conditions of the breakpoint and counts the hit
+// Does not use the lock. ONLY USE WHEN LOCK IS ALREADY HELD
+func (v *VM) breakpointTriggered(bp *Breakpoint) bool {
+	if bp.condition != nil {
+		result, err := v.evaluate(bp.condition)
+		// a broken condition triggers the breakpoint, so the user notices the problem
+		if err == nil && (!result.IsNumber() || result.Number() == number.Zero) {
+			return false
+		}
+	}
+	bp.hits++
+	return bp.matchesHitCount(bp.hits)
+}
+
+// formatLogMessage returns the log-message of the breakpoint with all expressions replaced by their current values
+// Does not use the lock. ONLY USE WHEN LOCK IS ALREADY HELD
+func (v *VM) formatLogMessage(bp *Breakpoint) string {
+	var sb strings.Builder
+	for _, part := range bp.logParts {
+		if part.expr == nil {
+			sb.WriteString(part.text)
+			continue
+		}
+		value, err := v.evaluate(part.expr)
+		if err != nil {
+			sb.WriteString("<" + err.Error() + ">")
+		} else if value.IsNumber() {
+			sb.WriteString(value.Itoa())
+		} else {
+			sb.WriteString(value.String())
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,70 @@
+package vm_test
+
+import (
+	"testing"
+
+	"github.com/dbaumgarten/yodk/pkg/vm"
+)
+
+func TestConditionalBreakpoints(t *testing.T) {
+	prog := "i++ :s=\"x\"\nb=i\nc=i*2\nif i<10 then goto 1 end\n:done=1"
+	v, _ := vm.CreateFromSource(prog)
+	// 10 iterations of the loop and the last line
+	v.SetMaxExecutedLines(40)
+
+	hits := make([]int, 0)
+	v.SetBreakpointHandler(func(x *vm.VM) bool {
+		i, _ := x.GetVariable("i")
+		hits = append(hits, i.Number().Int())
+		return true
+	})
+	logs := make([]string, 0)
+	v.SetLogpointHandler(func(x *vm.VM, bp vm.Breakpoint, message string) {
+		logs = append(logs, message)
+	})
+
+	bp, err := vm.NewBreakpoint(2, "i > 5", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.SetBreakpoint(bp)
+
+	bp, err = vm.NewBreakpoint(3, "", "% 4", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.SetBreakpoint(bp)
+
+	bp, err = vm.NewBreakpoint(4, "i == 3", "", "i={i} double={i*2} s={:s}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.SetBreakpoint(bp)
+
+	v.Resume()
+	v.WaitForTermination()
+
+	expectedHits := []int{4, 6, 7, 8, 8, 9, 10}
+	if len(hits) != len(expectedHits) {
+		t.Fatalf("Expected breakpoint-hits %v, but got %v", expectedHits, hits)
+	}
+	for i := range hits {
+		if hits[i] != expectedHits[i] {
+			t.Fatalf("Expected breakpoint-hits %v, but got %v", expectedHits, hits)
+		}
+	}
+
+	if len(logs) != 1 || logs[0] != "i=3 double=6 s=x" {
+		t.Fatalf("Wrong log-messages: %v", logs)
+	}
+
+	if _, err := vm.NewBreakpoint(1, "a++ > 1", "", ""); err == nil {
+		t.Fatal("Conditions with side-effects must be rejected")
+	}
+	if _, err := vm.NewBreakpoint(1, "", "abc", ""); err == nil {
+		t.Fatal("Invalid hit-conditions must be rejected")
+	}
+	if _, err := vm.NewBreakpoint(1, "", "", "value {a"); err == nil {
+		t.Fatal("Unclosed expressions in log-messages must be rejected")
+	}
+}
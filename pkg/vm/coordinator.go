@@ -1,28 +1,72 @@
 package vm
 
 import (
+	"fmt"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 )
 
+// DefaultNetwork is the name of the network all VMs and devices are connected to, if not configured otherwise
+const DefaultNetwork = "default"
+
+// DefaultTickInterval is the duration of one ingame-tick. Ingame, every chip executes one line per tick
+const DefaultTickInterval = 200 * time.Millisecond
+
 // Coordinator is responsible for coordinating the execution of multiple VMs
 // It coordinates the line-by-line execution of the scripts and provides shared global variables
+// Global variables are organized in networks. Each network has it's own set of global variables.
 type Coordinator struct {
 	vms              []*VM
 	runLineChannels  []chan struct{}
 	lineDoneChannels []chan struct{}
-	globalVariables  map[string]*Variable
+	networks         map[string]map[string]*Variable
+	relays           []Relay
+	watchpoints      []Watchpoint
 	varLock          *sync.Mutex
+	devices          []*simulatedDevice
+	stubs            []*simulatedStub
+	// if > 0, every round of execution takes at least tickInterval/speed
+	tickInterval time.Duration
+	speed        float64
+	clockLock    *sync.Mutex
+	// number of completed rounds of execution. Protected by clockLock
+	rounds       int
+	roundHandler RoundHandlerFunc
+	// called for every write to a global variable. Protected by varLock
+	globalChangedHandler GlobalChangedHandlerFunc
+	// maximum number of round-snapshots to keep for reverse-debugging. Protected by varLock
+	historySize int
+	// snapshots of the shared state at the beginning of the previous rounds (oldest first). Protected by varLock
+	history []coordinatorSnapshot
 }
 
+// RoundHandlerFunc is a function that is called after every round of coordinated execution.
+// round is the number of completed rounds (including the current one)
+type RoundHandlerFunc func(c *Coordinator, round int)
+
+// GlobalChangedHandlerFunc is a function that is called every time a global variable is written on a network.
+// writer is the VM that performed the write. It is nil if the write was performed by something else (devices, stubs, test-steps, ...)
+// A write that is forwarded by relays results in one call per written network.
+// oldValue is nil if the variable did not exist on the network before the write.
+type GlobalChangedHandlerFunc func(c *Coordinator, writer *VM, network string, name string, oldValue *Variable, newValue *Variable)
+
 // NewCoordinator returns a new coordinator
 func NewCoordinator() *Coordinator {
 	return &Coordinator{
 		vms:              make([]*VM, 0),
 		runLineChannels:  make([]chan struct{}, 0),
 		lineDoneChannels: make([]chan struct{}, 0),
-		globalVariables:  make(map[string]*Variable),
-		varLock:          &sync.Mutex{},
+		networks: map[string]map[string]*Variable{
+			DefaultNetwork: make(map[string]*Variable),
+		},
+		relays:    make([]Relay, 0),
+		varLock:   &sync.Mutex{},
+		devices:   make([]*simulatedDevice, 0),
+		stubs:     make([]*simulatedStub, 0),
+		speed:     1,
+		clockLock: &sync.Mutex{},
 	}
 }
 
@@ -38,6 +82,14 @@ func (c *Coordinator) Terminate() {
 	for _, v := range c.vms {
 		v.Terminate()
 	}
+	c.stopStubs()
+}
+
+// stopStubs terminates the evaluators of all stubs
+func (c *Coordinator) stopStubs() {
+	for _, s := range c.stubs {
+		s.stop()
+	}
 }
 
 // Pause all coordinated vms
@@ -61,40 +113,332 @@ func (c *Coordinator) WaitForTermination() {
 	}
 }
 
-// GetVariable gets the current state of a global variable
+// GetVariable gets the current state of a global variable on the default network
 // getting variables is case-insensitive
 func (c *Coordinator) GetVariable(name string) (*Variable, bool) {
+	return c.GetNetworkVariable(DefaultNetwork, name)
+}
+
+// GetVariables gets the current state of all global variables on the default network
+// All returned variables have normalized (lowercased) names
+func (c *Coordinator) GetVariables() map[string]Variable {
+	return c.GetNetworkVariables(DefaultNetwork)
+}
+
+// SetVariable sets the current state of a global variable on the default network
+// setting variables is case-insensitive
+func (c *Coordinator) SetVariable(name string, value *Variable) error {
+	return c.SetNetworkVariable(DefaultNetwork, name, value)
+}
+
+// GetNetworkVariable gets the current state of a global variable on the given network
+// getting variables is case-insensitive
+func (c *Coordinator) GetNetworkVariable(network string, name string) (*Variable, bool) {
+	return c.getVariableFromNetworks([]string{network}, name)
+}
+
+// GetNetworkVariables gets the current state of all global variables on the given network
+// All returned variables have normalized (lowercased) names
+func (c *Coordinator) GetNetworkVariables(network string) map[string]Variable {
+	return c.getVariablesFromNetworks([]string{network})
+}
+
+// SetNetworkVariable sets the current state of a global variable on the given network
+// The value is forwarded to other networks by all matching relays
+// setting variables is case-insensitive
+func (c *Coordinator) SetNetworkVariable(network string, name string, value *Variable) error {
+	return c.setVariableOnNetworks(nil, []string{network}, name, value)
+}
+
+// GetNetworks returns the sorted names of all known networks
+func (c *Coordinator) GetNetworks() []string {
+	c.varLock.Lock()
+	defer c.varLock.Unlock()
+	names := make([]string, 0, len(c.networks))
+	for name := range c.networks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// AddRelay adds a relay that forwards fields between networks
+// Networks that do not exist yet are created
+func (c *Coordinator) AddRelay(r Relay) error {
+	if r.From == "" || r.To == "" {
+		return fmt.Errorf("Relay '%s': Relays need a from- and a to-network", r.Name)
+	}
+	if r.From == r.To {
+		return fmt.Errorf("Relay '%s': Can not relay network '%s' to itself", r.Name, r.From)
+	}
+	if len(r.Fields) == 0 {
+		return fmt.Errorf("Relay '%s': Relays need at least one field to forward", r.Name)
+	}
+	c.varLock.Lock()
+	defer c.varLock.Unlock()
+	c.network(r.From)
+	c.network(r.To)
+	c.relays = append(c.relays, r)
+	return nil
+}
+
+// GetRelays returns all relays of the coordinator
+func (c *Coordinator) GetRelays() []Relay {
+	c.varLock.Lock()
+	defer c.varLock.Unlock()
+	relays := make([]Relay, len(c.relays))
+	copy(relays, c.relays)
+	return relays
+}
+
+// AddWatchpoint adds a watchpoint for a global variable. The watchpoint is triggered by all coordinated VMs
+// The watchpoint-handler of the VM that accessed the variable is called
+func (c *Coordinator) AddWatchpoint(wp Watchpoint) error {
+	if !wp.IsGlobal() {
+		return fmt.Errorf("The coordinator can only watch global variables, but '%s' is local", wp.Variable)
+	}
+	c.varLock.Lock()
+	defer c.varLock.Unlock()
+	c.watchpoints = append(c.watchpoints, wp)
+	return nil
+}
+
+// RemoveWatchpoints removes all watchpoints for the given global variable
+func (c *Coordinator) RemoveWatchpoints(variable string) {
+	c.varLock.Lock()
+	defer c.varLock.Unlock()
+	c.watchpoints = removeWatchpoints(c.watchpoints, variable)
+}
+
+// ClearWatchpoints removes all watchpoints of the coordinator
+func (c *Coordinator) ClearWatchpoints() {
+	c.varLock.Lock()
+	defer c.varLock.Unlock()
+	c.watchpoints = nil
+}
+
+// ListWatchpoints returns the list of watchpoints of the coordinator
+func (c *Coordinator) ListWatchpoints() []Watchpoint {
+	c.varLock.Lock()
+	defer c.varLock.Unlock()
+	li := make([]Watchpoint, len(c.watchpoints))
+	copy(li, c.watchpoints)
+	return li
+}
+
+// watchpointsFor returns the watchpoints for the given (normalized) variable-name
+func (c *Coordinator) watchpointsFor(name string) []Watchpoint {
+	c.varLock.Lock()
+	defer c.varLock.Unlock()
+	var found []Watchpoint
+	for _, wp := range c.watchpoints {
+		if wp.Variable == name {
+			found = append(found, wp)
+		}
+	}
+	return found
+}
+
+// network returns the variables of the given network. Creates the network if it does not exist
+// Does not use the lock. ONLY USE WHEN LOCK IS ALREADY HELD
+func (c *Coordinator) network(name string) map[string]*Variable {
+	net, exists := c.networks[name]
+	if !exists {
+		net = make(map[string]*Variable)
+		c.networks[name] = net
+	}
+	return net
+}
+
+// getVariableFromNetworks returns the value of the variable from the first of the given networks that contains it
+// If networks is empty, the default network is used
+func (c *Coordinator) getVariableFromNetworks(networks []string, name string) (*Variable, bool) {
+	if len(networks) == 0 {
+		networks = []string{DefaultNetwork}
+	}
 	name = strings.ToLower(name)
 	c.varLock.Lock()
 	defer c.varLock.Unlock()
-	val, exists := c.globalVariables[name]
-	return val, exists
+	for _, network := range networks {
+		if val, exists := c.networks[network][name]; exists {
+			return val, true
+		}
+	}
+	return nil, false
 }
 
-// GetVariables gets the current state of all global variables
-// All returned variables have normalized (lowercased) names
-func (c *Coordinator) GetVariables() map[string]Variable {
+// getVariablesFromNetworks returns all variables from the given networks
+// If a variable exists on multiple networks, the value from the first of the networks is used
+// If networks is empty, the default network is used
+func (c *Coordinator) getVariablesFromNetworks(networks []string) map[string]Variable {
+	if len(networks) == 0 {
+		networks = []string{DefaultNetwork}
+	}
 	c.varLock.Lock()
 	defer c.varLock.Unlock()
 	varlist := make(map[string]Variable)
-	for key, value := range c.globalVariables {
-		varlist[key] = Variable{
-			Value: value.Value,
+	for i := len(networks) - 1; i >= 0; i-- {
+		for key, value := range c.networks[networks[i]] {
+			varlist[key] = Variable{
+				Value: value.Value,
+			}
 		}
 	}
 	return varlist
 }
 
-// SetVariable sets the current state of a global variable
-// setting variables is case-insensitive
-func (c *Coordinator) SetVariable(name string, value *Variable) error {
+// setVariableOnNetworks sets the variable on all of the given networks and forwards it using the relays
+// writer is the VM that performs the write (or nil, if the write is not performed by a VM)
+// If networks is empty, the default network is used
+func (c *Coordinator) setVariableOnNetworks(writer *VM, networks []string, name string, value *Variable) error {
+	if len(networks) == 0 {
+		networks = []string{DefaultNetwork}
+	}
 	name = strings.ToLower(name)
 	c.varLock.Lock()
 	defer c.varLock.Unlock()
-	c.globalVariables[name] = value
+
+	visited := make(map[string]bool)
+	pending := make([]string, len(networks))
+	copy(pending, networks)
+	for len(pending) > 0 {
+		network := pending[0]
+		pending = pending[1:]
+		if visited[network] {
+			continue
+		}
+		visited[network] = true
+		newValue := &Variable{Value: value.Value}
+		if c.globalChangedHandler != nil {
+			c.globalChangedHandler(c, writer, network, name, c.network(network)[name], newValue)
+		}
+		c.network(network)[name] = newValue
+		for _, r := range c.relays {
+			if target, forwards := r.forwards(network, name); forwards {
+				pending = append(pending, target)
+			}
+		}
+	}
+	return nil
+}
+
+// SetTickInterval enables the clocked mode. In clocked mode every VM executes exactly one line per tick,
+// which reproduces the ingame-timing of the scripts. 0 disables the clocked mode (default)
+// Can also be called while the coordinator is running
+func (c *Coordinator) SetTickInterval(interval time.Duration) {
+	c.clockLock.Lock()
+	defer c.clockLock.Unlock()
+	c.tickInterval = interval
+}
+
+// GetTickInterval returns the current tick-interval. 0 means the clocked mode is disabled
+func (c *Coordinator) GetTickInterval() time.Duration {
+	c.clockLock.Lock()
+	defer c.clockLock.Unlock()
+	return c.tickInterval
+}
+
+// SetSpeed sets a multiplier for the speed of the clocked mode. A speed of 2 executes two ticks per tick-interval
+// Can also be called while the coordinator is running
+func (c *Coordinator) SetSpeed(multiplier float64) error {
+	if multiplier <= 0 {
+		return fmt.Errorf("The speed-multiplier must be larger than 0, but is %f", multiplier)
+	}
+	c.clockLock.Lock()
+	defer c.clockLock.Unlock()
+	c.speed = multiplier
+	return nil
+}
+
+// GetSpeed returns the current speed-multiplier for the clocked mode
+func (c *Coordinator) GetSpeed() float64 {
+	c.clockLock.Lock()
+	defer c.clockLock.Unlock()
+	return c.speed
+}
+
+// GetRounds returns the number of completed rounds of execution (every VM executed one line)
+func (c *Coordinator) GetRounds() int {
+	c.clockLock.Lock()
+	defer c.clockLock.Unlock()
+	return c.rounds
+}
+
+// SetGlobalChangedHandler sets a function that is called every time a global variable is written on any network
+// The handler is called while the variables of the coordinator are locked and therefore MUST NOT access them
+func (c *Coordinator) SetGlobalChangedHandler(handler GlobalChangedHandlerFunc) {
+	c.varLock.Lock()
+	defer c.varLock.Unlock()
+	c.globalChangedHandler = handler
+}
+
+// GetGlobalChangedHandler returns the function set by SetGlobalChangedHandler
+func (c *Coordinator) GetGlobalChangedHandler() GlobalChangedHandlerFunc {
+	c.varLock.Lock()
+	defer c.varLock.Unlock()
+	return c.globalChangedHandler
+}
+
+// SetRoundHandler sets a function that is called after every round of execution (after the devices have been updated)
+func (c *Coordinator) SetRoundHandler(handler RoundHandlerFunc) {
+	c.clockLock.Lock()
+	defer c.clockLock.Unlock()
+	c.roundHandler = handler
+}
+
+// tickDuration returns the minimal duration of a round of execution. 0 if running unclocked
+func (c *Coordinator) tickDuration() time.Duration {
+	c.clockLock.Lock()
+	defer c.clockLock.Unlock()
+	return time.Duration(float64(c.tickInterval) / c.speed)
+}
+
+// AddDevice adds a simulated device to the coordinator.
+// The fields of the device are initialized to their default values immediately and the behaviours of the device
+// are applied after every round of coordinated execution (every VM executed one line).
+// Once run has been called, no new devices MUST be added!!!
+func (c *Coordinator) AddDevice(d Device) error {
+	sd, err := newSimulatedDevice(d)
+	if err != nil {
+		return err
+	}
+	sd.initialize(c)
+	c.devices = append(c.devices, sd)
+	return nil
+}
+
+// GetDevices returns the descriptions of all simulated devices
+// The current values of the device-fields can be retrieved using GetVariable()
+func (c *Coordinator) GetDevices() []Device {
+	devices := make([]Device, len(c.devices))
+	for i, d := range c.devices {
+		devices[i] = d.Device
+	}
+	return devices
+}
+
+// AddStub adds a stub (a chip simulated by simple rules) to the coordinator.
+// Every round of coordinated execution, the stub executes one line after all VMs did. Devices are updated afterwards.
+// Once run has been called, no new stubs MUST be added!!!
+func (c *Coordinator) AddStub(s Stub) error {
+	ss, err := newSimulatedStub(s)
+	if err != nil {
+		return err
+	}
+	ss.initialize(c)
+	c.stubs = append(c.stubs, ss)
 	return nil
 }
 
+// GetStubs returns the descriptions of all stubs
+func (c *Coordinator) GetStubs() []Stub {
+	stubs := make([]Stub, len(c.stubs))
+	for i, s := range c.stubs {
+		stubs[i] = s.Stub
+	}
+	return stubs
+}
+
 // registerVM registers a VM with the coordinator
 // is called by the vm in SetCoordinator.
 // returns two channels. The first is used to signal to the VM that it may run a line
@@ -119,7 +463,9 @@ func (c *Coordinator) remove(idx int) {
 }
 
 func (c *Coordinator) run() {
+	nextTick := time.Now()
 	for {
+		c.takeSnapshot()
 		for i := 0; i < len(c.runLineChannels); i++ {
 			runch := c.runLineChannels[i]
 			donech := c.lineDoneChannels[i]
@@ -138,8 +484,33 @@ func (c *Coordinator) run() {
 				c.remove(i)
 			}
 		}
+		for _, s := range c.stubs {
+			s.update(c)
+		}
+		for _, d := range c.devices {
+			d.update(c)
+		}
+		c.clockLock.Lock()
+		c.rounds++
+		round := c.rounds
+		handler := c.roundHandler
+		c.clockLock.Unlock()
+		if handler != nil {
+			handler(c, round)
+		}
 		if len(c.vms) == 0 {
+			c.stopStubs()
 			return
 		}
+		if tick := c.tickDuration(); tick > 0 {
+			nextTick = nextTick.Add(tick)
+			now := time.Now()
+			if nextTick.After(now) {
+				time.Sleep(nextTick.Sub(now))
+			} else {
+				// we are behind schedule (e.g. because the VMs have been paused). Do not try to catch up
+				nextTick = now
+			}
+		}
 	}
 }
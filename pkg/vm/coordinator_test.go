@@ -2,6 +2,7 @@ package vm_test
 
 import (
 	"testing"
+	"time"
 
 	"github.com/dbaumgarten/yodk/pkg/vm"
 )
@@ -50,3 +51,89 @@ func TestCoordinatedExecution(t *testing.T) {
 		t.Fatalf("Wrong result for computation, wanted %s but got %s", "abcdefgh", result1)
 	}
 }
+
+func TestNetworks(t *testing.T) {
+	prog1 := `:a = 1 :secret = 5`
+	prog2 := `:b = :a + 1`
+	coord := vm.NewCoordinator()
+	err := coord.AddRelay(vm.Relay{
+		From:   "left",
+		To:     "right",
+		Fields: []string{"a"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vm1, _ := vm.CreateFromSource(prog1)
+	vm2, _ := vm.CreateFromSource(prog2)
+
+	vm1.SetCoordinator(coord)
+	vm2.SetCoordinator(coord)
+
+	vm1.SetNetworks("left")
+	vm2.SetNetworks("right")
+
+	vm1.SetMaxExecutedLines(1)
+	vm2.SetMaxExecutedLines(1)
+
+	vm1.Resume()
+	vm2.Resume()
+
+	coord.Run()
+	coord.WaitForTermination()
+
+	b, exists := coord.GetNetworkVariable("right", ":b")
+	if !exists || b.Itoa() != "2" {
+		t.Fatal("The relay did not forward :a to the right network")
+	}
+
+	if _, exists := coord.GetNetworkVariable("right", ":secret"); exists {
+		t.Fatal("The relay forwarded a field it should not forward")
+	}
+
+	if _, exists := coord.GetNetworkVariable("left", ":b"); exists {
+		t.Fatal("The relay is not bidirectional, but forwarded :b to the left network")
+	}
+
+	if len(coord.GetVariables()) != 0 {
+		t.Fatal("The default network should not contain any variables")
+	}
+
+	err = coord.AddRelay(vm.Relay{
+		From:   "left",
+		To:     "left",
+		Fields: []string{"a"},
+	})
+	if err == nil {
+		t.Fatal("Relays from a network to itself should be rejected")
+	}
+}
+
+func TestClockedExecution(t *testing.T) {
+	coord := vm.NewCoordinator()
+	coord.SetTickInterval(20 * time.Millisecond)
+	err := coord.SetSpeed(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, _ := vm.CreateFromSource(`:a++ goto 1`)
+	v.SetCoordinator(coord)
+	v.SetMaxExecutedLines(5)
+	v.Resume()
+
+	start := time.Now()
+	coord.Run()
+	coord.WaitForTermination()
+	elapsed := time.Since(start)
+
+	// 5 ticks of 10ms. The last tick does not need to be waited for
+	if elapsed < 40*time.Millisecond {
+		t.Fatalf("Clocked execution was too fast. Took only %s", elapsed)
+	}
+
+	if coord.SetSpeed(0) == nil {
+		t.Fatal("A speed of 0 should be rejected")
+	}
+}
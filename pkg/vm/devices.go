@@ -0,0 +1,183 @@
+package vm
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dbaumgarten/yodk/pkg/number"
+)
+
+// The different types of device-behaviours
+const (
+	// BehaviourReset resets a field to its default value after it has been changed for a number of ticks (e.g. a button)
+	BehaviourReset = "reset"
+	// BehaviourRate adds a fixed amount to a numeric field every tick (e.g. a draining fuel-tank)
+	BehaviourRate = "rate"
+	// BehaviourMirror copies the value of another field every tick (e.g. a lamp showing the state of a button)
+	BehaviourMirror = "mirror"
+)
+
+// DeviceBehaviour describes how a field of a simulated device changes over time
+type DeviceBehaviour struct {
+	// The type of the behaviour. One of the Behaviour* constants
+	Type string
+	// The field that is modified by this behaviour
+	Field string
+	// Number of ticks a field must differ from its default before it is reset (reset). Defaults to 1
+	After int
+	// Amount that is added to the field every tick (rate)
+	Rate float64
+	// Optional lower and upper bounds for the field (rate)
+	Min *float64
+	Max *float64
+	// The field whose value is copied (mirror)
+	Source string
+}
+
+// Device describes a simulated ingame-device (button, display, tank, ...).
+// The fields of a device are exposed as global variables to all coordinated VMs.
+type Device struct {
+	// Name of the device. Only used for display-purposes
+	Name string
+	// The network the device is connected to. Defaults to DefaultNetwork
+	Network string
+	// The fields of the device and their default values
+	Fields map[string]interface{}
+	// Behaviours that update the fields of the device every coordinator-round
+	Behaviours []DeviceBehaviour
+}
+
+// simulatedDevice is the runtime-state of a device registered with a coordinator
+type simulatedDevice struct {
+	Device
+	defaults map[string]*Variable
+	// number of consecutive ticks a reset-behaviour has seen a non-default value. Indexed like Device.Behaviours
+	changedTicks []int
+}
+
+// network returns the name of the network the device is connected to
+func (d *simulatedDevice) network() string {
+	if d.Network == "" {
+		return DefaultNetwork
+	}
+	return d.Network
+}
+
+// fieldVarname returns the name of the global variable that represents the given device-field
+func fieldVarname(field string) string {
+	field = strings.ToLower(field)
+	if !strings.HasPrefix(field, ":") {
+		return ":" + field
+	}
+	return field
+}
+
+// newSimulatedDevice validates the given device-description and prepares it for simulation
+func newSimulatedDevice(d Device) (*simulatedDevice, error) {
+	sd := &simulatedDevice{
+		Device:       d,
+		defaults:     make(map[string]*Variable, len(d.Fields)),
+		changedTicks: make([]int, len(d.Behaviours)),
+	}
+
+	for field, value := range d.Fields {
+		variable, err := VariableFromType(value)
+		if err != nil {
+			return nil, fmt.Errorf("Device '%s': Invalid default value for field '%s': %s", d.Name, field, err.Error())
+		}
+		sd.defaults[fieldVarname(field)] = variable
+	}
+
+	for _, b := range d.Behaviours {
+		if b.Field == "" {
+			return nil, fmt.Errorf("Device '%s': Behaviour of type '%s' has no field", d.Name, b.Type)
+		}
+		switch b.Type {
+		case BehaviourReset:
+			if _, exists := sd.defaults[fieldVarname(b.Field)]; !exists {
+				return nil, fmt.Errorf("Device '%s': Can not reset field '%s', as it has no default value", d.Name, b.Field)
+			}
+		case BehaviourRate:
+			if b.Min != nil && b.Max != nil && *b.Min > *b.Max {
+				return nil, fmt.Errorf("Device '%s': Min for field '%s' is larger than max", d.Name, b.Field)
+			}
+		case BehaviourMirror:
+			if b.Source == "" {
+				return nil, fmt.Errorf("Device '%s': Mirror-behaviour for field '%s' needs a source", d.Name, b.Field)
+			}
+		default:
+			return nil, fmt.Errorf("Device '%s': Unknown behaviour-type '%s'. Possible options are %s, %s or %s", d.Name, b.Type, BehaviourReset, BehaviourRate, BehaviourMirror)
+		}
+	}
+
+	return sd, nil
+}
+
+// initialize sets all fields of the device to their default values
+func (d *simulatedDevice) initialize(c *Coordinator) {
+	for name, value := range d.defaults {
+		c.SetNetworkVariable(d.network(), name, &Variable{Value: value.Value})
+	}
+}
+
+// state returns a copy of the runtime-state of the device
+func (d *simulatedDevice) state() []int {
+	changedTicks := make([]int, len(d.changedTicks))
+	copy(changedTicks, d.changedTicks)
+	return changedTicks
+}
+
+// restore restores a runtime-state returned by state()
+func (d *simulatedDevice) restore(changedTicks []int) {
+	d.changedTicks = make([]int, len(changedTicks))
+	copy(d.changedTicks, changedTicks)
+}
+
+// update performs one tick of the simulation
+func (d *simulatedDevice) update(c *Coordinator) {
+	for i, b := range d.Behaviours {
+		name := fieldVarname(b.Field)
+		current, exists := c.GetNetworkVariable(d.network(), name)
+		if !exists {
+			current = &Variable{Value: number.Zero}
+		}
+
+		switch b.Type {
+		case BehaviourReset:
+			def := d.defaults[name]
+			if current.Equals(def) {
+				d.changedTicks[i] = 0
+				continue
+			}
+			d.changedTicks[i]++
+			after := b.After
+			if after < 1 {
+				after = 1
+			}
+			if d.changedTicks[i] >= after {
+				d.changedTicks[i] = 0
+				c.SetNetworkVariable(d.network(), name, &Variable{Value: def.Value})
+			}
+
+		case BehaviourRate:
+			if !current.IsNumber() {
+				continue
+			}
+			newval := current.Number().Add(number.FromFloat64(b.Rate))
+			if b.Min != nil && newval < number.FromFloat64(*b.Min) {
+				newval = number.FromFloat64(*b.Min)
+			}
+			if b.Max != nil && newval > number.FromFloat64(*b.Max) {
+				newval = number.FromFloat64(*b.Max)
+			}
+			c.SetNetworkVariable(d.network(), name, &Variable{Value: newval})
+
+		case BehaviourMirror:
+			source, exists := c.GetNetworkVariable(d.network(), fieldVarname(b.Source))
+			if !exists {
+				continue
+			}
+			c.SetNetworkVariable(d.network(), name, &Variable{Value: source.Value})
+		}
+	}
+}
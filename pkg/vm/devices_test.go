@@ -0,0 +1,91 @@
+package vm_test
+
+import (
+	"testing"
+
+	"github.com/dbaumgarten/yodk/pkg/number"
+	"github.com/dbaumgarten/yodk/pkg/vm"
+)
+
+func TestDevices(t *testing.T) {
+	prog := `if :buttonstate == 1 then :seen++ end goto 1`
+	min := 0.0
+	coord := vm.NewCoordinator()
+	err := coord.AddDevice(vm.Device{
+		Name: "button",
+		Fields: map[string]interface{}{
+			"ButtonState": 0,
+		},
+		Behaviours: []vm.DeviceBehaviour{
+			{
+				Type:  vm.BehaviourReset,
+				Field: "ButtonState",
+				After: 3,
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = coord.AddDevice(vm.Device{
+		Name: "tank",
+		Fields: map[string]interface{}{
+			"FuelLevel": 5,
+		},
+		Behaviours: []vm.DeviceBehaviour{
+			{
+				Type:  vm.BehaviourRate,
+				Field: "FuelLevel",
+				Rate:  -1,
+				Min:   &min,
+			},
+			{
+				Type:   vm.BehaviourMirror,
+				Field:  "Display",
+				Source: "FuelLevel",
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// press the button once
+	coord.SetVariable(":ButtonState", &vm.Variable{Value: number.One})
+
+	v, _ := vm.CreateFromSource(prog)
+	v.SetCoordinator(coord)
+	v.SetMaxExecutedLines(40)
+	v.Resume()
+
+	coord.Run()
+	coord.WaitForTermination()
+
+	seen, _ := coord.GetVariable(":seen")
+	if seen.Itoa() != "3" {
+		t.Fatalf("The button should have been pressed for 3 ticks, but was pressed for %s", seen.Itoa())
+	}
+
+	fuel, _ := coord.GetVariable(":fuellevel")
+	if fuel.Itoa() != "0" {
+		t.Fatalf("Fuel-level should have been clamped to 0, but is %s", fuel.Itoa())
+	}
+
+	display, _ := coord.GetVariable(":display")
+	if !display.Equals(fuel) {
+		t.Fatalf("Display should mirror the fuel-level, but is %s", display.Itoa())
+	}
+
+	err = coord.AddDevice(vm.Device{
+		Name: "broken",
+		Behaviours: []vm.DeviceBehaviour{
+			{
+				Type:  "explode",
+				Field: "foo",
+			},
+		},
+	})
+	if err == nil {
+		t.Fatal("Unknown behaviour-types should be rejected")
+	}
+}
@@ -0,0 +1,62 @@
+package vm
+
+import (
+	"fmt"
+
+	"github.com/dbaumgarten/yodk/pkg/parser/ast"
+)
+
+// Evaluate computes the value of the given expression in the context of the vm.
+// The expression can modify variables (e.g. a++), but does not affect the position of the execution.
+// Does not trigger watchpoints
+func (v *VM) Evaluate(expr ast.Expression) (*Variable, error) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return v.evaluate(expr)
+}
+
+// Execute runs the given statements in the context of the vm, without affecting the position of the execution.
+// Gotos are not allowed. Does not trigger watchpoints, breakpoints or steps
+func (v *VM) Execute(stmts []ast.Statement) error {
+	for _, stmt := range stmts {
+		err := stmt.Accept(ast.VisitorFunc(func(node ast.Node, visitType int) error {
+			if _, is := node.(*ast.GoToStatement); is {
+				return fmt.Errorf("Gotos can not be executed while debugging")
+			}
+			return nil
+		}))
+		if err != nil {
+			return err
+		}
+	}
+
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.evaluating = true
+	// running statements modifies the current position. Restore it afterwards
+	coloumn := v.currentSourceColoumn
+	atLineStart := v.atLineStart
+	defer func() {
+		v.evaluating = false
+		v.currentSourceColoumn = coloumn
+		v.atLineStart = atLineStart
+	}()
+
+	for _, stmt := range stmts {
+		err := v.runStmt(stmt)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// evaluate computes the value of an expression in the context of the vm, without triggering watchpoints
+// Does not use the lock. ONLY USE WHEN LOCK IS ALREADY HELD
+func (v *VM) evaluate(expr ast.Expression) (*Variable, error) {
+	v.evaluating = true
+	defer func() {
+		v.evaluating = false
+	}()
+	return v.runExpr(expr)
+}
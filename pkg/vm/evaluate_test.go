@@ -0,0 +1,59 @@
+package vm_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dbaumgarten/yodk/pkg/parser"
+	"github.com/dbaumgarten/yodk/pkg/vm"
+)
+
+func TestEvaluate(t *testing.T) {
+	prog := "a=2 :b=\"x\"\na=3"
+	v, _ := vm.CreateFromSource(prog)
+
+	paused := make(chan bool, 1)
+	v.SetBreakpointHandler(func(x *vm.VM) bool {
+		paused <- true
+		return false
+	})
+	v.AddBreakpoint(2)
+	v.Resume()
+	<-paused
+	for v.State() != vm.StatePaused {
+		time.Sleep(time.Millisecond)
+	}
+
+	expr, err := parser.NewParser().ParseExpressionString("a*10+:b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := v.Evaluate(expr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Repr() != "\"20x\"" {
+		t.Fatalf("Wrong result of expression: %s", result.Repr())
+	}
+
+	code, _ := parser.NewParser().Parse("a=5 if a>4 then c=1 end")
+	err = v.Execute(code.Lines[0].Statements)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, _ := v.GetVariable("c")
+	if c == nil || c.Itoa() != "1" {
+		t.Fatal("The statements have not been executed")
+	}
+	if v.CurrentSourceLine() != 2 {
+		t.Fatalf("Executing statements must not change the current line, but line is %d", v.CurrentSourceLine())
+	}
+
+	code, _ = parser.NewParser().Parse("goto 1")
+	err = v.Execute(code.Lines[0].Statements)
+	if err == nil {
+		t.Fatal("Gotos must not be executed")
+	}
+
+	v.Terminate()
+}
@@ -0,0 +1,248 @@
+package vm
+
+import (
+	"fmt"
+
+	"github.com/dbaumgarten/yodk/pkg/parser/ast"
+)
+
+// errRestore is used to abort the current line when a snapshot is to be restored (or the execution jumps to another line)
+var errRestore = fmt.Errorf("Restore snapshot")
+
+// snapshot is the state of a vm at the beginning of an executed line
+type snapshot struct {
+	astLine       int
+	executedLines int
+	variables     map[string]*Variable
+	// the round of the coordinator (if any) the line has been executed in
+	round int
+}
+
+// coordinatorSnapshot is the state shared by the coordinated vms at the beginning of a round of execution
+type coordinatorSnapshot struct {
+	round    int
+	networks map[string]map[string]*Variable
+	// the state of the devices and stubs. Indexed like Coordinator.devices and Coordinator.stubs
+	devices [][]int
+	stubs   []stubState
+}
+
+// SetHistorySize sets the number of snapshots the vm keeps for reverse-debugging
+// A snapshot of the vm is taken at the beginning of every executed line. If the vm is attached to a coordinator,
+// the coordinator keeps (at least) the same number of snapshots of the rounds of execution.
+// <= 0 disables the history. Default is 0
+func (v *VM) SetHistorySize(size int) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.historySize = size
+	if v.coordinator != nil {
+		v.coordinator.growHistory(size)
+	}
+	if size <= 0 {
+		v.history = nil
+	} else if len(v.history) > size {
+		v.history = v.history[len(v.history)-size:]
+	}
+}
+
+// StepBack restores the state of the vm at the beginning of the previously executed line and pauses there.
+// The VM must be paused. If the vm is attached to a coordinator, the coordinator is rewound too (see Coordinator.restoreRound).
+func (v *VM) StepBack() error {
+	v.lock.Lock()
+	target := v.previousSnapshot()
+	v.lock.Unlock()
+	return v.requestRestore(target)
+}
+
+// ReverseContinue goes back in the history until a line with a breakpoint (or the oldest snapshot) is reached and pauses there.
+// The VM must be paused. If the vm is attached to a coordinator, the coordinator is rewound too (see Coordinator.restoreRound).
+func (v *VM) ReverseContinue() error {
+	v.lock.Lock()
+	target := v.previousSnapshot()
+	for target > 0 && !v.lineHasBreakpoint(v.history[target].astLine) {
+		target--
+	}
+	v.lock.Unlock()
+	return v.requestRestore(target)
+}
+
+// RestartLine restores the state of the vm at the beginning of the current line and pauses there.
+// The VM must be paused. If the vm is attached to a coordinator, the coordinator is rewound too (see Coordinator.restoreRound).
+func (v *VM) RestartLine() error {
+	v.lock.Lock()
+	target := len(v.history) - 1
+	v.lock.Unlock()
+	return v.requestRestore(target)
+}
+
+// previousSnapshot returns the index of the snapshot of the previous line
+// if the execution of the current line has not started yet, the current line does not count as previous line
+// Does not use the lock. ONLY USE WHEN LOCK IS ALREADY HELD
+func (v *VM) previousSnapshot() int {
+	if v.atLineStart {
+		return len(v.history) - 2
+	}
+	return len(v.history) - 1
+}
+
+// requestRestore makes the VM restore the snapshot with the given index and then pause
+func (v *VM) requestRestore(idx int) error {
+	v.lock.Lock()
+	if v.state != StatePaused {
+		v.lock.Unlock()
+		return fmt.Errorf("The vm must be paused to go back in time")
+	}
+	if idx < 0 || idx >= len(v.history) {
+		v.lock.Unlock()
+		return fmt.Errorf("There is no recorded history to go back to")
+	}
+	v.restoreIndex = idx
+	v.lock.Unlock()
+	// step, so the vm pauses right after restoring
+	v.Step()
+	return nil
+}
+
+// takeSnapshot adds the current state to the history
+// Does not use the lock. ONLY USE WHEN LOCK IS ALREADY HELD
+func (v *VM) takeSnapshot() {
+	v.atLineStart = true
+	if v.historySize <= 0 {
+		return
+	}
+	snap := snapshot{
+		astLine:       v.currentAstLine,
+		executedLines: v.executedLines,
+		variables:     make(map[string]*Variable, len(v.variables)),
+	}
+	for name, value := range v.variables {
+		snap.variables[name] = value
+	}
+	if v.coordinator != nil {
+		snap.round = v.coordinator.GetRounds()
+	}
+	if len(v.history) >= v.historySize {
+		v.history = v.history[1:]
+	}
+	v.history = append(v.history, snap)
+}
+
+// restoreSnapshot restores the requested snapshot and returns the line that is to be executed next
+// The restored snapshot and all newer ones are removed from the history. (The restored one is re-added when the line starts executing)
+// Does not use the lock. ONLY USE WHEN LOCK IS ALREADY HELD
+func (v *VM) restoreSnapshot() *ast.Line {
+	snap := v.history[v.restoreIndex]
+	v.history = v.history[:v.restoreIndex]
+	v.restoreIndex = -1
+
+	v.variables = make(map[string]*Variable, len(snap.variables))
+	for name, value := range snap.variables {
+		v.variables[name] = value
+	}
+	if v.coordinator != nil {
+		v.coordinator.restoreRound(snap.round)
+	}
+	v.executedLines = snap.executedLines
+	v.currentAstLine = snap.astLine
+	// make sure the restored line triggers a line-change (and therefore a pause)
+	v.jumped = true
+	return v.program.Lines[v.currentAstLine-1]
+}
+
+// lineHasBreakpoint checks if there is a breakpoint on any of the source-lines of the given ast-line
+// Does not use the lock. ONLY USE WHEN LOCK IS ALREADY HELD
+func (v *VM) lineHasBreakpoint(astLine int) bool {
+	line := v.program.Lines[astLine-1]
+	if len(line.Statements) == 0 {
+		_, exists := v.breakpoints[line.Start().Line]
+		return exists
+	}
+	for _, stmt := range line.Statements {
+		if _, exists := v.breakpoints[stmt.Start().Line]; exists && stmt.Start().File == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// growHistory makes sure the coordinator keeps at least the given number of round-snapshots
+// Is called by the vms when their history-size is set, so the history of the coordinator reaches as far back as theirs
+func (c *Coordinator) growHistory(size int) {
+	c.varLock.Lock()
+	defer c.varLock.Unlock()
+	if size > c.historySize {
+		c.historySize = size
+	}
+}
+
+// takeSnapshot adds the state at the beginning of the current round to the history
+// This includes the global variables of all networks and the state of all devices and stubs
+func (c *Coordinator) takeSnapshot() {
+	round := c.GetRounds()
+	c.varLock.Lock()
+	defer c.varLock.Unlock()
+	if c.historySize <= 0 {
+		return
+	}
+	snap := coordinatorSnapshot{
+		round:    round,
+		networks: copyNetworks(c.networks),
+		devices:  make([][]int, len(c.devices)),
+		stubs:    make([]stubState, len(c.stubs)),
+	}
+	for i, d := range c.devices {
+		snap.devices[i] = d.state()
+	}
+	for i, s := range c.stubs {
+		snap.stubs[i] = s.state()
+	}
+	if len(c.history) >= c.historySize {
+		c.history = c.history[1:]
+	}
+	c.history = append(c.history, snap)
+}
+
+// restoreRound restores the state at the beginning of the given round (global variables, devices and stubs)
+// and removes all newer snapshots from the history. Returns false if there is no snapshot for the round.
+// The other coordinated vms are not rewound. MUST only be called by a vm that currently holds the permission to run a line,
+// as the coordinator does not update devices or stubs while waiting for the vm.
+func (c *Coordinator) restoreRound(round int) bool {
+	c.varLock.Lock()
+	idx := -1
+	for i, snap := range c.history {
+		if snap.round == round {
+			idx = i
+		}
+	}
+	if idx < 0 {
+		c.varLock.Unlock()
+		return false
+	}
+	snap := c.history[idx]
+	c.history = c.history[:idx+1]
+	c.networks = copyNetworks(snap.networks)
+	for i, d := range c.devices {
+		d.restore(snap.devices[i])
+	}
+	for i, s := range c.stubs {
+		s.restore(snap.stubs[i])
+	}
+	c.varLock.Unlock()
+
+	c.clockLock.Lock()
+	defer c.clockLock.Unlock()
+	c.rounds = round
+	return true
+}
+
+// copyNetworks returns a copy of the given variables of networks
+func copyNetworks(networks map[string]map[string]*Variable) map[string]map[string]*Variable {
+	copied := make(map[string]map[string]*Variable, len(networks))
+	for network, vars := range networks {
+		copied[network] = make(map[string]*Variable, len(vars))
+		for name, value := range vars {
+			copied[network][name] = value
+		}
+	}
+	return copied
+}
@@ -0,0 +1,144 @@
+package vm_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dbaumgarten/yodk/pkg/vm"
+)
+
+func TestReverseDebugging(t *testing.T) {
+	prog := "a = 1\na = 2\na = 3\n:done = 1"
+	v, _ := vm.CreateFromSource(prog)
+	v.SetHistorySize(10)
+
+	paused := make(chan int, 1)
+	v.SetBreakpointHandler(func(x *vm.VM) bool {
+		paused <- x.CurrentSourceLine()
+		return false
+	})
+	v.SetStepHandler(func(x *vm.VM) {
+		paused <- x.CurrentSourceLine()
+	})
+
+	// waits until the vm is paused and checks the state
+	expect := func(line int, a string) {
+		got := <-paused
+		for v.State() != vm.StatePaused {
+			time.Sleep(time.Millisecond)
+		}
+		if got != line {
+			t.Fatalf("VM should be paused at line %d, but is at %d", line, got)
+		}
+		val, _ := v.GetVariable("a")
+		if val.Itoa() != a {
+			t.Fatalf("a should be %s at line %d, but is %s", a, line, val.Itoa())
+		}
+	}
+
+	v.AddBreakpoint(3)
+	v.Resume()
+	expect(3, "2")
+
+	err := v.StepBack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(2, "1")
+
+	err = v.RestartLine()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(2, "1")
+
+	v.Resume()
+	expect(3, "2")
+
+	v.Step()
+	expect(4, "3")
+
+	err = v.ReverseContinue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(3, "2")
+
+	v.Terminate()
+}
+
+func TestReverseDebuggingRewindsCoordinator(t *testing.T) {
+	prog := "a = 1 :g = 1\na = 2 :g = 2\n:done = 1"
+	coord := vm.NewCoordinator()
+	err := coord.AddDevice(vm.Device{
+		Name:   "tank",
+		Fields: map[string]interface{}{"level": 0},
+		Behaviours: []vm.DeviceBehaviour{
+			{Type: vm.BehaviourRate, Field: "level", Rate: 1},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = coord.AddRelay(vm.Relay{From: vm.DefaultNetwork, To: "other", Fields: []string{"g"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, _ := vm.CreateFromSource(prog)
+	v.SetCoordinator(coord)
+	v.SetHistorySize(10)
+
+	paused := make(chan int, 1)
+	v.SetBreakpointHandler(func(x *vm.VM) bool {
+		paused <- x.CurrentSourceLine()
+		return false
+	})
+	v.SetStepHandler(func(x *vm.VM) {
+		paused <- x.CurrentSourceLine()
+	})
+
+	// waits until the vm is paused and checks the state of the vm and the coordinator
+	expect := func(line int, a string, g string, level string) {
+		got := <-paused
+		for v.State() != vm.StatePaused {
+			time.Sleep(time.Millisecond)
+		}
+		if got != line {
+			t.Fatalf("VM should be paused at line %d, but is at %d", line, got)
+		}
+		vars := map[string]string{}
+		val, _ := v.GetVariable("a")
+		vars["a"] = val.Itoa()
+		val, _ = coord.GetVariable(":g")
+		vars[":g"] = val.Itoa()
+		val, _ = coord.GetNetworkVariable("other", ":g")
+		vars["relayed :g"] = val.Itoa()
+		val, _ = coord.GetVariable(":level")
+		vars[":level"] = val.Itoa()
+		expected := map[string]string{"a": a, ":g": g, "relayed :g": g, ":level": level}
+		for name, value := range expected {
+			if vars[name] != value {
+				t.Fatalf("%s should be %s at line %d, but is %s", name, value, line, vars[name])
+			}
+		}
+	}
+
+	v.AddBreakpoint(3)
+	v.Resume()
+	coord.Run()
+	expect(3, "2", "2", "2")
+
+	err = v.StepBack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(2, "1", "1", "1")
+	if rounds := coord.GetRounds(); rounds != 1 {
+		t.Fatalf("The coordinator should have been rewound to round 1, but is at %d", rounds)
+	}
+
+	v.Resume()
+	expect(3, "2", "2", "2")
+
+	coord.Terminate()
+}
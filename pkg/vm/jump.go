@@ -0,0 +1,83 @@
+package vm
+
+import (
+	"fmt"
+
+	"github.com/dbaumgarten/yodk/pkg/parser/ast"
+)
+
+// SetNextLine moves the execution to the beginning of the given source-line and pauses there.
+// The rest of the current line is not executed. The VM must be paused.
+// Only lines that start a line of the executed program are valid targets (see ListJumpTargets()).
+func (v *VM) SetNextLine(line int) error {
+	v.lock.Lock()
+	if v.state != StatePaused {
+		v.lock.Unlock()
+		return fmt.Errorf("The vm must be paused to jump to another line")
+	}
+	astLine := v.astLineForSourceLine(line)
+	if astLine < 1 {
+		v.lock.Unlock()
+		return fmt.Errorf("Can not jump to line %d. Only the start of a line of the executed program is a valid target", line)
+	}
+	v.nextLine = astLine
+	v.lock.Unlock()
+	// step, so the vm pauses right at the target
+	v.Step()
+	return nil
+}
+
+// ListJumpTargets returns the source-lines that can be used as target for SetNextLine()
+func (v *VM) ListJumpTargets() []int {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	targets := make([]int, 0, len(v.program.Lines))
+	for i := range v.program.Lines {
+		if line := v.sourceLineOfAstLine(i + 1); line > 0 {
+			targets = append(targets, line)
+		}
+	}
+	return targets
+}
+
+// sourceLineOfAstLine returns the source-line at which the given ast-line starts. Returns 0 if this is unknown
+// Does not use the lock. ONLY USE WHEN LOCK IS ALREADY HELD
+func (v *VM) sourceLineOfAstLine(astLine int) int {
+	line := v.program.Lines[astLine-1]
+	if len(line.Statements) == 0 {
+		return line.Start().Line
+	}
+	start := line.Statements[0].Start()
+	// the statement has been included from another file
+	if start.File != "" || start == ast.UnknownPosition {
+		return 0
+	}
+	return start.Line
+}
+
+// astLineForSourceLine returns the ast-line that starts at the given source-line. Returns 0 if there is none
+// Does not use the lock. ONLY USE WHEN LOCK IS ALREADY HELD
+func (v *VM) astLineForSourceLine(line int) int {
+	for i := range v.program.Lines {
+		if v.sourceLineOfAstLine(i+1) == line {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// jumpToNextLine moves the execution to the line requested via SetNextLine() and returns this line
+// Does not use the lock. ONLY USE WHEN LOCK IS ALREADY HELD
+func (v *VM) jumpToNextLine() *ast.Line {
+	v.currentAstLine = v.nextLine
+	v.nextLine = 0
+	// make sure the target line triggers a line-change (and therefore a pause)
+	v.jumped = true
+	return v.program.Lines[v.currentAstLine-1]
+}
+
+// redirectRequested returns true if the execution is to continue somewhere else (because of a restore or a jump)
+// Does not use the lock. ONLY USE WHEN LOCK IS ALREADY HELD
+func (v *VM) redirectRequested() bool {
+	return v.restoreIndex >= 0 || v.nextLine > 0
+}
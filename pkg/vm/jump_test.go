@@ -0,0 +1,68 @@
+package vm_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dbaumgarten/yodk/pkg/vm"
+)
+
+func TestSetNextLine(t *testing.T) {
+	prog := "a=1\nb=1 c=1\nd=1\n:done=1"
+	v, _ := vm.CreateFromSource(prog)
+
+	paused := make(chan int, 1)
+	v.SetBreakpointHandler(func(x *vm.VM) bool {
+		paused <- x.CurrentSourceLine()
+		return false
+	})
+	v.SetStepHandler(func(x *vm.VM) {
+		paused <- x.CurrentSourceLine()
+	})
+
+	// waits until the vm is paused and checks the line
+	expect := func(line int) {
+		got := <-paused
+		for v.State() != vm.StatePaused {
+			time.Sleep(time.Millisecond)
+		}
+		if got != line {
+			t.Fatalf("VM should be paused at line %d, but is at %d", line, got)
+		}
+	}
+
+	targets := v.ListJumpTargets()
+	if len(targets) != 4 {
+		t.Fatalf("Expected 4 jump-targets, but got %v", targets)
+	}
+
+	v.AddBreakpoint(2)
+	v.Resume()
+	expect(2)
+
+	// skip line 2 and 3
+	err := v.SetNextLine(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect(4)
+
+	if err := v.SetNextLine(7); err == nil {
+		t.Fatal("Jumping to a line that does not exist must fail")
+	}
+
+	v.SetMaxExecutedLines(1)
+	v.Resume()
+	v.WaitForTermination()
+
+	vars := v.GetVariables()
+	if _, exists := vars["b"]; exists {
+		t.Fatal("Line 2 should have been skipped")
+	}
+	if _, exists := vars["d"]; exists {
+		t.Fatal("Line 3 should have been skipped")
+	}
+	if _, exists := vars[":done"]; !exists {
+		t.Fatal("Line 4 should have been executed")
+	}
+}
@@ -0,0 +1,56 @@
+package vm
+
+import (
+	"github.com/dbaumgarten/yodk/pkg/parser/ast"
+)
+
+// GetLineCounts returns how often each line of the program has been executed.
+// The returned slice is indexed by ast-line - 1
+func (v *VM) GetLineCounts() []int {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	counts := make([]int, len(v.program.Lines))
+	copy(counts, v.lineCounts)
+	return counts
+}
+
+// GetStatementCounts returns how often each statement of the program has been executed.
+// Statements inside ifs are counted seperately from the if itself. Statements that have never been executed are not included
+func (v *VM) GetStatementCounts() map[ast.Statement]int {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	counts := make(map[ast.Statement]int, len(v.statementCounts))
+	for stmt, count := range v.statementCounts {
+		counts[stmt] = count
+	}
+	return counts
+}
+
+// ResetExecutionCounts sets the execution-counts of all lines and statements to zero
+func (v *VM) ResetExecutionCounts() {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.lineCounts = nil
+	v.statementCounts = make(map[ast.Statement]int)
+}
+
+// countLine increments the execution-count of the given ast-line
+// Does not use the lock. ONLY USE WHEN LOCK IS ALREADY HELD
+func (v *VM) countLine(astLine int) {
+	if v.lineCounts == nil {
+		v.lineCounts = make([]int, len(v.program.Lines))
+	}
+	if astLine > 0 && astLine <= len(v.lineCounts) {
+		v.lineCounts[astLine-1]++
+	}
+}
+
+// countStatement increments the execution-count of the given statement
+// Does not use the lock. ONLY USE WHEN LOCK IS ALREADY HELD
+func (v *VM) countStatement(stmt ast.Statement) {
+	// statements executed by the debugger are not part of the program
+	if v.evaluating {
+		return
+	}
+	v.statementCounts[stmt]++
+}
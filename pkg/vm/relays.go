@@ -0,0 +1,35 @@
+package vm
+
+// Relay forwards the values of selected fields from one network to another
+type Relay struct {
+	// Name of the relay. Only used for display-purposes
+	Name string
+	// The network whose fields are forwarded
+	From string
+	// The network the fields are forwarded to
+	To string
+	// The names of the fields that are forwarded
+	Fields []string
+	// If true, fields are also forwarded from To to From
+	Bidirectional bool
+}
+
+// forwards checks if the relay forwards the given variable when it is written on the given network
+// If so, the network the variable is forwarded to is returned
+func (r Relay) forwards(network string, varname string) (string, bool) {
+	var target string
+	switch {
+	case network == r.From:
+		target = r.To
+	case network == r.To && r.Bidirectional:
+		target = r.From
+	default:
+		return "", false
+	}
+	for _, field := range r.Fields {
+		if fieldVarname(field) == varname {
+			return target, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,174 @@
+package vm
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/dbaumgarten/yodk/pkg/number"
+	"github.com/dbaumgarten/yodk/pkg/parser"
+	"github.com/dbaumgarten/yodk/pkg/parser/ast"
+)
+
+// StubRule sets global variables once a condition becomes true
+type StubRule struct {
+	// A yolol-expression. The rule is triggered every time the condition becomes true (not 0) after being false.
+	// An empty condition triggers the rule once, in the first tick
+	When string
+	// Number of lines (ticks) the stub waits after the rule has been triggered, before the values are set. 0 = immediately
+	After int
+	// The global variables to set and their values
+	Set map[string]interface{}
+}
+
+// Stub describes a simulated chip. Instead of running a script, the behaviour of the chip is described by simple rules.
+// Like a VM, a stub executes one line per round of coordinated execution. In every line, it checks all of its rules.
+type Stub struct {
+	// Name of the stub. Only used for display-purposes
+	Name string
+	// The networks the stub is connected to. Defaults to DefaultNetwork
+	Networks []string
+	// The rules of the stub
+	Rules []StubRule
+}
+
+// simulatedStub is the runtime-state of a stub registered with a coordinator
+type simulatedStub struct {
+	Stub
+	conditions []ast.Expression
+	values     []map[string]*Variable
+	// the result of the condition of every rule in the previous tick
+	wasTrue []bool
+	// for every rule, the remaining ticks until pending triggers set their values
+	pending [][]int
+	// used to evaluate the conditions in the context of the networks of the stub
+	evaluator *VM
+	stopOnce  *sync.Once
+}
+
+// stubState is the part of the runtime-state of a stub that changes while it is executed
+type stubState struct {
+	wasTrue []bool
+	pending [][]int
+}
+
+// newSimulatedStub validates the given stub-description and prepares it for simulation
+func newSimulatedStub(s Stub) (*simulatedStub, error) {
+	ss := &simulatedStub{
+		Stub:       s,
+		conditions: make([]ast.Expression, len(s.Rules)),
+		values:     make([]map[string]*Variable, len(s.Rules)),
+		wasTrue:    make([]bool, len(s.Rules)),
+		pending:    make([][]int, len(s.Rules)),
+		stopOnce:   &sync.Once{},
+	}
+	for i, rule := range s.Rules {
+		if rule.When != "" {
+			cond, err := parser.NewParser().ParseExpressionString(rule.When)
+			if err != nil {
+				return nil, fmt.Errorf("Stub '%s', rule %d: Invalid condition '%s': %s", s.Name, i+1, rule.When, err.Error())
+			}
+			ss.conditions[i] = cond
+		}
+		if rule.After < 0 {
+			return nil, fmt.Errorf("Stub '%s', rule %d: After must not be negative", s.Name, i+1)
+		}
+		if len(rule.Set) == 0 {
+			return nil, fmt.Errorf("Stub '%s', rule %d: The rule does not set any variables", s.Name, i+1)
+		}
+		ss.values[i] = make(map[string]*Variable, len(rule.Set))
+		for name, value := range rule.Set {
+			variable, err := VariableFromType(value)
+			if err != nil {
+				return nil, fmt.Errorf("Stub '%s', rule %d: Invalid value for '%s': %s", s.Name, i+1, name, err.Error())
+			}
+			ss.values[i][fieldVarname(name)] = variable
+		}
+	}
+	return ss, nil
+}
+
+// initialize connects the stub to the networks of the coordinator
+func (s *simulatedStub) initialize(c *Coordinator) {
+	// the evaluator is never resumed. It only provides the context to evaluate expressions
+	s.evaluator = Create(&ast.Program{})
+	s.evaluator.SetNetworks(s.Networks...)
+	s.evaluator.shareGlobals(c)
+}
+
+// stop terminates the evaluator of the stub. Can safely be called multiple times
+func (s *simulatedStub) stop() {
+	s.stopOnce.Do(s.evaluator.Terminate)
+}
+
+// state returns a copy of the runtime-state of the stub
+func (s *simulatedStub) state() stubState {
+	return copyStubState(stubState{
+		wasTrue: s.wasTrue,
+		pending: s.pending,
+	})
+}
+
+// restore restores a runtime-state returned by state()
+func (s *simulatedStub) restore(state stubState) {
+	state = copyStubState(state)
+	s.wasTrue = state.wasTrue
+	s.pending = state.pending
+}
+
+// copyStubState returns a deep copy of the given state
+func copyStubState(state stubState) stubState {
+	copied := stubState{
+		wasTrue: make([]bool, len(state.wasTrue)),
+		pending: make([][]int, len(state.pending)),
+	}
+	copy(copied.wasTrue, state.wasTrue)
+	for i, ticks := range state.pending {
+		copied.pending[i] = make([]int, len(ticks))
+		copy(copied.pending[i], ticks)
+	}
+	return copied
+}
+
+// update performs one line of the stub
+func (s *simulatedStub) update(c *Coordinator) {
+	for i := range s.Rules {
+		// apply the values of earlier triggers whose delay is over
+		remaining := s.pending[i][:0]
+		for _, ticks := range s.pending[i] {
+			ticks--
+			if ticks <= 0 {
+				s.apply(c, i)
+			} else {
+				remaining = append(remaining, ticks)
+			}
+		}
+		s.pending[i] = remaining
+
+		isTrue := s.evaluate(i)
+		if isTrue && !s.wasTrue[i] {
+			if s.Rules[i].After == 0 {
+				s.apply(c, i)
+			} else {
+				s.pending[i] = append(s.pending[i], s.Rules[i].After)
+			}
+		}
+		s.wasTrue[i] = isTrue
+	}
+}
+
+// evaluate returns true if the condition of the given rule is currently true
+// Errors during the evaluation count as false
+func (s *simulatedStub) evaluate(rule int) bool {
+	if s.conditions[rule] == nil {
+		return true
+	}
+	result, err := s.evaluator.Evaluate(s.conditions[rule])
+	return err == nil && result.IsNumber() && result.Number() != number.Zero
+}
+
+// apply sets the variables of the given rule
+func (s *simulatedStub) apply(c *Coordinator, rule int) {
+	for name, value := range s.values[rule] {
+		c.setVariableOnNetworks(nil, s.Networks, name, &Variable{Value: value.Value})
+	}
+}
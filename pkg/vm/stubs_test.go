@@ -0,0 +1,72 @@
+package vm_test
+
+import (
+	"testing"
+
+	"github.com/dbaumgarten/yodk/pkg/vm"
+)
+
+func TestStubs(t *testing.T) {
+	prog := `:ticks++ :state=(:ticks>=2)*2 if :ack then :acked=:ticks :ack=0 goto 2 end goto 1
+if :ack then :again=1 end goto 2`
+	coord := vm.NewCoordinator()
+	err := coord.AddStub(vm.Stub{
+		Name: "door",
+		Rules: []vm.StubRule{
+			{
+				When:  ":state == 2",
+				After: 3,
+				Set: map[string]interface{}{
+					"ack": 1,
+				},
+			},
+			{
+				Set: map[string]interface{}{
+					"initialized": 1,
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, _ := vm.CreateFromSource(prog)
+	v.SetCoordinator(coord)
+	v.SetMaxExecutedLines(20)
+	v.Resume()
+
+	coord.Run()
+	coord.WaitForTermination()
+
+	// :state becomes 2 in tick 2. The ack is set at the end of tick 5 and seen in tick 6
+	acked, _ := coord.GetVariable(":acked")
+	if acked.Itoa() != "6" {
+		t.Fatalf("The ack should have been seen in tick 6, but was seen in %s", acked.Repr())
+	}
+
+	// the rule is only triggered once, as :state stays 2
+	if _, exists := coord.GetVariable(":again"); exists {
+		t.Fatal("The rule has been triggered again, although the condition did not become true again")
+	}
+
+	initialized, _ := coord.GetVariable(":initialized")
+	if initialized == nil || initialized.Itoa() != "1" {
+		t.Fatal("The rule without condition has not been triggered")
+	}
+
+	err = coord.AddStub(vm.Stub{
+		Name: "broken",
+		Rules: []vm.StubRule{
+			{
+				When: ":a ==",
+				Set: map[string]interface{}{
+					"b": 1,
+				},
+			},
+		},
+	})
+	if err == nil {
+		t.Fatal("Adding a stub with an invalid condition should fail")
+	}
+}
@@ -45,6 +45,8 @@ func VariableFromType(inp interface{}) (*Variable, error) {
 		value = number.FromFloat64(float64(v))
 	case float64:
 		value = number.FromFloat64(v)
+	case number.Number:
+		value = v
 	default:
 		return nil, fmt.Errorf("Can not convert type %T to variable", inp)
 	}
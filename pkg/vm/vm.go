@@ -35,6 +35,10 @@ type FinishHandlerFunc func(vm *VM)
 // LineExecutedHandlerFunc it the type for the handler that is called after a line has been executed
 type LineExecutedHandlerFunc func(vm *VM) bool
 
+// VariableChangedHandlerFunc is the type for the handler that is called when the vm writes a variable.
+// oldValue is nil if the variable did not exist before
+type VariableChangedHandlerFunc func(vm *VM, name string, oldValue *Variable, newValue *Variable)
+
 // TerminateOnDoneVar is a predefined LineExecutedHandlerFunc that can be used to terminate the VM once :done is set to 1
 var TerminateOnDoneVar = func(vm *VM) bool {
 	value, exists := vm.GetVariable(":done")
@@ -69,21 +73,30 @@ type VM struct {
 	// the current variables of the programm
 	variables map[string]*Variable
 	// event handlers
-	breakpointHandler   BreakpointFunc
-	stepHandler         FinishHandlerFunc
-	errorHandler        ErrorHandlerFunc
-	finishHandler       FinishHandlerFunc
-	lineExecutedHandler LineExecutedHandlerFunc
+	breakpointHandler      BreakpointFunc
+	stepHandler            FinishHandlerFunc
+	errorHandler           ErrorHandlerFunc
+	finishHandler          FinishHandlerFunc
+	lineExecutedHandler    LineExecutedHandlerFunc
+	variableChangedHandler VariableChangedHandlerFunc
+	logpointHandler        LogpointFunc
 	// current line in the ast is 1-indexed
 	currentAstLine int
+	// the ast-line that is executed/has been executed last. Unlike currentAstLine this is not modified by gotos
+	lastAstLine int
 	// current line in the source code
 	currentSourceLine int
 	// currerent coloumn in the current source line
 	currentSourceColoumn int
+	// the position of the current statement. Unlike currentSourceLine this also includes the file
+	currentStatementPosition ast.Position
 	// if true we arrived at the current line via a goto
 	jumped bool
 	// list of active breakpoints
-	breakpoints map[int]bool
+	breakpoints map[int]*Breakpoint
+	// list of active watchpoints
+	watchpoints       []Watchpoint
+	watchpointHandler WatchpointFunc
 	// current state of the vm
 	state int
 	// this channel is used to comminucate state-change-requests
@@ -96,10 +109,28 @@ type VM struct {
 	coordinatorPermission <-chan struct{}
 	// this channel is used to signal to the coordinator that we finished running a line
 	coordinatorDone chan<- struct{}
+	// the networks of the coordinator this vm is connected to. If empty, the default network is used
+	networks []string
 	// if != 0 and in the current iteration more the x lines are run, terminate VM
 	maxExecutedLines int
 	// number of lines executed in the current run
 	executedLines int
+	// maximum number of snapshots to keep in history. <= 0 disables the history
+	historySize int
+	// snapshots of the previously executed lines (oldest first)
+	history []snapshot
+	// if >= 0, the snapshot with this index is to be restored before executing the next statement
+	restoreIndex int
+	// if > 0, the execution continues at this ast-line before executing the next statement
+	nextLine int
+	// true if the execution of the current line has not yet started
+	atLineStart bool
+	// true while code is evaluated on behalf of the debugger (and not as part of the program)
+	evaluating bool
+	// number of executions per ast-line (index = ast-line - 1)
+	lineCounts []int
+	// number of executions per statement
+	statementCounts map[ast.Statement]int
 }
 
 // Create creates a new VM to run the given program in a seperate goroutine.
@@ -108,7 +139,7 @@ func Create(prog *ast.Program) *VM {
 	vm := &VM{
 		variables:      make(map[string]*Variable),
 		state:          StatePaused,
-		breakpoints:    make(map[int]bool),
+		breakpoints:    make(map[int]*Breakpoint),
 		lock:           &sync.Mutex{},
 		currentAstLine: 1,
 		// initialize to 0, so the first executed line triggers a lineChanged()
@@ -116,6 +147,8 @@ func Create(prog *ast.Program) *VM {
 		stateRequests:      make(chan int),
 		terminationChannel: make(chan interface{}),
 		program:            prog,
+		restoreIndex:       -1,
+		statementCounts:    make(map[ast.Statement]int),
 	}
 	go vm.run()
 	return vm
@@ -151,7 +184,9 @@ func (v *VM) GetExecutedLines() int {
 func (v *VM) AddBreakpoint(line int) {
 	v.lock.Lock()
 	defer v.lock.Unlock()
-	v.breakpoints[line] = true
+	v.breakpoints[line] = &Breakpoint{
+		Line: line,
+	}
 }
 
 // RemoveBreakpoint removes the breakpoint at the line
@@ -217,6 +252,14 @@ func (v *VM) CurrentSourceColoumn() int {
 	return v.currentSourceColoumn
 }
 
+// CurrentStatementPosition returns the position of the current (=next to be executed) statement of the program
+// Unlike CurrentSourceLine() this also works for statements that have been included from other files
+func (v *VM) CurrentStatementPosition() ast.Position {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return v.currentStatementPosition
+}
+
 // CurrentAstLine returns the current (=next to be executed) ast line of the program
 func (v *VM) CurrentAstLine() int {
 	v.lock.Lock()
@@ -224,6 +267,14 @@ func (v *VM) CurrentAstLine() int {
 	return v.currentAstLine
 }
 
+// LastAstLine returns the ast line that is currently executed or has been executed last
+// Unlike CurrentAstLine() the returned value is not changed by gotos. Useful inside a LineExecutedHandler
+func (v *VM) LastAstLine() int {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return v.lastAstLine
+}
+
 // SetBreakpointHandler sets the function to be called when hitting a breakpoint
 func (v *VM) SetBreakpointHandler(f BreakpointFunc) {
 	v.lock.Lock()
@@ -260,12 +311,65 @@ func (v *VM) SetLineExecutedHandler(handler LineExecutedHandlerFunc) {
 	v.lineExecutedHandler = handler
 }
 
+// GetLineExecutedHandler returns the currently registered LineExecutedHandler (or nil)
+// Can be used to chain multiple handlers
+func (v *VM) GetLineExecutedHandler() LineExecutedHandlerFunc {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return v.lineExecutedHandler
+}
+
+// GetErrorHandler returns the currently registered ErrorHandler (or nil)
+// Can be used to chain multiple handlers
+func (v *VM) GetErrorHandler() ErrorHandlerFunc {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return v.errorHandler
+}
+
+// SetVariableChangedHandler registers a callback that is executed every time the vm writes a variable
+func (v *VM) SetVariableChangedHandler(handler VariableChangedHandlerFunc) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.variableChangedHandler = handler
+}
+
 // SetCoordinator sets the coordinator that is used to coordinate execution with other vms
 func (v *VM) SetCoordinator(c *Coordinator) {
 	v.lock.Lock()
 	defer v.lock.Unlock()
 	v.coordinator = c
 	v.coordinatorPermission, v.coordinatorDone = c.registerVM(v)
+	if v.historySize > 0 {
+		c.growHistory(v.historySize)
+	}
+}
+
+// shareGlobals gives the vm access to the global variables of the coordinator, without registering it for the coordinated execution
+// Used for vms that are never resumed, but evaluate expressions on behalf of the coordinator
+func (v *VM) shareGlobals(c *Coordinator) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.coordinator = c
+}
+
+// SetNetworks sets the networks (of the coordinator) the vm is connected to
+// Global variables are read from the first network that contains them and written to all networks
+// If no networks are set, the vm is connected to the default network of the coordinator
+func (v *VM) SetNetworks(networks ...string) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.networks = networks
+}
+
+// GetNetworks returns the networks the vm is connected to
+func (v *VM) GetNetworks() []string {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	if len(v.networks) == 0 {
+		return []string{DefaultNetwork}
+	}
+	return v.networks
 }
 
 // ListBreakpoints returns the list of active breakpoints
@@ -290,7 +394,7 @@ func (v *VM) GetVariables() map[string]Variable {
 		}
 	}
 	if v.coordinator != nil {
-		globals := v.coordinator.GetVariables()
+		globals := v.coordinator.getVariablesFromNetworks(v.networks)
 		for key, value := range globals {
 			varlist[key] = Variable{
 				Value: value.Value,
@@ -337,7 +441,7 @@ func (v *VM) GetProgram() *ast.Program {
 func (v *VM) getVariable(name string) (*Variable, bool) {
 	name = strings.ToLower(name)
 	if v.coordinator != nil && strings.HasPrefix(name, ":") {
-		return v.coordinator.GetVariable(name)
+		return v.coordinator.getVariableFromNetworks(v.networks, name)
 	}
 	val, exists := v.variables[name]
 	return val, exists
@@ -348,9 +452,15 @@ func (v *VM) getVariable(name string) (*Variable, bool) {
 // setting variables is case-insensitive
 func (v *VM) setVariable(name string, value *Variable) error {
 	name = strings.ToLower(name)
+	if v.variableChangedHandler != nil {
+		oldValue, _ := v.getVariable(name)
+		v.lock.Unlock()
+		v.variableChangedHandler(v, name, oldValue, value)
+		v.lock.Lock()
+	}
 	v.variables[name] = value
 	if v.coordinator != nil && strings.HasPrefix(name, ":") {
-		err := v.coordinator.SetVariable(name, value)
+		err := v.coordinator.setVariableOnNetworks(v, v.networks, name, value)
 		if err != nil {
 			return err
 		}
@@ -452,6 +562,13 @@ func (v *VM) run() {
 			v.currentAstLine = 1
 		}
 
+		// a restore or a jump has been requested while the vm was paused between two lines
+		if v.restoreIndex >= 0 {
+			v.currentAstLine = v.history[v.restoreIndex].astLine
+		} else if v.nextLine > 0 {
+			v.currentAstLine = v.nextLine
+		}
+
 		if v.currentAstLine-1 < len(v.program.Lines) {
 			// lines are counted from 1. Compensate this when indexing the array
 			line := v.program.Lines[v.currentAstLine-1]
@@ -471,6 +588,7 @@ func (v *VM) run() {
 			}
 		} else {
 			// nothing to to but to trigger a line-change notification
+			v.lastAstLine = v.currentAstLine
 			v.currentSourceLine = v.currentAstLine
 			v.currentSourceColoumn = 0
 			v.sourceLineChanged()
@@ -505,8 +623,15 @@ func (v *VM) sourceLineChanged() {
 	}
 
 	// check if we hit a breakpoint
-	if _, exists := v.breakpoints[v.currentSourceLine]; exists {
-		if v.breakpointHandler != nil {
+	if bp, exists := v.breakpoints[v.currentSourceLine]; exists && v.breakpointTriggered(bp) {
+		if bp.IsLogpoint() {
+			if v.logpointHandler != nil {
+				message := v.formatLogMessage(bp)
+				v.lock.Unlock()
+				v.logpointHandler(v, *bp, message)
+				v.lock.Lock()
+			}
+		} else if v.breakpointHandler != nil {
 			v.lock.Unlock()
 			continueExecution := v.breakpointHandler(v)
 			v.lock.Lock()
@@ -522,6 +647,10 @@ func (v *VM) sourceLineChanged() {
 
 // check if the statement that is to be executed is on a different line then the previous one
 func (v *VM) checkSourceLineChanged(stmt ast.Statement) {
+	// statements executed by the debugger are not part of the program
+	if v.evaluating {
+		return
+	}
 	if stmt.Start().File == "" && (stmt.Start().Line != v.currentSourceLine || v.jumped) && stmt.Start() != ast.UnknownPosition {
 		v.jumped = false
 		v.currentSourceLine = stmt.Start().Line
@@ -557,12 +686,35 @@ func (v *VM) runLine(line *ast.Line) error {
 		}()
 	}
 
+	for {
+		if v.restoreIndex >= 0 {
+			line = v.restoreSnapshot()
+		} else if v.nextLine > 0 {
+			line = v.jumpToNextLine()
+		}
+		err := v.executeLine(line)
+		// when restoring a snapshot or jumping, keep the permission of the coordinator and directly execute the new line
+		if err != errRestore {
+			return err
+		}
+	}
+}
+
+// executeLine executes the statements of the given line
+func (v *VM) executeLine(line *ast.Line) error {
+	v.lastAstLine = v.currentAstLine
+	v.takeSnapshot()
+
 	// an empty line has no statements that would trigger actions like breakpoints
 	// trigger these actions manually
 	if len(line.Statements) == 0 {
 		v.currentSourceLine = line.Start().Line
 		v.currentSourceColoumn = 0
+		v.currentStatementPosition = line.Start()
 		v.sourceLineChanged()
+		if v.redirectRequested() {
+			return errRestore
+		}
 	}
 
 	for _, stmt := range line.Statements {
@@ -576,7 +728,9 @@ func (v *VM) runLine(line *ast.Line) error {
 		}
 	}
 
+	v.atLineStart = false
 	v.executedLines++
+	v.countLine(v.lastAstLine)
 	if v.lineExecutedHandler != nil {
 		v.lock.Unlock()
 		cont := v.lineExecutedHandler(v)
@@ -586,12 +740,25 @@ func (v *VM) runLine(line *ast.Line) error {
 		}
 	}
 
+	if v.redirectRequested() {
+		return errRestore
+	}
+
 	return nil
 }
 
 func (v *VM) runStmt(stmt ast.Statement) error {
 	v.currentSourceColoumn = stmt.Start().Coloumn
+	if !v.evaluating {
+		v.currentStatementPosition = stmt.Start()
+	}
 	v.checkSourceLineChanged(stmt)
+	// a restore or a jump has been requested while paused at the statement
+	if v.redirectRequested() {
+		return errRestore
+	}
+	v.atLineStart = false
+	v.countStatement(stmt)
 	switch e := stmt.(type) {
 	case *ast.Assignment:
 		return v.runAssignment(e)
@@ -664,7 +831,7 @@ func (v *VM) runAssignment(as *ast.Assignment) error {
 	if err != nil {
 		return err
 	}
-	v.setVariable(as.Variable, newValue)
+	v.writeVariable(as.Variable, newValue)
 	return nil
 }
 
@@ -690,7 +857,7 @@ func (v *VM) runExpr(expr ast.Expression) (*Variable, error) {
 }
 
 func (v *VM) runDeref(d *ast.Dereference) (*Variable, error) {
-	oldval, exists := v.getVariable(d.Variable)
+	oldval, exists := v.readVariable(d.Variable)
 	if !exists {
 		// uninitialized variables have a default value of 0
 		oldval = &Variable{
@@ -711,7 +878,7 @@ func (v *VM) runDeref(d *ast.Dereference) (*Variable, error) {
 		default:
 			return nil, RuntimeError{fmt.Errorf("Unknown operator '%s'", d.Operator), d}
 		}
-		v.setVariable(d.Variable, &newval)
+		v.writeVariable(d.Variable, &newval)
 	}
 	if oldval.IsString() {
 		switch d.Operator {
@@ -736,7 +903,7 @@ func (v *VM) runDeref(d *ast.Dereference) (*Variable, error) {
 		default:
 			return nil, RuntimeError{fmt.Errorf("Unknown operator '%s'", d.Operator), d}
 		}
-		v.setVariable(d.Variable, &newval)
+		v.writeVariable(d.Variable, &newval)
 	}
 
 	return &newval, nil
@@ -0,0 +1,221 @@
+package vm
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dbaumgarten/yodk/pkg/number"
+)
+
+// The different types of watchpoints
+const (
+	// WatchRead triggers when the variable is read
+	WatchRead = "read"
+	// WatchWrite triggers when the variable is written
+	WatchWrite = "write"
+	// WatchReadWrite triggers when the variable is read or written
+	WatchReadWrite = "readWrite"
+	// WatchChange triggers when the variable is written and the value changes
+	WatchChange = "change"
+)
+
+// the operators that can be used in the condition of a watchpoint. Longer operators first, to simplify parsing
+var watchOperators = []string{"==", "!=", "<=", ">=", "<", ">"}
+
+// WatchpointFunc is a function that is called when a watchpoint is triggered.
+// For read-accesses oldValue is nil. For writes, oldValue is nil if the variable did not exist before.
+// If true is returned the execution is resumed. Otherwise the vm remains paused
+type WatchpointFunc func(vm *VM, wp Watchpoint, oldValue *Variable, newValue *Variable) bool
+
+// Watchpoint pauses the execution when a variable is accessed
+type Watchpoint struct {
+	// The name of the watched variable. Names of global variables start with ':'
+	Variable string
+	// The kind of access that triggers the watchpoint. One of the Watch* constants
+	Type string
+	// An optional condition for the accessed value (read or written) in the form "<operator> <value>", e.g. "== 5"
+	Condition string
+	// the parsed condition
+	operator string
+	value    *Variable
+}
+
+// NewWatchpoint creates a new watchpoint and validates its parameters
+func NewWatchpoint(variable string, typ string, condition string) (Watchpoint, error) {
+	wp := Watchpoint{
+		Variable:  strings.ToLower(variable),
+		Type:      typ,
+		Condition: strings.TrimSpace(condition),
+	}
+	if wp.Variable == "" || wp.Variable == ":" {
+		return wp, fmt.Errorf("Watchpoints need a variable")
+	}
+	switch typ {
+	case WatchRead, WatchWrite, WatchReadWrite, WatchChange:
+	default:
+		return wp, fmt.Errorf("Unknown watchpoint-type '%s'. Possible options are %s, %s, %s or %s", typ, WatchRead, WatchWrite, WatchReadWrite, WatchChange)
+	}
+	if wp.Condition != "" {
+		for _, op := range watchOperators {
+			if strings.HasPrefix(wp.Condition, op) {
+				wp.operator = op
+				wp.value = VariableFromString(strings.TrimSpace(wp.Condition[len(op):]))
+				break
+			}
+		}
+		if wp.operator == "" {
+			return wp, fmt.Errorf("Invalid watchpoint-condition '%s'. The condition must start with one of %s", wp.Condition, strings.Join(watchOperators, ", "))
+		}
+	}
+	return wp, nil
+}
+
+// IsGlobal returns true if the watched variable is a global one
+func (wp Watchpoint) IsGlobal() bool {
+	return strings.HasPrefix(wp.Variable, ":")
+}
+
+// matches checks if the given access triggers the watchpoint
+func (wp Watchpoint) matches(isRead bool, oldValue *Variable, newValue *Variable) bool {
+	switch wp.Type {
+	case WatchRead:
+		if !isRead {
+			return false
+		}
+	case WatchWrite:
+		if isRead {
+			return false
+		}
+	case WatchChange:
+		if isRead || (oldValue != nil && oldValue.Equals(newValue)) {
+			return false
+		}
+	}
+	if wp.operator != "" {
+		result, err := RunBinaryOperation(newValue, wp.value, wp.operator)
+		if err != nil || result.Number() == number.Zero {
+			return false
+		}
+	}
+	return true
+}
+
+// AddWatchpoint adds a watchpoint to the vm.
+// Watchpoints on global variables can also be added to the coordinator, to watch them in all VMs
+func (v *VM) AddWatchpoint(wp Watchpoint) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.watchpoints = append(v.watchpoints, wp)
+}
+
+// RemoveWatchpoints removes all watchpoints for the given variable
+func (v *VM) RemoveWatchpoints(variable string) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.watchpoints = removeWatchpoints(v.watchpoints, variable)
+}
+
+// ClearWatchpoints removes all watchpoints
+func (v *VM) ClearWatchpoints() {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.watchpoints = nil
+}
+
+// ListWatchpoints returns the list of active watchpoints
+func (v *VM) ListWatchpoints() []Watchpoint {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	li := make([]Watchpoint, len(v.watchpoints))
+	copy(li, v.watchpoints)
+	return li
+}
+
+// SetWatchpointHandler sets the function to be called when a watchpoint is triggered
+func (v *VM) SetWatchpointHandler(f WatchpointFunc) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.watchpointHandler = f
+}
+
+// removeWatchpoints returns a list of the given watchpoints without the watchpoints for variable
+func removeWatchpoints(watchpoints []Watchpoint, variable string) []Watchpoint {
+	variable = strings.ToLower(variable)
+	remaining := make([]Watchpoint, 0, len(watchpoints))
+	for _, wp := range watchpoints {
+		if wp.Variable != variable {
+			remaining = append(remaining, wp)
+		}
+	}
+	return remaining
+}
+
+// watchpointsFor returns all watchpoints of the vm (and the coordinator) for the given variable
+// Does not use the lock. ONLY USE WHEN LOCK IS ALREADY HELD
+func (v *VM) watchpointsFor(name string) []Watchpoint {
+	var found []Watchpoint
+	// code evaluated by the debugger is not part of the program-execution
+	if v.evaluating {
+		return found
+	}
+	for _, wp := range v.watchpoints {
+		if wp.Variable == name {
+			found = append(found, wp)
+		}
+	}
+	if v.coordinator != nil && strings.HasPrefix(name, ":") {
+		found = append(found, v.coordinator.watchpointsFor(name)...)
+	}
+	return found
+}
+
+// readVariable reads a variable as part of the program-execution. Triggers watchpoints
+// Does not use the lock. ONLY USE WHEN LOCK IS ALREADY HELD
+func (v *VM) readVariable(name string) (*Variable, bool) {
+	value, exists := v.getVariable(name)
+	watchpoints := v.watchpointsFor(strings.ToLower(name))
+	if len(watchpoints) > 0 {
+		readValue := value
+		if !exists {
+			// uninitialized variables have a default value of 0
+			readValue = &Variable{Value: number.Zero}
+		}
+		v.triggerWatchpoints(watchpoints, true, nil, readValue)
+	}
+	return value, exists
+}
+
+// writeVariable writes a variable as part of the program-execution. Triggers watchpoints
+// Does not use the lock. ONLY USE WHEN LOCK IS ALREADY HELD
+func (v *VM) writeVariable(name string, value *Variable) error {
+	watchpoints := v.watchpointsFor(strings.ToLower(name))
+	if len(watchpoints) == 0 {
+		return v.setVariable(name, value)
+	}
+	oldValue, _ := v.getVariable(name)
+	err := v.setVariable(name, value)
+	if err != nil {
+		return err
+	}
+	v.triggerWatchpoints(watchpoints, false, oldValue, value)
+	return nil
+}
+
+// triggerWatchpoints calls the watchpoint-handler for the first of the given watchpoints that matches the access
+// Does not use the lock. ONLY USE WHEN LOCK IS ALREADY HELD
+func (v *VM) triggerWatchpoints(watchpoints []Watchpoint, isRead bool, oldValue *Variable, newValue *Variable) {
+	for _, wp := range watchpoints {
+		if !wp.matches(isRead, oldValue, newValue) {
+			continue
+		}
+		if v.watchpointHandler != nil {
+			v.lock.Unlock()
+			continueExecution := v.watchpointHandler(v, wp, oldValue, newValue)
+			v.lock.Lock()
+			if !continueExecution {
+				v.pause()
+			}
+		}
+		return
+	}
+}
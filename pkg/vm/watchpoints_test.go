@@ -0,0 +1,76 @@
+package vm_test
+
+import (
+	"testing"
+
+	"github.com/dbaumgarten/yodk/pkg/vm"
+)
+
+func TestWatchpoints(t *testing.T) {
+	prog := "a = 1\na = 2\nb = a\na = 2"
+	v, _ := vm.CreateFromSource(prog)
+	v.SetMaxExecutedLines(4)
+
+	changed, _ := vm.NewWatchpoint("a", vm.WatchChange, "== 2")
+	read, _ := vm.NewWatchpoint("A", vm.WatchRead, "")
+	v.AddWatchpoint(changed)
+	v.AddWatchpoint(read)
+
+	triggered := make([]string, 0)
+	v.SetWatchpointHandler(func(x *vm.VM, wp vm.Watchpoint, oldValue *vm.Variable, newValue *vm.Variable) bool {
+		triggered = append(triggered, wp.Type)
+		if x.CurrentSourceLine() != 2 && wp.Type == vm.WatchChange {
+			t.Fatalf("The change-watchpoint should only trigger at line 2, but triggered at %d", x.CurrentSourceLine())
+		}
+		if x.CurrentSourceLine() != 3 && wp.Type == vm.WatchRead {
+			t.Fatalf("The read-watchpoint should only trigger at line 3, but triggered at %d", x.CurrentSourceLine())
+		}
+		return true
+	})
+
+	v.Resume()
+	v.WaitForTermination()
+
+	if len(triggered) != 2 {
+		t.Fatalf("Expected 2 triggered watchpoints, but got %d", len(triggered))
+	}
+
+	_, err := vm.NewWatchpoint("a", vm.WatchChange, "~ 2")
+	if err == nil {
+		t.Fatal("Invalid conditions should be rejected")
+	}
+}
+
+func TestCoordinatorWatchpoints(t *testing.T) {
+	coord := vm.NewCoordinator()
+	wp, _ := vm.NewWatchpoint(":x", vm.WatchWrite, "> 1")
+	err := coord.AddWatchpoint(wp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	triggeredBy := make([]int, 0)
+	for i, prog := range []string{":x = 1", ":x = 5"} {
+		idx := i
+		v, _ := vm.CreateFromSource(prog)
+		v.SetCoordinator(coord)
+		v.SetMaxExecutedLines(1)
+		v.SetWatchpointHandler(func(x *vm.VM, wp vm.Watchpoint, oldValue *vm.Variable, newValue *vm.Variable) bool {
+			triggeredBy = append(triggeredBy, idx)
+			return true
+		})
+		v.Resume()
+	}
+
+	coord.Run()
+	coord.WaitForTermination()
+
+	if len(triggeredBy) != 1 || triggeredBy[0] != 1 {
+		t.Fatalf("The watchpoint should only have been triggered by the second vm, but was triggered by: %v", triggeredBy)
+	}
+
+	local, _ := vm.NewWatchpoint("x", vm.WatchWrite, "")
+	if coord.AddWatchpoint(local) == nil {
+		t.Fatal("The coordinator should reject watchpoints for local variables")
+	}
+}